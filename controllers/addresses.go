@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"go.fromyama/utils"
+	"go.fromyama/utils/address"
+	"go.fromyama/utils/carriers"
+	"go.fromyama/utils/response"
+)
+
+// canadaPostNoPOBoxServices are the services that can not deliver to a po box, services are matched by their
+// code prefix like serviceOptions
+var canadaPostNoPOBoxServices = []string{"DOM.PC", "USA.PW", "INT.PW"}
+
+type addressValidationError struct {
+	Result address.Result
+}
+func (e *addressValidationError) Error() string{
+	if len(e.Result.Issues) == 0 {
+		return "Address Validation Error"
+	}
+	return "Address Validation Error, " + e.Result.Issues[0].Message
+}
+
+// ValidateAddress /address/validate returns the normalized address and the issues found with it
+// request body has street, city, province_code, country_code, postal_code, optionally service_code and carrier
+// (defaults to canadapost) to check po box delivery
+func ValidateAddress (w http.ResponseWriter, r *http.Request){
+	var body map[string]string
+	err := utils.ParseRequestBody(r, &body, []string{"street", "city", "province_code", "country_code", "postal_code"})
+	if err != nil{
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+
+	result, err := checkAddress(postageAddressFromBody(body), body["carrier"], body["service_code"])
+	if err != nil {
+		response.Error(w, "Address Validation Unavailable")
+		return
+	}
+	response.JSON(w, http.StatusOK, result)
+}
+
+// validateDestination util function that returns the normalized destination of a label request, an
+// *addressValidationError is returned with the issues when the address can not be shipped to with the service,
+// requests with skip_address_validation=true are returned as they are
+func validateDestination (body map[string]string) (response.PostageAddress, error) {
+	dest := postageAddressFromBody(body)
+	if body["skip_address_validation"] == "true" {
+		return dest, nil
+	}
+
+	result, err := checkAddress(dest, body["carrier"], body["service_code"])
+	if err != nil {
+		return dest, err
+	}
+	if !result.Valid {
+		return dest, &addressValidationError{result}
+	}
+	dest.Street = result.Address.Street
+	dest.City = result.Address.City
+	dest.ProvinceCode = result.Address.Province
+	dest.Country = result.Address.Country
+	dest.PostalCode = result.Address.PostalCode
+	return dest, nil
+}
+
+// checkAddress util function that validates an address with address.Provider and flags po boxes the
+// service can not deliver to, an empty carrier is canada post
+func checkAddress (dest response.PostageAddress, carrierName, serviceCode string) (address.Result, error) {
+	result, err := address.Provider.Validate(address.Address{
+		Name: dest.ShipperName,
+		Street: dest.Street,
+		City: dest.City,
+		Province: dest.ProvinceCode,
+		Country: dest.Country,
+		PostalCode: dest.PostalCode,
+	})
+	if err != nil {
+		return result, err
+	}
+	if result.POBox && serviceCode != "" && !serviceDeliversToPOBox(carrierName, serviceCode) {
+		result.Valid = false
+		result.Issues = append(result.Issues, address.Issue{Field: "street", Message: "Service " + serviceCode + " Can Not Deliver To A PO Box"})
+	}
+	return result, nil
+}
+
+// serviceDeliversToPOBox util function that returns if a service can deliver to a po box, only canada post
+// delivers to po boxes
+func serviceDeliversToPOBox (carrierName, serviceCode string) bool {
+	if carrierName != "" && carrierName != carriers.CanadaPost {
+		return false
+	}
+	for _, prefix := range canadaPostNoPOBoxServices {
+		if serviceCode == prefix || strings.HasPrefix(serviceCode, prefix+".") {
+			return false
+		}
+	}
+	return true
+}
@@ -91,7 +91,9 @@ func GetUnfulfilledOrders (w http.ResponseWriter, r *http.Request){
 			orderItems = append(orderItems, formatAmazonItem(orderDetails))
 		}
 	}
-	response.JSON(w, http.StatusOK, formatAmazonOrder(amazonOrders,orderItems))
+	orders := formatAmazonOrder(amazonOrders,orderItems)
+	utils.ValidateOrderAddresses(&orders)
+	response.JSON(w, http.StatusOK, orders)
 }
 
 // Authorize /authorize saves amazon tokens to company account
@@ -160,6 +162,9 @@ func formatAmazonOrder (resp response.AmazonUnfulfilledResponse, items [][]respo
 				WasPaid:   true,
 				Items:     items[i],
 				ShippingAddress: response.Address{
+					Name:       resp.ListOrdersResult.Orders[i].Order.ShippingAddress.Name,
+					Address1:   resp.ListOrdersResult.Orders[i].Order.ShippingAddress.AddressLine1,
+					Address2:   resp.ListOrdersResult.Orders[i].Order.ShippingAddress.AddressLine2,
 					City:       resp.ListOrdersResult.Orders[i].Order.ShippingAddress.City,
 					PostalCode: resp.ListOrdersResult.Orders[i].Order.ShippingAddress.PostalCode,
 					Province:   resp.ListOrdersResult.Orders[i].Order.ShippingAddress.StateOrRegion,
@@ -0,0 +1,412 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+
+	"go.fromyama/utils"
+	"go.fromyama/utils/carriers"
+	"go.fromyama/utils/database"
+	"go.fromyama/utils/jwtUtil"
+	"go.fromyama/utils/pdf"
+	"go.fromyama/utils/response"
+	"go.fromyama/utils/storage"
+)
+
+const addLabelBatchSql = "INSERT INTO label_batches(company_id, user_id, charge_id, total, label_format) VALUES ($1, $2, $3, $4, $5) RETURNING id"
+const updateLabelBatchRefundSql = "UPDATE label_batches SET refunded = $1 WHERE id = $2"
+const addBatchLabelSql = "INSERT INTO labels(company_id, user_id, label, refund_link, tracking_pin, name, postal_code, country, service_code, label_format, group_id, batch_id, carrier_cost, price, street, city, province_code, weight, order_id, carrier, charge_id, carrier_billed) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22) RETURNING id"
+const getLabelBatchSql = "SELECT COALESCE(label_format, '') FROM label_batches WHERE id = $1 AND company_id = $2"
+
+const maxBatchItems = 500
+const defaultBatchConcurrency = 4
+
+const batchItemPending = "pending"
+const batchItemPurchased = "purchased"
+const batchItemFailed = "failed"
+
+// BuyLabelBatch /batches buys a label for every item, charging the company once for the batch total,
+// items that fail after the charge are refunded and the labels bought are merged into one document
+// request body has items, each item has the same fields as /buy/canadapost including options and optionally order_id
+// and carrier (defaults to canadapost), optionally label_format for every label in the batch
+func BuyLabelBatch (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+
+	var body response.LabelBatchRequest
+	err := json.NewDecoder(r.Body).Decode(&body)
+	defer r.Body.Close()
+	if err != nil {
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+	if len(body.Items) == 0 {
+		response.Error(w, "Body Parse Error, items Missing")
+		return
+	}
+	if len(body.Items) > maxBatchItems {
+		response.Error(w, "Batch Too Large, Max "+strconv.Itoa(maxBatchItems)+" Items")
+		return
+	}
+
+	labelFormat, err := resolveLabelFormat(tokenClaims.CompanyID, body.LabelFormat)
+	if err != nil {
+		response.Error(w, "Label Format Error")
+		return
+	}
+	account, err := getCanadaPostAccount(tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Get Shipper Error")
+		return
+	}
+	// a format canada post can not produce only fails the canada post items
+	canadaPostFormat, canadaPostFormatErr := carrierLabelFormat(labelFormat, account.labelFormats())
+	companyPrices, err := getCompanyPricing(tokenClaims.CompanyID, account)
+	if err != nil {
+		response.Error(w, "Get Pricing Error")
+		return
+	}
+
+	var source response.Shipper
+	var paymentAccount, email string
+	getShippingInfoQuery, err := database.DB.Prepare(getShippingInfoAndPaymentSql)
+	if err != nil {
+		response.Error(w, "Get Shipper Error")
+		return
+	}
+	defer getShippingInfoQuery.Close()
+	err = getShippingInfoQuery.QueryRow(tokenClaims.CompanyID).Scan(&source.Address.ShipperName, &source.Address.Street, &source.Address.City, &source.Address.ProvinceCode, &source.Address.Country, &source.Address.PostalCode, &source.Address.Phone, &paymentAccount, &email)
+	if err != nil {
+		response.Error(w, "Get Shipper Error")
+		return
+	}
+
+	items := make([]response.LabelBatchItem, len(body.Items))
+	amounts := make([]int64, len(body.Items))
+	costs := make([]int64, len(body.Items))
+	options := make([][]shippingOption, len(body.Items))
+	itemCarriers := make([]carriers.Carrier, len(body.Items))
+	carrierFormats := make([]string, len(body.Items))
+	sources := make([]response.Shipper, len(body.Items))
+	for i := range body.Items {
+		var err error
+		items[i] = response.LabelBatchItem{Index: i, OrderID: body.Items[i]["order_id"], Status: batchItemPending}
+		if err = fillParcelDetails(tokenClaims.CompanyID, body.Items[i]); err != nil {
+			failBatchItem(&items[i], "Get Product Error")
+			continue
+		}
+		if err = utils.CheckRequiredParams(body.Items[i], labelRequestFields); err != nil {
+			failBatchItem(&items[i], err.Error())
+			continue
+		}
+		sources[i] = source
+		if err = shipFrom(tokenClaims.CompanyID, body.Items[i], &sources[i].Address); err != nil {
+			failBatchItem(&items[i], err.Error())
+			continue
+		}
+		if name := body.Items[i]["carrier"]; name != "" && name != carriers.CanadaPost {
+			// items for other carriers have a carrier, canada post items leave it nil
+			if itemCarriers[i], err = getCarrier(name); err == nil {
+				if err = checkCarrierOptions(name, body.Items[i]); err == nil {
+					carrierFormats[i], err = carrierLabelFormat(labelFormat, itemCarriers[i].LabelFormats())
+				}
+			}
+			if err != nil {
+				failBatchItem(&items[i], err.Error())
+			}
+			continue
+		}
+		if canadaPostFormatErr != nil {
+			failBatchItem(&items[i], canadaPostFormatErr.Error())
+			continue
+		}
+		carrierFormats[i] = canadaPostFormat
+		options[i], err = resolveShippingOptions(tokenClaims.CompanyID, body.Items[i])
+		if err != nil {
+			failBatchItem(&items[i], err.Error())
+		}
+	}
+
+	dests := make([]response.PostageAddress, len(body.Items))
+	forEachLimited(len(body.Items), batchConcurrency(), func(i int) {
+		if items[i].Status == batchItemFailed {
+			return
+		}
+		var err error
+		dests[i], err = validateDestination(body.Items[i])
+		if _, ok := err.(*addressValidationError); ok {
+			failBatchItem(&items[i], err.Error())
+		} else if err != nil {
+			failBatchItem(&items[i], "Address Validation Unavailable")
+		}
+	})
+
+	forEachLimited(len(body.Items), batchConcurrency(), func(i int) {
+		if items[i].Status == batchItemFailed {
+			return
+		}
+		item := body.Items[i]
+		itemSource := sources[i]
+		itemSource.Parcels = []response.Parcel{parcelFromBody(item)}
+		var cost, amount int64
+		var err error
+		if itemCarriers[i] != nil {
+			cost, amount, err = quoteCarrierLabel(itemCarriers[i], companyPrices, carrierRateRequest(itemSource.Address, dests[i], item))
+		} else {
+			cost, amount, err = quoteCanadaPostLabel(account, companyPrices, itemSource, item["postal_code"], item["weight"], item["service_code"], options[i])
+		}
+		if err != nil {
+			failBatchItem(&items[i], "Get Rate Error")
+			return
+		}
+		costs[i] = cost
+		amounts[i] = amount
+	})
+
+	// canada post bills contract accounts the carrier cost of their canada post items, the rest is charged to the card
+	carrierBilled := func(i int) bool {
+		if itemCarriers[i] != nil {
+			return account.carrierBilled(itemCarriers[i].Name())
+		}
+		return account.carrierBilled(carriers.CanadaPost)
+	}
+	charges := func(i int) int64 {
+		return chargeAmount(carrierBilled(i), costs[i], amounts[i])
+	}
+	var total, chargeTotal int64
+	var purchasable bool
+	for i := range items {
+		if items[i].Status != batchItemFailed {
+			purchasable = true
+			total += amounts[i]
+			chargeTotal += charges(i)
+		}
+	}
+	if !purchasable {
+		response.JSON(w, http.StatusBadRequest, response.LabelBatch{Items: items})
+		return
+	}
+
+	var chargeID string
+	if chargeTotal > 0 {
+		if chargeID, err = chargeCompany(paymentAccount, chargeTotal, "Label Batch Purchase"); err != nil {
+			response.JSON(w, http.StatusConflict, response.BasicMessage{Message: "Payment Error"})
+			return
+		}
+	}
+
+	var batchID string
+	addBatchQuery, err := database.DB.Prepare(addLabelBatchSql)
+	if err == nil {
+		defer addBatchQuery.Close()
+		err = addBatchQuery.QueryRow(tokenClaims.CompanyID, tokenClaims.UserID, chargeID, float64(total)/100.0, labelFormat).Scan(&batchID)
+	}
+	if err != nil {
+		refundPostage(chargeID, 0)
+		response.Error(w, "Store Batch Error")
+		return
+	}
+
+	addLabelQuery, err := database.DB.Prepare(addBatchLabelSql)
+	if err != nil {
+		refundPostage(chargeID, 0)
+		response.Error(w, "Store Batch Error")
+		return
+	}
+	defer addLabelQuery.Close()
+
+	labels := make([][]byte, len(body.Items))
+	forEachLimited(len(body.Items), batchConcurrency(), func(i int) {
+		if items[i].Status == batchItemFailed {
+			return
+		}
+		item := body.Items[i]
+		itemSource := sources[i]
+		itemSource.Parcels = []response.Parcel{parcelFromBody(item)}
+		dest := dests[i]
+
+		carrierName, itemGroupID := carriers.CanadaPost, canadaPostGroupID(account, itemSource.Address)
+		var labelLink, refundLink, trackingPin string
+		var label []byte
+		if itemCarriers[i] != nil {
+			carrierName, itemGroupID = itemCarriers[i].Name(), ""
+			shipment, err := itemCarriers[i].Ship(carriers.ShipRequest{
+				RateRequest: carrierRateRequest(itemSource.Address, dest, item),
+				LabelFormat: carrierFormats[i],
+				Reference: item["order_id"],
+			})
+			if err != nil {
+				failBatchItem(&items[i], "Postage Error")
+				return
+			}
+			labelLink, trackingPin, label = shipment.ShipmentID, shipment.TrackingNumber, shipment.Label
+		} else {
+			shipment, link, refund, err := createCanadaPostShipment(account, itemSource, dest, item["weight"], item["service_code"], carrierFormats[i], itemGroupID, options[i])
+			if err != nil {
+				failBatchItem(&items[i], "Postage Error")
+				return
+			}
+			labelLink, refundLink, trackingPin = link, refund, shipment.Tracking
+		}
+		var itemChargeID string
+		if charges(i) > 0 {
+			itemChargeID = chargeID
+		}
+		var labelID string
+		err := addLabelQuery.QueryRow(tokenClaims.CompanyID, tokenClaims.UserID, labelLink, refundLink, trackingPin,
+			dest.ShipperName, dest.PostalCode, dest.Country, item["service_code"], labelFormat, itemGroupID, batchID, float64(costs[i])/100.0, float64(amounts[i])/100.0,
+			dest.Street, dest.City, dest.ProvinceCode, item["weight"], item["order_id"], carrierName, itemChargeID, carrierBilled(i)).Scan(&labelID)
+		if err != nil {
+			// the shipment is bought but not recorded, cancel it so it is not left unbilled
+			if itemCarriers[i] != nil {
+				err = itemCarriers[i].Void(labelLink)
+			} else {
+				_, err = voidCanadaPostLabel(tokenClaims.CompanyID, refundLink, account.isContract())
+			}
+			if err != nil {
+				log.Printf("Batch %s Void Unrecorded Label %s Error: %s", batchID, trackingPin, err.Error())
+			}
+			failBatchItem(&items[i], "Store Postage Error")
+			return
+		}
+		items[i].Status = batchItemPurchased
+		items[i].LabelID = labelID
+		items[i].TrackingNumber = trackingPin
+		items[i].Total = float64(amounts[i])/100.0
+
+		if label == nil {
+			label, err = getCanadaPostDocument(labelLink, labelFormats[carrierFormats[i]].ContentType)
+		}
+		if err == nil {
+			label, err = convertLabel(label, carrierFormats[i], labelFormat)
+		}
+		if err != nil {
+			items[i].Error = "Get Label Error"
+			return
+		}
+		if err = storeLabelDocument(tokenClaims.CompanyID, labelID, storage.KindLabel, labelFormats[labelFormat].ContentType, label); err != nil {
+			log.Printf("Store Label Error: %s", err.Error())
+		}
+		labels[i] = label
+	})
+
+	batch := response.LabelBatch{
+		ID: batchID,
+		Total: float64(total)/100.0,
+		Items: items,
+	}
+
+	var refunded int64
+	for i := range items {
+		if items[i].Status == batchItemFailed {
+			refunded += charges(i)
+		}
+	}
+	if refunded > 0 && chargeID != "" {
+		if err = refundPostage(chargeID, refunded); err == nil {
+			batch.Refunded = float64(refunded)/100.0
+			_, _ = database.DB.Exec(updateLabelBatchRefundSql, batch.Refunded, batchID)
+		}
+	}
+
+	var docs [][]byte
+	for i := range labels {
+		if labels[i] != nil {
+			docs = append(docs, labels[i])
+		}
+	}
+	if len(docs) > 0 {
+		merged, err := mergeLabels(docs, labelFormat)
+		if err == nil {
+			err = storage.Store.Put(storage.BatchKey(batchID), merged, labelFormats[labelFormat].ContentType)
+		}
+		if err != nil {
+			log.Printf("Batch %s Merge Error: %s", batchID, err.Error())
+		} else {
+			batch.PdfUrl = "/postage/batches/" + batchID + "/pdf"
+		}
+	}
+
+	response.JSON(w, http.StatusAccepted, batch)
+}
+
+// GetLabelBatchPDF /batches/{batchID}/pdf returns the merged document of every label bought in the batch
+// request url has batchID
+func GetLabelBatchPDF (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	batchID := chi.URLParam(r, "batchID")
+
+	getBatchQuery, err := database.DB.Prepare(getLabelBatchSql)
+	if err != nil {
+		response.Error(w, "Get Batch Error")
+		return
+	}
+	defer getBatchQuery.Close()
+	var labelFormat string
+	if err = getBatchQuery.QueryRow(batchID, tokenClaims.CompanyID).Scan(&labelFormat); err != nil {
+		response.JSON(w, http.StatusNotFound, response.BasicMessage{Message: "Batch Not Found"})
+		return
+	}
+
+	merged, err := storage.Store.Get(storage.BatchKey(batchID))
+	if err == storage.ErrNotFound {
+		response.JSON(w, http.StatusNotFound, response.BasicMessage{Message: "Batch PDF Not Found"})
+		return
+	} else if err != nil {
+		response.Error(w, "Get Batch Error")
+		return
+	}
+
+	if labelFormat == "" {
+		labelFormat = labelFormatPDFLetter
+	}
+	w.Header().Set("Content-Type", labelFormats[labelFormat].ContentType)
+	w.Header().Set("Content-Disposition", "inline; filename=\"batch-"+batchID+labelFormats[labelFormat].Extension+"\"")
+	w.WriteHeader(http.StatusOK)
+	w.Write(merged)
+}
+
+// mergeLabels util function that combines labels into one document, pdfs are merged page by page and
+// zpl labels are concatenated since printers read them as a stream of label formats
+func mergeLabels (labels [][]byte, labelFormat string) ([]byte, error) {
+	if labelFormats[labelFormat].Encoding == "ZPL" {
+		return bytes.Join(labels, []byte("\n")), nil
+	}
+	return pdf.Merge(labels)
+}
+
+// failBatchItem util function that marks a batch item as failed
+func failBatchItem (item *response.LabelBatchItem, reason string) {
+	item.Status = batchItemFailed
+	item.Error = reason
+}
+
+// batchConcurrency util function that returns how many labels of a batch are bought at once, BATCH_CONCURRENCY
+func batchConcurrency () int {
+	if n, err := strconv.Atoi(os.Getenv("BATCH_CONCURRENCY")); err == nil && n > 0 {
+		return n
+	}
+	return defaultBatchConcurrency
+}
+
+// forEachLimited util function that calls f for 0..n-1 with at most limit calls running at once
+func forEachLimited (n, limit int, f func(i int)) {
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			f(i)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,467 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/xml"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"go.fromyama/utils/carriers"
+	"go.fromyama/utils/carriers/fedex"
+	"go.fromyama/utils/carriers/purolator"
+	"go.fromyama/utils/carriers/ups"
+	"go.fromyama/utils/database"
+	"go.fromyama/utils/jwtUtil"
+	"go.fromyama/utils/pricing"
+	"go.fromyama/utils/response"
+	"go.fromyama/utils/storage"
+	"go.fromyama/utils/tracking"
+)
+
+const addCarrierLabelSql = "INSERT INTO labels(company_id, user_id, carrier, label, tracking_pin, name, postal_code, country, service_code, label_format, carrier_cost, price, street, city, province_code, weight, charge_id, order_id, carrier_billed) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19) RETURNING id"
+const getVoidLabelSql = "SELECT COALESCE(carrier, 'canadapost'), label, COALESCE(refund_link, ''), COALESCE(charge_id, ''), COALESCE(carrier_cost, 0), COALESCE(price, 0), COALESCE(carrier_billed, false), COALESCE(is_return, false), COALESCE(tracking_status, ''), transmitted_at IS NOT NULL, voided_at IS NOT NULL FROM labels WHERE id = $1 AND company_id = $2"
+const voidLabelSql = "UPDATE labels SET voided_at = now() WHERE id = $1 AND company_id = $2 AND voided_at IS NULL"
+const unvoidLabelSql = "UPDATE labels SET voided_at = NULL WHERE id = $1"
+const setLabelRefundTicketSql = "UPDATE labels SET refund_ticket_id = $1 WHERE id = $2"
+const getCompanyEmailSql = "SELECT u.email FROM companies c INNER JOIN users u on c.head_id = u.id WHERE c.id = $1"
+
+// ConnectToCarriers registers the carriers other than canada post that have credentials configured
+func ConnectToCarriers () {
+	if client := purolator.FromEnv(); client != nil {
+		carriers.Register(client)
+	}
+	if client := ups.FromEnv(); client != nil {
+		carriers.Register(client)
+	}
+	if client := fedex.FromEnv(); client != nil {
+		carriers.Register(client)
+	}
+}
+
+// BuyCarrierLabel /buy/{carrier} returns the label just purchased from a carrier other than canada post
+// request url has carrier (purolator, ups, fedex)
+// request body has the same fields as /buy/canadapost except options, optionally order_id printed as the reference,
+// residential (true for a home address, a business address when left out) and the contents, value, hs_code and
+// origin_country declared to customs outside canada, the catalog product of sku fills the customs fields left out
+func BuyCarrierLabel (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+
+	carrier, err := getCarrier(chi.URLParam(r, "carrier"))
+	if err != nil {
+		response.JSON(w, http.StatusNotFound, response.BasicMessage{Message: err.Error()})
+		return
+	}
+
+	body, err := parseParcelRequestBody(r, tokenClaims.CompanyID, labelRequestFields)
+	if err != nil{
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+	body["carrier"] = carrier.Name()
+	if err = checkCarrierOptions(carrier.Name(), body); err != nil {
+		response.Error(w, err.Error())
+		return
+	}
+
+	dest, err := validateDestination(body)
+	if validationErr, ok := err.(*addressValidationError); ok {
+		response.JSON(w, http.StatusBadRequest, validationErr.Result)
+		return
+	} else if err != nil {
+		response.Error(w, "Address Validation Unavailable")
+		return
+	}
+
+	var source response.Shipper
+	var paymentAccount, email string
+	getShippingInfoQuery, err := database.DB.Prepare(getShippingInfoAndPaymentSql)
+	if err != nil {
+		response.Error(w, "Get Shipper Error")
+		return
+	}
+	defer getShippingInfoQuery.Close()
+	err = getShippingInfoQuery.QueryRow(tokenClaims.CompanyID).Scan(&source.Address.ShipperName, &source.Address.Street, &source.Address.City, &source.Address.ProvinceCode, &source.Address.Country, &source.Address.PostalCode, &source.Address.Phone, &paymentAccount, &email)
+	if err != nil {
+		response.Error(w, "Get Shipper Error")
+		return
+	}
+	if err = shipFrom(tokenClaims.CompanyID, body, &source.Address); err != nil {
+		response.Error(w, "Get Shipper Error, " + err.Error())
+		return
+	}
+
+	labelFormat, err := resolveLabelFormat(tokenClaims.CompanyID, body["label_format"])
+	if err != nil {
+		response.Error(w, "Label Format Error")
+		return
+	}
+	carrierFormat, err := carrierLabelFormat(labelFormat, carrier.LabelFormats())
+	if err != nil {
+		response.Error(w, err.Error())
+		return
+	}
+
+	account, err := getCanadaPostAccount(tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Get Shipper Error")
+		return
+	}
+	companyPrices, err := getCompanyPricing(tokenClaims.CompanyID, account)
+	if err != nil {
+		response.Error(w, "Get Pricing Error")
+		return
+	}
+	rateRequest := carrierRateRequest(source.Address, dest, body)
+	cost, price, err := quoteCarrierLabel(carrier, companyPrices, rateRequest)
+	if err != nil {
+		response.Error(w, "Get Rate Error")
+		return
+	}
+
+	carrierBilled := account.carrierBilled(carrier.Name())
+	chargeID, err := chargeCompany(paymentAccount, chargeAmount(carrierBilled, cost, price), "Label Purchase")
+	if err != nil {
+		response.JSON(w, http.StatusConflict, response.BasicMessage{Message: "Payment Error"})
+		return
+	}
+
+	shipment, err := carrier.Ship(carriers.ShipRequest{RateRequest: rateRequest, LabelFormat: carrierFormat, Reference: body["order_id"]})
+	if err != nil {
+		refundPostage(chargeID, 0)
+		response.Error(w, "Postage Error")
+		return
+	}
+
+	var labelID string
+	addLabelQuery, err := database.DB.Prepare(addCarrierLabelSql)
+	if err == nil {
+		defer addLabelQuery.Close()
+		err = addLabelQuery.QueryRow(tokenClaims.CompanyID, tokenClaims.UserID, carrier.Name(), shipment.ShipmentID, shipment.TrackingNumber,
+			dest.ShipperName, dest.PostalCode, dest.Country, body["service_code"], labelFormat, float64(cost)/100.0, float64(price)/100.0,
+			dest.Street, dest.City, dest.ProvinceCode, body["weight"], chargeID, body["order_id"], carrierBilled).Scan(&labelID)
+	}
+	if err != nil {
+		_ = carrier.Void(shipment.ShipmentID)
+		refundPostage(chargeID, 0)
+		response.Error(w, "Store Postage Error")
+		return
+	}
+
+	label, err := convertLabel(shipment.Label, carrierFormat, labelFormat)
+	if err != nil {
+		response.Error(w, "Get Label Error")
+		return
+	}
+	if err = storeLabelDocument(tokenClaims.CompanyID, labelID, storage.KindLabel, labelFormats[labelFormat].ContentType, label); err != nil {
+		log.Printf("Store Label Error: %s", err.Error())
+	}
+
+	receipt := response.CanadaPostLabelPurchase{
+		PostalCode: dest.PostalCode,
+		Total: float64(price)/100.0,
+		TrackingNumber: shipment.TrackingNumber,
+	}
+	var tmplBuffer bytes.Buffer
+	tmpl := template.Must(template.ParseFiles("assets/templates/labelPurchase.html"))
+	_ = tmpl.Execute(&tmplBuffer, receipt)
+	var attachment []byte
+	if labelFormats[labelFormat].Encoding == "PDF" {
+		attachment = label
+	}
+	if !emailVerified(email) {
+		log.Printf("Receipt For Label %s Not Sent, Email Not Verified", labelID)
+	} else if err = SendEmail(email, "Shipping Label Purchased", tmplBuffer.String(), attachment); err != nil {
+		log.Printf("Send Receipt Error For Label %s: %s", labelID, err.Error())
+	}
+
+	w.Header().Set("Content-Type", labelFormats[labelFormat].ContentType)
+	w.Header().Set("X-Label-ID", labelID)
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(label)
+}
+
+// GetCarrierRates /rates/{carrier} returns the rates of every service of a carrier other than canada post with
+// the customer price, surcharges and the dimensional and billable weight
+// request url has carrier (purolator, ups, fedex)
+// request body has postal_code, weight, length, width, height, optionally street, city, province_code, country_code,
+// residential, contents, value, hs_code, origin_country and sku, the fields left out are filled as for /buy/canadapost,
+// location_id or shopify_location_id
+func GetCarrierRates (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+
+	carrier, err := getCarrier(chi.URLParam(r, "carrier"))
+	if err != nil {
+		response.JSON(w, http.StatusNotFound, response.BasicMessage{Message: err.Error()})
+		return
+	}
+
+	body, err := parseParcelRequestBody(r, tokenClaims.CompanyID, []string{"postal_code", "weight", "length", "width", "height"})
+	if err != nil{
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+	dest := postageAddressFromBody(body)
+	if dest.Country == "" {
+		dest.Country = "CA"
+	}
+
+	var source response.Shipper
+	getShippingInfoQuery, err := database.DB.Prepare(getShippingInfoSql)
+	if err != nil {
+		response.Error(w, "Get Shipper Error")
+		return
+	}
+	defer getShippingInfoQuery.Close()
+	err = getShippingInfoQuery.QueryRow(tokenClaims.CompanyID).Scan(&source.Address.ShipperName, &source.Address.Street, &source.Address.City, &source.Address.ProvinceCode, &source.Address.Country, &source.Address.PostalCode, &source.Address.Phone)
+	if err != nil {
+		response.Error(w, "Get Shipper Error")
+		return
+	}
+	if err = shipFrom(tokenClaims.CompanyID, body, &source.Address); err != nil {
+		response.Error(w, "Get Shipper Error, " + err.Error())
+		return
+	}
+
+	account, err := getCanadaPostAccount(tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Get Shipper Error")
+		return
+	}
+	companyPrices, err := getCompanyPricing(tokenClaims.CompanyID, account)
+	if err != nil {
+		response.Error(w, "Get Pricing Error")
+		return
+	}
+
+	rates, err := carrier.Rates(carrierRateRequest(source.Address, dest, body))
+	if err != nil {
+		response.Error(w, "Get Rate Error, " + err.Error())
+		return
+	}
+	rateJSON := []response.CarrierRate{}
+	for _, rate := range rates {
+		rateJSON = append(rateJSON, carrierRateToJSON(rate, companyPrices.price(carrier.Name(), rate.ServiceCode, rate.Total)))
+	}
+	response.JSON(w, http.StatusOK, rateJSON)
+}
+
+// VoidLabel /labels/{labelID}/void cancels a label that has not been used and refunds what the company paid for it,
+// canada post contract labels can only be voided until they are transmitted, return labels until they are mailed,
+// canada post non-contract labels are refund requests whose service ticket is stored with the label
+// request url has labelID
+func VoidLabel (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	labelID := chi.URLParam(r, "labelID")
+
+	var carrierName, labelLink, refundLink, chargeID, trackingStatus string
+	var cost, price float64
+	var carrierBilled, isReturn, transmitted, voided bool
+	getLabelQuery, err := database.DB.Prepare(getVoidLabelSql)
+	if err != nil {
+		response.Error(w, "Get Label Error")
+		return
+	}
+	defer getLabelQuery.Close()
+	err = getLabelQuery.QueryRow(labelID, tokenClaims.CompanyID).Scan(&carrierName, &labelLink, &refundLink, &chargeID, &cost, &price, &carrierBilled, &isReturn, &trackingStatus, &transmitted, &voided)
+	if err != nil {
+		response.JSON(w, http.StatusNotFound, response.BasicMessage{Message: "Label Not Found"})
+		return
+	}
+	if voided {
+		response.JSON(w, http.StatusConflict, response.BasicMessage{Message: "Label Already Voided"})
+		return
+	}
+
+	if carrierName == carriers.CanadaPost {
+		if transmitted {
+			response.JSON(w, http.StatusConflict, response.BasicMessage{Message: "Label Already Transmitted"})
+			return
+		}
+		if isReturn && trackingStatus != "" && trackingStatus != tracking.StatusUnknown {
+			response.JSON(w, http.StatusConflict, response.BasicMessage{Message: "Return Label Already Mailed"})
+			return
+		}
+	}
+
+	// the label is marked voided before anything is cancelled or refunded so a retried or concurrent void stops here
+	res, err := database.DB.Exec(voidLabelSql, labelID, tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Void Label Error")
+		return
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		response.JSON(w, http.StatusConflict, response.BasicMessage{Message: "Label Already Voided"})
+		return
+	}
+
+	var refundTicket string
+	if carrierName == carriers.CanadaPost {
+		// canada post bills an authorized return when it is mailed, an unused one has nothing to cancel
+		if !isReturn || refundLink != "" {
+			refundTicket, err = voidCanadaPostLabel(tokenClaims.CompanyID, refundLink, carrierBilled)
+		}
+	} else {
+		var carrier carriers.Carrier
+		if carrier, err = getCarrier(carrierName); err == nil {
+			err = carrier.Void(labelLink)
+		}
+	}
+	if err != nil {
+		database.DB.Exec(unvoidLabelSql, labelID)
+		response.Error(w, "Void Label Error, " + err.Error())
+		return
+	}
+
+	result := response.VoidedLabel{LabelID: labelID, RefundTicketID: refundTicket}
+	if refundTicket != "" {
+		// canada post has no api to follow a non-contract refund request, the card is refunded now and the ticket is
+		// kept to reconcile what canada post credits against it
+		if _, err = database.DB.Exec(setLabelRefundTicketSql, refundTicket, labelID); err != nil {
+			log.Printf("Store Refund Ticket %s Of Label %s Error: %s", refundTicket, labelID, err.Error())
+		}
+	}
+	refund := chargeAmount(carrierBilled, pricing.Cents(cost), pricing.Cents(price))
+	if chargeID != "" && refund > 0 {
+		if err = refundPostage(chargeID, refund); err == nil {
+			result.Refunded = float64(refund)/100.0
+		} else {
+			log.Printf("Refund Voided Label %s Error: %s", labelID, err.Error())
+		}
+	}
+	response.JSON(w, http.StatusAccepted, result)
+}
+
+// voidCanadaPostLabel util function that voids a canada post shipment by its refund link, contract shipments are
+// deleted and non-contract shipments get a refund request whose service ticket id is returned
+func voidCanadaPostLabel (companyID, refundLink string, contract bool) (string, error) {
+	if refundLink == "" {
+		return "", &postageError{"Label Can Not Be Voided"}
+	}
+	if contract {
+		return "", canadaPostDelete(refundLink, "application/vnd.cpc.shipment-v8+xml")
+	}
+
+	var email string
+	if err := database.DB.QueryRow(getCompanyEmailSql, companyID).Scan(&email); err != nil {
+		return "", err
+	}
+	xmlBody := `<?xml version="1.0" encoding="utf-8"?>`
+	xmlBody += `<non-contract-shipment-refund-request xmlns="http://www.canadapost.ca/ws/ncshipment-v4">`
+	xmlBody += `<email>`+email+`</email>`
+	xmlBody += `</non-contract-shipment-refund-request>`
+	var refundInfo struct {
+		XMLName  xml.Name `xml:"non-contract-shipment-refund-request-info"`
+		TicketID string   `xml:"service-ticket-id"`
+	}
+	err := canadaPostRequest("POST", refundLink, "application/vnd.cpc.ncshipment-v4+xml", "application/vnd.cpc.ncshipment-v4+xml", xmlBody, &refundInfo)
+	if err != nil {
+		return "", err
+	}
+	if refundInfo.TicketID == "" {
+		return "", &postageError{"Canada Post Refused The Refund"}
+	}
+	return refundInfo.TicketID, nil
+}
+
+// getCarrier util function that returns a registered carrier other than canada post
+func getCarrier (name string) (carriers.Carrier, error) {
+	carrier, ok := carriers.Get(name)
+	if !ok {
+		return nil, &postageError{"Unknown Carrier " + name}
+	}
+	return carrier, nil
+}
+
+// checkCarrierOptions util function that rejects shipping options for carriers other than canada post, the options
+// and the company defaults are canada post option codes
+func checkCarrierOptions (carrierName string, body map[string]string) error {
+	if carrierName != carriers.CanadaPost && body["options"] != "" {
+		return &postageError{"Shipping Options Not Supported By " + carrierName}
+	}
+	return nil
+}
+
+// carrierRateRequest util function that builds the carrier request for the parcel in body from the company address
+// to dest, the destination is a business address unless body has residential true, carriers add a residential
+// surcharge to the rest
+func carrierRateRequest (source, dest response.PostageAddress, body map[string]string) carriers.RateRequest {
+	from := carrierAddress(source)
+	from.Company = from.Name
+	to := carrierAddress(dest)
+	to.Residential = body["residential"] == "true"
+	parcel := parcelFromBody(body)
+	value, _ := strconv.ParseFloat(body["value"], 64)
+	return carriers.RateRequest{
+		From: from,
+		To: to,
+		Parcel: carriers.Parcel{Length: parcel.Length, Width: parcel.Width, Height: parcel.Height, Weight: parcel.Weight},
+		ServiceCode: body["service_code"],
+		Contents: body["contents"],
+		Value: pricing.Cents(value),
+		HSCode: body["hs_code"],
+		OriginCountry: strings.ToUpper(body["origin_country"]),
+	}
+}
+
+// carrierAddress util function that converts a postage address for the carriers package, an address with a contact
+// is addressed to the contact at the shipper
+func carrierAddress (a response.PostageAddress) carriers.Address {
+	var phone string
+	if a.Phone != 0 {
+		phone = strconv.Itoa(a.Phone)
+	}
+	address := carriers.Address{
+		Name: a.ShipperName,
+		Street: a.Street,
+		City: a.City,
+		Province: a.ProvinceCode,
+		Country: a.Country,
+		PostalCode: a.PostalCode,
+		Phone: phone,
+	}
+	if a.ContactName != "" {
+		address.Name, address.Company = a.ContactName, a.ShipperName
+	}
+	return address
+}
+
+// quoteCarrierLabel util function that returns the carrier cost and the customer price in cents of the service in req
+func quoteCarrierLabel (carrier carriers.Carrier, companyPrices companyPricing, req carriers.RateRequest) (int64, int64, error) {
+	rates, err := carrier.Rates(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, rate := range rates {
+		if rate.ServiceCode == req.ServiceCode {
+			return rate.Total, companyPrices.price(carrier.Name(), rate.ServiceCode, rate.Total), nil
+		}
+	}
+	return 0, 0, &postageError{"No Rate For Service " + req.ServiceCode}
+}
+
+// carrierRateToJSON util function that converts a carrier rate with its customer price in cents to json
+func carrierRateToJSON (rate carriers.Rate, price int64) response.CarrierRate {
+	surcharges := []response.CarrierSurcharge{}
+	for _, s := range rate.Surcharges {
+		surcharges = append(surcharges, response.CarrierSurcharge{Code: s.Code, Name: s.Name, Amount: float64(s.Amount)/100.0})
+	}
+	return response.CarrierRate{
+		Carrier: rate.Carrier,
+		ServiceCode: rate.ServiceCode,
+		ServiceName: rate.ServiceName,
+		Base: float64(rate.Base)/100.0,
+		Surcharges: surcharges,
+		Taxes: float64(rate.Taxes)/100.0,
+		Price: float64(price)/100.0,
+		BillableWeight: rate.BillableWeight,
+		DimensionalWeight: rate.DimensionalWeight,
+		Residential: rate.Residential,
+		TransitDays: rate.TransitDays,
+		ExpectedDelivery: rate.ExpectedDelivery,
+	}
+}
@@ -14,18 +14,19 @@ import (
 	"go.fromyama/utils/database"
 	"go.fromyama/utils/jwtUtil"
 	"go.fromyama/utils/response"
+	"go.fromyama/utils/roles"
 )
 
-const getAllEmployeesSql = "SELECT email, name, is_approved, id FROM employees INNER JOIN users u on employees.user_id = u.id WHERE u.company_id =  $1"
+const getAllEmployeesSql = "SELECT email, name, is_approved, id, " + userRoleSql + " FROM employees INNER JOIN users u on employees.user_id = u.id WHERE u.company_id =  $1 AND u.removed_at IS NULL"
 const registerCompanySql = "INSERT INTO companies (company_name, street, city, province_code, country, postal_code, phone) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id"
 const setCompanyHeadSql = "UPDATE companies SET head_id = $1 WHERE id = $2"
-const approveEmployeeSql = "UPDATE users SET is_approved = true WHERE id = $1"
+const approveEmployeeSql = "UPDATE users SET is_approved = true WHERE id = $1 AND company_id = $2"
 const isEmployeeApprovedSql = "SELECT is_approved, company_id FROM users WHERE id = $1"
 const getCompanyDetailSql = "SELECT company_name, head_id, total_due, street, city, province_code, country, postal_code, phone FROM companies WHERE id = $1"
 const addPaymentMethodSql = "UPDATE companies SET payment_account_id = $1 WHERE id = $2"
 const getPaymentMethodSql = "SELECT payment_account_id FROM companies WHERE id = $1"
-const addParcelSql = "INSERT INTO parcel_options (company_id, length, width, height, name, weight) VALUES ($1, $2, $3, $4, $5, $6)"
-const getParcelSql = "SELECT id, name, length, width, height, weight FROM parcel_options WHERE company_id = $1"
+const addParcelSql = "INSERT INTO parcel_options (company_id, length, width, height, name, weight, empty_weight) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id"
+const getParcelSql = "SELECT id, name, length, width, height, weight, COALESCE(empty_weight, 0), COALESCE(is_default, false) FROM parcel_options WHERE company_id = $1 ORDER BY is_default DESC NULLS LAST, name, id"
 const getShippingInfoSql = "SELECT company_name, street, city, province_code, country, postal_code, phone FROM companies where id = $1"
 const isEmployeeHeadSql = "SELECT is_head FROM users WHERE id = $1"
 const unregisterCompanySql = "DELETE FROM companies WHERE id = $1"
@@ -80,7 +81,7 @@ func GetAllEmployeeDetails (w http.ResponseWriter, r *http.Request){
 	var allEmployees []response.Employee
 	for rows.Next(){
 		var e response.Employee
-		err = rows.Scan(&e.Email, &e.Name, &e.Approved, &e.ID)
+		err = rows.Scan(&e.Email, &e.Name, &e.Approved, &e.ID, &e.Role)
 		allEmployees = append(allEmployees, e)
 	}
 
@@ -98,7 +99,7 @@ func RegisterCompany (w http.ResponseWriter, r *http.Request){
 		return
 	}
 
-	takenQuery, err := database.DB.Prepare("SELECT exists(SELECT 1 from users where email=$1)")
+	takenQuery, err := database.DB.Prepare("SELECT exists(SELECT 1 from users where lower(email) = lower($1) AND removed_at IS NULL)")
 	defer takenQuery.Close()
 	if err != nil {
 		response.Error(w, "Check Existing Email Error")
@@ -116,7 +117,7 @@ func RegisterCompany (w http.ResponseWriter, r *http.Request){
 		var companyID string
 		err = registerCompanyQuery.QueryRow(body["company_name"], body["street"], body["city"], body["province_code"], body["country"], body["postal_code"], body["phone"]).Scan(&companyID)
 
-		userID, token, err := SignUpUserAndGenerateToken(w, true, true, body["name"], body["email"], body["password"], companyID)
+		userID, token, err := SignUpUserAndGenerateToken(w, r, true, true, false, roles.Owner, body["name"], body["email"], body["password"], companyID)
 
 		setHeadQuery, err := database.DB.Prepare(setCompanyHeadSql)
 		defer setHeadQuery.Close()
@@ -132,18 +133,33 @@ func RegisterCompany (w http.ResponseWriter, r *http.Request){
 	response.JSON(w, http.StatusAlreadyReported, response.BasicMessage{Message: "Email Already In Use"})
 }
 
-// ApproveEmployee /employee/approve/{employeeID} approves employee
+// ApproveEmployee /employee/approve/{employeeID} approves employee of the company
 // request url has employeeID
 func ApproveEmployee (w http.ResponseWriter, r *http.Request){
-	employeeID := chi.URLParam(r, "employeeID")
-	approveEmployeeQuery, err := database.DB.Prepare(approveEmployeeSql)
-	defer approveEmployeeQuery.Close()
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	m, ok := companyMember(w, tokenClaims, chi.URLParam(r, "employeeID"))
+	if !ok {
+		return
+	}
+	if m.Approved {
+		response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Employee Approved"})
+		return
+	}
+	tx, err := database.DB.Begin()
 	if err != nil {
 		response.Error(w, "Approve Employee Error")
 		return
 	}
-	_, err = approveEmployeeQuery.Exec(employeeID)
-	if err != nil {
+	defer tx.Rollback()
+	if _, err = tx.Exec(approveEmployeeSql, m.ID, tokenClaims.CompanyID); err != nil {
+		response.Error(w, "Approve Employee Error")
+		return
+	}
+	if err = auditMemberAction(tx, tokenClaims, m.ID, auditApprove, ""); err != nil {
+		response.Error(w, "Approve Employee Error")
+		return
+	}
+	if err = tx.Commit(); err != nil {
 		response.Error(w, "Approve Employee Error")
 		return
 	}
@@ -276,7 +292,8 @@ func ChargePaymentAccount (w http.ResponseWriter, r *http.Request){
 }
 
 // AddParcel /add/parcel adds parcel option to company parcels
-// request body has length, width, height, name
+// request body has length, width, height, name, weight, optionally empty_weight of the box itself and default
+// (true to use it when a rate or label request has no dimensions)
 func AddParcel (w http.ResponseWriter, r *http.Request){
 	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
 	var body map[string]string
@@ -285,19 +302,29 @@ func AddParcel (w http.ResponseWriter, r *http.Request){
 		response.Error(w, "Body Parse Error, " + err.Error())
 		return
 	}
-	addParcelQuery, err := database.DB.Prepare(addParcelSql)
-	defer addParcelQuery.Close()
-	_, err = addParcelQuery.Exec(tokenClaims.CompanyID, body["length"], body["width"], body["height"], body["name"], body["weight"])
+	parcel, err := parcelOptionFromBody(body)
+	if err != nil {
+		response.Error(w, err.Error())
+		return
+	}
+	var parcelID string
+	err = database.DB.QueryRow(addParcelSql, tokenClaims.CompanyID, parcel.Length, parcel.Width, parcel.Height, parcel.Name, parcel.Weight, parcel.EmptyWeight).Scan(&parcelID)
 	if err != nil {
 		response.Error(w, "Add Parcel Error")
 		return
 	}
+	if body["default"] == "true" {
+		if err = setDefaultParcel(tokenClaims.CompanyID, parcelID); err != nil {
+			response.Error(w, "Add Parcel Error")
+			return
+		}
+	}
 	response.JSON(w, http.StatusCreated, response.BasicMessage{
 		Message: "Parcel Added",
 	})
 }
 
-// GetShipper /shipper returns the seller address and parcel options
+// GetShipper /shipper returns the seller address and parcel options, the default parcel first and the rest by name
 func GetShipper (w http.ResponseWriter, r *http.Request){
 	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
 
@@ -311,7 +338,7 @@ func GetShipper (w http.ResponseWriter, r *http.Request){
 	var allParcel []response.Parcel
 	for rows.Next(){
 		var p response.Parcel
-		err = rows.Scan(&p.ID, &p.Name, &p.Length, &p.Width, &p.Height, &p.Weight)
+		err = rows.Scan(&p.ID, &p.Name, &p.Length, &p.Width, &p.Height, &p.Weight, &p.EmptyWeight, &p.Default)
 		allParcel = append(allParcel, p)
 	}
 
@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"go.fromyama/utils/database"
+	"go.fromyama/utils/jwtUtil"
+	"go.fromyama/utils/response"
+	"go.fromyama/utils/storage"
+)
+
+const addDocumentSql = "INSERT INTO documents(company_id, label_id, kind, blob_key, content_type, sha256, size, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT (label_id, kind) DO UPDATE SET blob_key = $4, content_type = $5, sha256 = $6, size = $7, expires_at = $8, created_at = now()"
+const getDocumentSql = "SELECT blob_key, COALESCE(content_type, 'application/pdf'), sha256 FROM documents WHERE label_id = $1 AND company_id = $2 AND kind = $3"
+const getLabelDocumentsSql = "SELECT d.kind, COALESCE(d.content_type, 'application/pdf'), d.sha256, d.size, d.created_at, d.expires_at FROM documents d INNER JOIN labels l on l.id = d.label_id WHERE d.label_id = $1 AND l.company_id = $2"
+const getExpiredDocumentsSql = "SELECT id, blob_key FROM documents WHERE expires_at IS NOT NULL AND expires_at < now()"
+const deleteDocumentSql = "DELETE FROM documents WHERE id = $1"
+
+// GetLabelDocuments /labels/{labelID}/documents returns the documents stored for a label
+// request url has labelID
+func GetLabelDocuments (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	labelID := chi.URLParam(r, "labelID")
+
+	getDocumentsQuery, err := database.DB.Prepare(getLabelDocumentsSql)
+	if err != nil {
+		response.Error(w, "Get Documents Error")
+		return
+	}
+	defer getDocumentsQuery.Close()
+	rows, err := getDocumentsQuery.Query(labelID, tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Get Documents Error")
+		return
+	}
+	defer rows.Close()
+
+	documents := []response.Document{}
+	for rows.Next() {
+		var d response.Document
+		var createdAt time.Time
+		var expiresAt *time.Time
+		if err = rows.Scan(&d.Kind, &d.ContentType, &d.Sha256, &d.Size, &createdAt, &expiresAt); err != nil {
+			response.Error(w, "Get Documents Error")
+			return
+		}
+		d.CreatedAt = createdAt.Format(time.RFC3339)
+		if expiresAt != nil {
+			d.ExpiresAt = expiresAt.Format(time.RFC3339)
+		}
+		documents = append(documents, d)
+	}
+	response.JSON(w, http.StatusOK, documents)
+}
+
+// GetLabelDocument /labels/{labelID}/documents/{kind} returns a stored document
+// request url has labelID, kind (label, packing_slip)
+func GetLabelDocument (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	labelID := chi.URLParam(r, "labelID")
+	kind := chi.URLParam(r, "kind")
+
+	data, contentType, err := getLabelDocument(tokenClaims.CompanyID, labelID, kind)
+	if err == storage.ErrNotFound {
+		response.JSON(w, http.StatusNotFound, response.BasicMessage{Message: "Document Not Found"})
+		return
+	} else if err != nil {
+		response.Error(w, "Get Document Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", "inline; filename=\""+kind+"-"+labelID+storage.Extension(contentType)+"\"")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// storeLabelDocument util function that saves a document for a label in the blob store and records its hash,
+// documents expire after BLOB_RETENTION_DAYS if it is set
+func storeLabelDocument (companyID, labelID, kind, contentType string, data []byte) error {
+	key := storage.DocumentKey(labelID, kind, contentType)
+	if err := storage.Store.Put(key, data, contentType); err != nil {
+		return err
+	}
+
+	var expiresAt *time.Time
+	if days, err := strconv.Atoi(os.Getenv("BLOB_RETENTION_DAYS")); err == nil && days > 0 {
+		t := time.Now().AddDate(0, 0, days)
+		expiresAt = &t
+	}
+
+	addDocumentQuery, err := database.DB.Prepare(addDocumentSql)
+	if err != nil {
+		return err
+	}
+	defer addDocumentQuery.Close()
+	_, err = addDocumentQuery.Exec(companyID, labelID, kind, key, contentType, storage.Hash(data), len(data), expiresAt)
+	return err
+}
+
+// getLabelDocument util function that loads a document for a label and its content type from the blob store,
+// returns storage.ErrNotFound if it was never stored or its content no longer matches the stored hash
+func getLabelDocument (companyID, labelID, kind string) ([]byte, string, error) {
+	var key, contentType, hash string
+	getDocumentQuery, err := database.DB.Prepare(getDocumentSql)
+	if err != nil {
+		return nil, "", err
+	}
+	defer getDocumentQuery.Close()
+	if err = getDocumentQuery.QueryRow(labelID, companyID, kind).Scan(&key, &contentType, &hash); err != nil {
+		return nil, "", storage.ErrNotFound
+	}
+
+	data, err := storage.Store.Get(key)
+	if err != nil {
+		return nil, "", err
+	}
+	if storage.Hash(data) != hash {
+		log.Printf("Document %s Failed Hash Check", key)
+		return nil, "", storage.ErrNotFound
+	}
+	return data, contentType, nil
+}
+
+// StartDocumentRetention removes expired documents from the blob store every interval
+func StartDocumentRetention (interval time.Duration) {
+	go func() {
+		for {
+			purgeExpiredDocuments()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// purgeExpiredDocuments util function that deletes documents past their expiry
+func purgeExpiredDocuments () {
+	rows, err := database.DB.Query(getExpiredDocumentsSql)
+	if err != nil {
+		log.Printf("Document Retention Error: %s", err.Error())
+		return
+	}
+	type expired struct {
+		id, key string
+	}
+	var documents []expired
+	for rows.Next() {
+		var d expired
+		if err = rows.Scan(&d.id, &d.key); err == nil {
+			documents = append(documents, d)
+		}
+	}
+	rows.Close()
+
+	for _, d := range documents {
+		if err = storage.Store.Delete(d.key); err != nil {
+			log.Printf("Document Retention Error: %s", err.Error())
+			continue
+		}
+		if _, err = database.DB.Exec(deleteDocumentSql, d.id); err != nil {
+			log.Printf("Document Retention Error: %s", err.Error())
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"net/http"
+
+	"go.fromyama/utils"
+	"go.fromyama/utils/carriers"
+	"go.fromyama/utils/database"
+	"go.fromyama/utils/jwtUtil"
+	"go.fromyama/utils/pdf"
+	"go.fromyama/utils/response"
+)
+
+const getCompanyLabelFormatSql = "SELECT COALESCE(label_format, '') FROM companies WHERE id = $1"
+const setCompanyLabelFormatSql = "UPDATE companies SET label_format = $1 WHERE id = $2"
+
+// label formats a label can be bought or reprinted in
+const (
+	labelFormatPDFLetter = carriers.FormatPDFLetter
+	labelFormatPDF4x6    = carriers.FormatPDF4x6
+	labelFormatZPL       = carriers.FormatZPL
+)
+
+type labelFormatSpec struct {
+	OutputFormat string
+	Encoding     string
+	ContentType  string
+	Extension    string
+}
+
+var labelFormats = map[string]labelFormatSpec{
+	labelFormatPDFLetter: {OutputFormat: "8.5x11", Encoding: "PDF", ContentType: "application/pdf", Extension: ".pdf"},
+	labelFormatPDF4x6:    {OutputFormat: "4x6", Encoding: "PDF", ContentType: "application/pdf", Extension: ".pdf"},
+	labelFormatZPL:       {OutputFormat: "4x6", Encoding: "ZPL", ContentType: "application/zpl", Extension: ".zpl"},
+}
+
+// canadaPostNonContractFormats are the formats the non-contract shipment endpoint can produce itself
+var canadaPostNonContractFormats = map[string]bool{
+	labelFormatPDFLetter: true,
+	labelFormatPDF4x6:    true,
+}
+
+// canadaPostContractFormats are the formats the contract shipment endpoint can produce itself
+var canadaPostContractFormats = map[string]bool{
+	labelFormatPDFLetter: true,
+	labelFormatPDF4x6:    true,
+	labelFormatZPL:       true,
+}
+
+// SetLabelFormat /label/format sets the label format used when a label request does not give one
+// request body has label_format (pdf_8.5x11, pdf_4x6, zpl)
+func SetLabelFormat (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	var body map[string]string
+	err := utils.ParseRequestBody(r, &body, []string{"label_format"})
+	if err != nil{
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+	if _, ok := labelFormats[body["label_format"]]; !ok {
+		response.Error(w, "Unknown Label Format")
+		return
+	}
+
+	setFormatQuery, err := database.DB.Prepare(setCompanyLabelFormatSql)
+	if err != nil {
+		response.Error(w, "Set Label Format Error")
+		return
+	}
+	defer setFormatQuery.Close()
+	if _, err = setFormatQuery.Exec(body["label_format"], tokenClaims.CompanyID); err != nil {
+		response.Error(w, "Set Label Format Error")
+		return
+	}
+	response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Label Format Updated"})
+}
+
+// resolveLabelFormat util function that returns the requested label format, falling back to the company
+// default and then to letter sized pdf
+func resolveLabelFormat (companyID, requested string) (string, error) {
+	if requested == "" {
+		getFormatQuery, err := database.DB.Prepare(getCompanyLabelFormatSql)
+		if err != nil {
+			return "", err
+		}
+		defer getFormatQuery.Close()
+		if err = getFormatQuery.QueryRow(companyID).Scan(&requested); err != nil {
+			return "", err
+		}
+	}
+	if requested == "" {
+		return labelFormatPDFLetter, nil
+	}
+	if _, ok := labelFormats[requested]; !ok {
+		return "", &postageError{"Unknown Label Format " + requested}
+	}
+	return requested, nil
+}
+
+// carrierLabelFormat util function that picks the format to ask the carrier for, the wanted format when the
+// carrier supports it natively or letter sized pdf when it can be cropped to the wanted format afterwards
+func carrierLabelFormat (wanted string, supported map[string]bool) (string, error) {
+	if supported[wanted] {
+		return wanted, nil
+	}
+	if wanted == labelFormatPDF4x6 && supported[labelFormatPDFLetter] {
+		return labelFormatPDFLetter, nil
+	}
+	return "", &postageError{"Label Format " + wanted + " Not Supported By Carrier"}
+}
+
+// convertLabel util function that converts a label from the format it was bought in to the wanted format
+func convertLabel (label []byte, from, to string) ([]byte, error) {
+	if from == to || (from == "" && to == labelFormatPDFLetter) {
+		return label, nil
+	}
+	if (from == labelFormatPDFLetter || from == "") && to == labelFormatPDF4x6 {
+		return pdf.CropTo4x6(label)
+	}
+	return nil, &postageError{"Can Not Convert Label From " + from + " To " + to}
+}
@@ -0,0 +1,249 @@
+package controllers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"go.fromyama/utils"
+	"go.fromyama/utils/database"
+	"go.fromyama/utils/jwtUtil"
+	"go.fromyama/utils/response"
+	"go.fromyama/utils/roles"
+)
+
+const addInvitationSql = "INSERT INTO invitations(company_id, email, role, invited_by, nonce, expires_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at"
+const isInvitationPendingSql = "SELECT exists(SELECT 1 FROM invitations WHERE company_id = $1 AND email = $2 AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > now())"
+const getInvitationsSql = "SELECT i.id, i.email, i.role, COALESCE(u.email, ''), i.created_at, i.expires_at, i.expires_at < now() FROM invitations i LEFT JOIN users u on u.id = i.invited_by WHERE i.company_id = $1 AND i.accepted_at IS NULL AND i.revoked_at IS NULL ORDER BY i.created_at DESC"
+const getInvitationSql = "SELECT id, email, role, created_at FROM invitations WHERE id = $1 AND company_id = $2 AND accepted_at IS NULL AND revoked_at IS NULL"
+const resendInvitationSql = "UPDATE invitations SET nonce = $1, expires_at = $2 WHERE id = $3 AND company_id = $4 AND accepted_at IS NULL AND revoked_at IS NULL"
+const revokeInvitationSql = "UPDATE invitations SET revoked_at = now() WHERE id = $1 AND company_id = $2 AND accepted_at IS NULL AND revoked_at IS NULL"
+const acceptInvitationSql = "UPDATE invitations SET accepted_at = now() WHERE id = $1 AND nonce = $2 AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > now() RETURNING company_id, email, role, invited_by"
+const unacceptInvitationSql = "UPDATE invitations SET accepted_at = NULL WHERE id = $1"
+const isEmailTakenSql = "SELECT exists(SELECT 1 FROM users WHERE lower(email) = $1 AND removed_at IS NULL)"
+const getCompanyNameSql = "SELECT company_name FROM companies WHERE id = $1"
+
+// invitationLifetime is how long an invitation link works, resending it starts it again
+const invitationLifetime = time.Hour*24*7
+
+const auditInvite = "invite"
+
+// InviteEmployee /invitations emails a link to join the company with a role, whoever follows it is approved with
+// that role when they set their name and password, members can only invite to roles less trusted than their own
+// request body has email and optionally role, shipper when missing
+func InviteEmployee (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	var body map[string]string
+	err := utils.ParseRequestBody(r, &body, []string{"email"})
+	if err != nil{
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+	address, err := mail.ParseAddress(body["email"])
+	if err != nil {
+		response.Error(w, "Email Not Valid")
+		return
+	}
+	email := strings.ToLower(address.Address)
+	role := body["role"]
+	if role == "" {
+		role = roles.Shipper
+	}
+	if !roles.Valid(role) || role == roles.Owner {
+		response.Error(w, "Role Can Not Be Invited " + role)
+		return
+	}
+	if !roles.CanManage(tokenClaims.Role, role) {
+		response.JSON(w, http.StatusForbidden, response.BasicMessage{Message: "Role Not Permitted"})
+		return
+	}
+
+	var taken, pending bool
+	if err = database.DB.QueryRow(isEmailTakenSql, email).Scan(&taken); err != nil {
+		response.Error(w, "Check Existing Email Error")
+		return
+	}
+	if taken {
+		response.JSON(w, http.StatusConflict, response.BasicMessage{Message: "Email Already In Use"})
+		return
+	}
+	if err = database.DB.QueryRow(isInvitationPendingSql, tokenClaims.CompanyID, email).Scan(&pending); err != nil {
+		response.Error(w, "Invite Employee Error")
+		return
+	}
+	if pending {
+		response.JSON(w, http.StatusConflict, response.BasicMessage{Message: "Invitation Already Pending, Resend It Instead"})
+		return
+	}
+
+	nonce := uuid.New().String()
+	expiresAt := time.Now().Add(invitationLifetime)
+	invitation := response.Invitation{Email: email, Role: role, InvitedBy: tokenClaims.Email, ExpiresAt: expiresAt.Format(time.RFC3339)}
+	err = database.DB.QueryRow(addInvitationSql, tokenClaims.CompanyID, email, role, tokenClaims.UserID, nonce, expiresAt).Scan(&invitation.ID, &invitation.CreatedAt)
+	if err != nil {
+		response.Error(w, "Invite Employee Error")
+		return
+	}
+	invitation.Emailed = sendInvitation(tokenClaims.CompanyID, invitation, nonce, expiresAt)
+	response.JSON(w, http.StatusCreated, invitation)
+}
+
+// GetInvitations /invitations returns the invitations not accepted or revoked yet, expired ones can be resent
+func GetInvitations (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	rows, err := database.DB.Query(getInvitationsSql, tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Get Invitations Error")
+		return
+	}
+	defer rows.Close()
+	invitations := []response.Invitation{}
+	for rows.Next() {
+		var i response.Invitation
+		if err = rows.Scan(&i.ID, &i.Email, &i.Role, &i.InvitedBy, &i.CreatedAt, &i.ExpiresAt, &i.Expired); err != nil {
+			response.Error(w, "Get Invitations Error")
+			return
+		}
+		invitations = append(invitations, i)
+	}
+	response.JSON(w, http.StatusOK, invitations)
+}
+
+// ResendInvitation /invitations/{invitationID}/resend emails a new link for a pending invitation, links sent before
+// stop working
+// request url has invitationID
+func ResendInvitation (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	var invitation response.Invitation
+	err := database.DB.QueryRow(getInvitationSql, chi.URLParam(r, "invitationID"), tokenClaims.CompanyID).Scan(&invitation.ID, &invitation.Email, &invitation.Role, &invitation.CreatedAt)
+	if err == sql.ErrNoRows {
+		response.JSON(w, http.StatusNotFound, response.BasicMessage{Message: "Invitation Not Found"})
+		return
+	} else if err != nil {
+		response.Error(w, "Resend Invitation Error")
+		return
+	}
+	if !roles.CanManage(tokenClaims.Role, invitation.Role) {
+		response.JSON(w, http.StatusForbidden, response.BasicMessage{Message: "Role Not Permitted"})
+		return
+	}
+	nonce := uuid.New().String()
+	expiresAt := time.Now().Add(invitationLifetime)
+	invitation.InvitedBy = tokenClaims.Email
+	invitation.ExpiresAt = expiresAt.Format(time.RFC3339)
+	res, err := database.DB.Exec(resendInvitationSql, nonce, expiresAt, invitation.ID, tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Resend Invitation Error")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		response.JSON(w, http.StatusNotFound, response.BasicMessage{Message: "Invitation Not Found"})
+		return
+	}
+	invitation.Emailed = sendInvitation(tokenClaims.CompanyID, invitation, nonce, expiresAt)
+	response.JSON(w, http.StatusAccepted, invitation)
+}
+
+// RevokeInvitation /invitations/{invitationID} cancels a pending invitation so its link stops working, only members
+// who can manage the invited role can cancel it
+// request url has invitationID
+func RevokeInvitation (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	var invitation response.Invitation
+	err := database.DB.QueryRow(getInvitationSql, chi.URLParam(r, "invitationID"), tokenClaims.CompanyID).Scan(&invitation.ID, &invitation.Email, &invitation.Role, &invitation.CreatedAt)
+	if err == sql.ErrNoRows {
+		response.JSON(w, http.StatusNotFound, response.BasicMessage{Message: "Invitation Not Found"})
+		return
+	} else if err != nil {
+		response.Error(w, "Revoke Invitation Error")
+		return
+	}
+	if !roles.CanManage(tokenClaims.Role, invitation.Role) {
+		response.JSON(w, http.StatusForbidden, response.BasicMessage{Message: "Role Not Permitted"})
+		return
+	}
+	res, err := database.DB.Exec(revokeInvitationSql, invitation.ID, tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Revoke Invitation Error")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		response.JSON(w, http.StatusNotFound, response.BasicMessage{Message: "Invitation Not Found"})
+		return
+	}
+	response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Invitation Revoked"})
+}
+
+// AcceptInvitation /invitations/accept signs up the invited user already approved with the invited role and
+// returns jwt token, each link works once and following it verifies the email
+// request body has token from the invitation link, name, password
+func AcceptInvitation (w http.ResponseWriter, r *http.Request){
+	var body map[string]string
+	err := utils.ParseRequestBody(r, &body, []string{"token", "name", "password"})
+	if err != nil{
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+	invitationID, nonce, err := jwtUtil.CheckPurposeToken(body["token"], jwtUtil.PurposeInvitation)
+	if err != nil {
+		response.Forbidden(w)
+		return
+	}
+
+	var companyID, email, role, invitedBy string
+	err = database.DB.QueryRow(acceptInvitationSql, invitationID, nonce).Scan(&companyID, &email, &role, &invitedBy)
+	if err == sql.ErrNoRows {
+		response.JSON(w, http.StatusGone, response.BasicMessage{Message: "Invitation No Longer Valid"})
+		return
+	} else if err != nil {
+		response.Error(w, "Accept Invitation Error")
+		return
+	}
+	userID, token, err := SignUpUserAndGenerateToken(w, r, true, false, true, role, body["name"], email, body["password"], companyID)
+	if err != nil {
+		// the invitation can be used again once whatever failed is fixed
+		database.DB.Exec(unacceptInvitationSql, invitationID)
+		return
+	}
+	if err = auditMemberAction(database.DB, jwtUtil.TokenClaims{CompanyID: companyID, UserID: invitedBy}, userID, auditInvite, role); err != nil {
+		log.Printf("Audit Invitation Error: %s", err.Error())
+	}
+	response.JSON(w, http.StatusCreated, *token)
+}
+
+// sendInvitation util function that emails the link of an invitation, the link carries a token signed for the
+// invitation and its current nonce
+func sendInvitation (companyID string, invitation response.Invitation, nonce string, expiresAt time.Time) bool {
+	token, err := jwtUtil.GeneratePurposeToken(jwtUtil.PurposeInvitation, invitation.ID, nonce, invitationLifetime)
+	if err != nil {
+		log.Printf("Invitation Token Error: %s", err.Error())
+		return false
+	}
+	var companyName string
+	if err = database.DB.QueryRow(getCompanyNameSql, companyID).Scan(&companyName); err != nil {
+		log.Printf("Get Company Name Error: %s", err.Error())
+		return false
+	}
+	html, err := renderEmail("invitation.html", response.InvitationEmail{
+		CompanyName: companyName,
+		Role: invitation.Role,
+		Link: os.Getenv("APP_URL") + "/invitations/accept?token=" + url.QueryEscape(token),
+		ExpiresAt: expiresAt.Format("January 2, 2006"),
+	})
+	if err == nil {
+		err = SendEmail(invitation.Email, "You Are Invited To " + companyName + " On FromYama", html, nil)
+	}
+	if err != nil {
+		log.Printf("Send Invitation Error: %s", err.Error())
+		return false
+	}
+	return true
+}
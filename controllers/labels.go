@@ -0,0 +1,235 @@
+package controllers
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"go.fromyama/utils/carriers"
+	"go.fromyama/utils/database"
+	"go.fromyama/utils/jwtUtil"
+	"go.fromyama/utils/response"
+	"go.fromyama/utils/storage"
+)
+
+const getLabelsSql = "SELECT id, user_id, COALESCE(carrier, 'canadapost'), COALESCE(tracking_pin, ''), COALESCE(name, ''), COALESCE(postal_code, ''), COALESCE(country, ''), COALESCE(service_code, ''), COALESCE(price, 0), COALESCE(return_of::text, ''), voided_at IS NOT NULL, created_at FROM labels WHERE company_id = $1"
+const countLabelsSql = "SELECT count(*) FROM labels WHERE company_id = $1"
+const getLabelLinkSql = "SELECT COALESCE(carrier, 'canadapost'), label, COALESCE(label_format, '') FROM labels WHERE id = $1 AND company_id = $2"
+
+const defaultLabelPageSize = 25
+const maxLabelPageSize = 100
+
+type labelError struct {
+	s string
+}
+func (e *labelError) Error() string{
+	return e.s
+}
+
+// GetLabels /labels returns a page of labels purchased by the company, newest first
+// request url optionally has page, limit, from, to (YYYY-MM-DD), user_id, tracking_number, destination
+func GetLabels (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+
+	page, limit := 1, defaultLabelPageSize
+	if p, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	if limit > maxLabelPageSize {
+		limit = maxLabelPageSize
+	}
+
+	filter, args, err := labelFilter(r, []interface{}{tokenClaims.CompanyID})
+	if err != nil {
+		response.Error(w, "Label Filter Error, " + err.Error())
+		return
+	}
+
+	var total int
+	countQuery, err := database.DB.Prepare(countLabelsSql + filter)
+	if err != nil {
+		response.Error(w, "Get Labels Error")
+		return
+	}
+	defer countQuery.Close()
+	if err = countQuery.QueryRow(args...).Scan(&total); err != nil {
+		response.Error(w, "Get Labels Error")
+		return
+	}
+
+	pageArgs := append(args, limit, (page-1)*limit)
+	labelsQuery, err := database.DB.Prepare(getLabelsSql + filter + " ORDER BY created_at DESC LIMIT $" +
+		strconv.Itoa(len(args)+1) + " OFFSET $" + strconv.Itoa(len(args)+2))
+	if err != nil {
+		response.Error(w, "Get Labels Error")
+		return
+	}
+	defer labelsQuery.Close()
+	rows, err := labelsQuery.Query(pageArgs...)
+	if err != nil {
+		response.Error(w, "Get Labels Error")
+		return
+	}
+	defer rows.Close()
+
+	labels := response.Labels{
+		Labels: []response.Label{},
+		Page: page,
+		Limit: limit,
+		Total: total,
+	}
+	for rows.Next() {
+		var l response.Label
+		var createdAt time.Time
+		if err = rows.Scan(&l.ID, &l.UserID, &l.Carrier, &l.TrackingNumber, &l.Name, &l.PostalCode, &l.Country, &l.ServiceCode, &l.Price, &l.ReturnOf, &l.Voided, &createdAt); err != nil {
+			response.Error(w, "Get Labels Error")
+			return
+		}
+		l.CreatedAt = createdAt.Format(time.RFC3339)
+		labels.Labels = append(labels.Labels, l)
+	}
+
+	response.JSON(w, http.StatusOK, labels)
+}
+
+// GetLabelPDF /labels/{labelID}/pdf returns the pdf of a previously purchased label so it can be reprinted,
+// the stored copy is used when there is one otherwise it is fetched from the carrier again
+// request url has labelID, optionally format to reprint a letter sized label as pdf_4x6
+func GetLabelPDF (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	labelID := chi.URLParam(r, "labelID")
+
+	var carrierName, labelLink, labelFormat string
+	getLabelQuery, err := database.DB.Prepare(getLabelLinkSql)
+	if err != nil {
+		response.Error(w, "Get Label Error")
+		return
+	}
+	defer getLabelQuery.Close()
+	if err = getLabelQuery.QueryRow(labelID, tokenClaims.CompanyID).Scan(&carrierName, &labelLink, &labelFormat); err != nil {
+		response.JSON(w, http.StatusNotFound, response.BasicMessage{Message: "Label Not Found"})
+		return
+	}
+
+	if labelFormat == "" {
+		labelFormat = labelFormatPDFLetter
+	}
+	wantedFormat := r.URL.Query().Get("format")
+	if wantedFormat == "" {
+		wantedFormat = labelFormat
+	}
+	if _, ok := labelFormats[wantedFormat]; !ok {
+		response.Error(w, "Unknown Label Format")
+		return
+	}
+
+	label, _, err := getLabelDocument(tokenClaims.CompanyID, labelID, storage.KindLabel)
+	if err != nil {
+		label, err = getCarrierLabel(carrierName, labelLink, labelFormat)
+		if err != nil {
+			response.Error(w, "Get Label Error")
+			return
+		}
+		if err = storeLabelDocument(tokenClaims.CompanyID, labelID, storage.KindLabel, labelFormats[labelFormat].ContentType, label); err != nil {
+			log.Printf("Store Label Error: %s", err.Error())
+		}
+	}
+	label, err = convertLabel(label, labelFormat, wantedFormat)
+	if err != nil {
+		response.Error(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", labelFormats[wantedFormat].ContentType)
+	w.Header().Set("Content-Disposition", "inline; filename=\"label-"+labelID+labelFormats[wantedFormat].Extension+"\"")
+	w.WriteHeader(http.StatusOK)
+	w.Write(label)
+}
+
+// labelFilter util function that turns the label search params into sql conditions, args starts with the
+// company id and the returned args include the values for the returned conditions
+func labelFilter (r *http.Request, args []interface{}) (string, []interface{}, error) {
+	query := r.URL.Query()
+	filter := ""
+	next := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if from := query.Get("from"); from != "" {
+		date, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			return "", nil, &labelError{"from Must Be YYYY-MM-DD"}
+		}
+		filter += " AND created_at >= " + next(date)
+	}
+	if to := query.Get("to"); to != "" {
+		date, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			return "", nil, &labelError{"to Must Be YYYY-MM-DD"}
+		}
+		filter += " AND created_at < " + next(date.AddDate(0, 0, 1))
+	}
+	if userID := query.Get("user_id"); userID != "" {
+		filter += " AND user_id = " + next(userID)
+	}
+	if tracking := query.Get("tracking_number"); tracking != "" {
+		filter += " AND tracking_pin = " + next(tracking)
+	}
+	if destination := query.Get("destination"); destination != "" {
+		p := next("%" + destination + "%")
+		filter += " AND (postal_code ILIKE " + p + " OR name ILIKE " + p + ")"
+	}
+	return filter, args, nil
+}
+
+// getCarrierLabel util function that fetches a label from the carrier it was bought from in labelFormat, labelLink
+// is the canada post label link or the shipment id for other carriers
+func getCarrierLabel (carrierName, labelLink, labelFormat string) ([]byte, error) {
+	if carrierName == carriers.CanadaPost {
+		return getCanadaPostDocument(labelLink, labelFormats[labelFormat].ContentType)
+	}
+	carrier, err := getCarrier(carrierName)
+	if err != nil {
+		return nil, err
+	}
+	carrierFormat, err := carrierLabelFormat(labelFormat, carrier.LabelFormats())
+	if err != nil {
+		return nil, err
+	}
+	label, err := carrier.Label(labelLink, carrierFormat)
+	if err != nil {
+		return nil, err
+	}
+	return convertLabel(label, carrierFormat, labelFormat)
+}
+
+// getCanadaPostDocument util function that downloads a label or manifest from a canada post artifact link as contentType
+func getCanadaPostDocument (link, contentType string) ([]byte, error) {
+	client := &http.Client{
+		Timeout: time.Second * 20,
+	}
+	req, err := http.NewRequest("GET", link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(os.Getenv("CANADA_POST_USER"), os.Getenv("CANADA_POST_PASS"))
+	req.Header.Add("Accept", contentType)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &labelError{"Canada Post Document Request Failed With " + resp.Status}
+	}
+	return ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,227 @@
+package controllers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"go.fromyama/utils"
+	"go.fromyama/utils/database"
+	"go.fromyama/utils/jwtUtil"
+	"go.fromyama/utils/response"
+)
+
+const getLocationsSql = "SELECT id, name, street, city, province_code, country, postal_code, COALESCE(phone, 0), COALESCE(contact_name, ''), COALESCE(is_default, false), COALESCE(shopify_location_id, '') FROM locations WHERE company_id = $1 ORDER BY is_default DESC NULLS LAST, name, id"
+const addLocationSql = "INSERT INTO locations (company_id, name, street, city, province_code, country, postal_code, phone, contact_name, shopify_location_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id"
+const updateLocationSql = "UPDATE locations SET name = $1, street = $2, city = $3, province_code = $4, country = $5, postal_code = $6, phone = $7, contact_name = $8, shopify_location_id = $9 WHERE id = $10 AND company_id = $11"
+const deleteLocationSql = "DELETE FROM locations WHERE id = $1 AND company_id = $2"
+const setDefaultLocationSql = "UPDATE locations SET is_default = (id = $1) WHERE company_id = $2 AND EXISTS (SELECT 1 FROM locations WHERE id = $1 AND company_id = $2)"
+const getLocationAddressSql = "SELECT street, city, province_code, country, postal_code, COALESCE(phone, 0), COALESCE(contact_name, '') FROM locations WHERE company_id = $1 AND id = $2"
+const getShopifyLocationAddressSql = "SELECT street, city, province_code, country, postal_code, COALESCE(phone, 0), COALESCE(contact_name, '') FROM locations WHERE company_id = $1 AND shopify_location_id = $2"
+const getDefaultLocationAddressSql = "SELECT street, city, province_code, country, postal_code, COALESCE(phone, 0), COALESCE(contact_name, '') FROM locations WHERE company_id = $1 AND is_default"
+
+type locationError struct {
+	s string
+}
+
+func (e *locationError) Error() string {
+	return e.s
+}
+
+// GetLocations /locations returns the addresses the company ships from, the default location first
+func GetLocations (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+
+	rows, err := database.DB.Query(getLocationsSql, tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Get Locations Error")
+		return
+	}
+	defer rows.Close()
+	locations := []response.Location{}
+	for rows.Next() {
+		var l response.Location
+		err = rows.Scan(&l.ID, &l.Name, &l.Address.Street, &l.Address.City, &l.Address.ProvinceCode, &l.Address.Country, &l.Address.PostalCode,
+			&l.Address.Phone, &l.ContactName, &l.Default, &l.ShopifyLocationID)
+		if err != nil {
+			response.Error(w, "Get Locations Error")
+			return
+		}
+		locations = append(locations, l)
+	}
+	response.JSON(w, http.StatusOK, locations)
+}
+
+// AddLocation /locations adds an address the company ships from
+// request body has name, street, city, province_code, country_code, postal_code, optionally phone, contact_name,
+// shopify_location_id of the shopify location orders shipped from it are assigned to and default (true to ship
+// from it when a request does not pick a location)
+func AddLocation (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	var body map[string]string
+	err := utils.ParseRequestBody(r, &body, []string{"name", "street", "city", "province_code", "country_code", "postal_code"})
+	if err != nil{
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+	l, err := locationFromBody(body)
+	if err != nil {
+		response.Error(w, err.Error())
+		return
+	}
+	err = database.DB.QueryRow(addLocationSql, tokenClaims.CompanyID, l.Name, l.Address.Street, l.Address.City, l.Address.ProvinceCode, l.Address.Country,
+		l.Address.PostalCode, nullPhone(l.Address.Phone), nullString(l.ContactName), nullString(l.ShopifyLocationID)).Scan(&l.ID)
+	if err != nil {
+		response.Error(w, "Add Location Error")
+		return
+	}
+	if body["default"] == "true" {
+		if err = setDefaultLocation(tokenClaims.CompanyID, l.ID); err != nil {
+			response.Error(w, "Add Location Error")
+			return
+		}
+		l.Default = true
+	}
+	response.JSON(w, http.StatusCreated, l)
+}
+
+// UpdateLocation /locations/{locationID} replaces the name, address and contact of a location
+// request url has locationID
+// request body has the same fields as adding a location except default
+func UpdateLocation (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	var body map[string]string
+	err := utils.ParseRequestBody(r, &body, []string{"name", "street", "city", "province_code", "country_code", "postal_code"})
+	if err != nil{
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+	l, err := locationFromBody(body)
+	if err != nil {
+		response.Error(w, err.Error())
+		return
+	}
+	res, err := database.DB.Exec(updateLocationSql, l.Name, l.Address.Street, l.Address.City, l.Address.ProvinceCode, l.Address.Country, l.Address.PostalCode,
+		nullPhone(l.Address.Phone), nullString(l.ContactName), nullString(l.ShopifyLocationID), chi.URLParam(r, "locationID"), tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Update Location Error")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		response.JSON(w, http.StatusNotFound, response.BasicMessage{Message: "Location Not Found"})
+		return
+	}
+	response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Location Updated"})
+}
+
+// DeleteLocation /locations/{locationID} removes a location, requests that do not pick a location ship from the
+// company address after the default location is removed
+// request url has locationID
+func DeleteLocation (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	res, err := database.DB.Exec(deleteLocationSql, chi.URLParam(r, "locationID"), tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Delete Location Error")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		response.JSON(w, http.StatusNotFound, response.BasicMessage{Message: "Location Not Found"})
+		return
+	}
+	response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Location Deleted"})
+}
+
+// SetDefaultLocation /locations/{locationID}/default makes a location the one requests ship from when they do not
+// pick a location
+// request url has locationID
+func SetDefaultLocation (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	err := setDefaultLocation(tokenClaims.CompanyID, chi.URLParam(r, "locationID"))
+	if _, ok := err.(*locationError); ok {
+		response.JSON(w, http.StatusNotFound, response.BasicMessage{Message: err.Error()})
+		return
+	} else if err != nil {
+		response.Error(w, "Set Default Location Error")
+		return
+	}
+	response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Default Location Set"})
+}
+
+// locationFromBody util function that reads and checks a location from a request body
+func locationFromBody (body map[string]string) (response.Location, error) {
+	l := response.Location{
+		Name: body["name"],
+		Address: postageAddressFromBody(body),
+		ContactName: body["contact_name"],
+		ShopifyLocationID: body["shopify_location_id"],
+	}
+	l.Address.ShipperName = ""
+	l.Address.Country = strings.ToUpper(l.Address.Country)
+	if len(l.Address.Country) != 2 {
+		return l, &locationError{"Country Code Must Be 2 Letters"}
+	}
+	if body["phone"] != "" && l.Address.Phone == 0 {
+		return l, &locationError{"Phone Must Be Digits Only"}
+	}
+	if l.ShopifyLocationID != "" {
+		if _, err := strconv.ParseInt(l.ShopifyLocationID, 10, 64); err != nil {
+			return l, &locationError{"Shopify Location ID Must Be A Number"}
+		}
+	}
+	return l, nil
+}
+
+// setDefaultLocation util function that makes locationID the only default location of the company
+func setDefaultLocation (companyID, locationID string) error {
+	res, err := database.DB.Exec(setDefaultLocationSql, locationID, companyID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return &locationError{"Location Not Found"}
+	}
+	return nil
+}
+
+// shipFrom util function that replaces the address and contact of source with the location a request ships from, the one
+// with the body location_id, else the one mapped to the body shopify_location_id, else the default location,
+// source keeps the company address when none of them is set
+func shipFrom (companyID string, body map[string]string, source *response.PostageAddress) error {
+	var row *sql.Row
+	if body["location_id"] != "" {
+		row = database.DB.QueryRow(getLocationAddressSql, companyID, body["location_id"])
+	} else if body["shopify_location_id"] != "" {
+		row = database.DB.QueryRow(getShopifyLocationAddressSql, companyID, body["shopify_location_id"])
+	} else {
+		row = database.DB.QueryRow(getDefaultLocationAddressSql, companyID)
+	}
+	var a response.PostageAddress
+	err := row.Scan(&a.Street, &a.City, &a.ProvinceCode, &a.Country, &a.PostalCode, &a.Phone, &a.ContactName)
+	if err == sql.ErrNoRows && body["location_id"] != "" {
+		return &locationError{"Location Not Found"}
+	} else if err == sql.ErrNoRows && body["shopify_location_id"] != "" {
+		// an unmapped shopify location ships from the default location
+		return shipFrom(companyID, map[string]string{}, source)
+	} else if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	source.Street, source.City, source.ProvinceCode, source.Country, source.PostalCode = a.Street, a.City, a.ProvinceCode, a.Country, a.PostalCode
+	if a.Phone != 0 {
+		source.Phone = a.Phone
+	}
+	source.ContactName = a.ContactName
+	return nil
+}
+
+// nullPhone util function that stores a missing phone number as null
+func nullPhone (phone int) *int {
+	if phone == 0 {
+		return nil
+	}
+	return &phone
+}
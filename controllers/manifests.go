@@ -0,0 +1,305 @@
+package controllers
+
+import (
+	"encoding/xml"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"go.fromyama/utils"
+	"go.fromyama/utils/database"
+	"go.fromyama/utils/jwtUtil"
+	"go.fromyama/utils/response"
+	"go.fromyama/utils/storage"
+)
+
+const getUntransmittedGroupsSql = "SELECT DISTINCT group_id FROM labels WHERE company_id = $1 AND group_id IS NOT NULL AND group_id <> '' AND transmitted_at IS NULL"
+const addManifestSql = "INSERT INTO manifests(company_id, user_id, group_id, po_number, manifest_link) VALUES ($1, $2, $3, $4, $5) RETURNING id"
+const setGroupTransmittedSql = "UPDATE labels SET transmitted_at = now() WHERE company_id = $1 AND group_id = $2 AND transmitted_at IS NULL"
+const getManifestsSql = "SELECT id, po_number, COALESCE(group_id, ''), created_at FROM manifests WHERE company_id = $1 ORDER BY created_at DESC"
+const getManifestSql = "SELECT id FROM manifests WHERE id = $1 AND company_id = $2"
+const setCanadaPostContractSql = "UPDATE companies SET canada_post_customer_number = $1, canada_post_contract_id = $2 WHERE id = $3"
+
+// TransmitShipments /manifests transmits the untransmitted contract shipment groups of the company to canada post
+// as the end of day close out and stores the manifest of each group
+func TransmitShipments (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+
+	account, err := getCanadaPostAccount(tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Get Shipper Error")
+		return
+	}
+	if !account.isContract() {
+		response.Error(w, "Company Has No Canada Post Contract")
+		return
+	}
+
+	var source response.Shipper
+	getShippingInfoQuery, err := database.DB.Prepare(getShippingInfoSql)
+	if err != nil {
+		response.Error(w, "Get Shipper Error")
+		return
+	}
+	defer getShippingInfoQuery.Close()
+	err = getShippingInfoQuery.QueryRow(tokenClaims.CompanyID).Scan(&source.Address.ShipperName, &source.Address.Street, &source.Address.City, &source.Address.ProvinceCode, &source.Address.Country, &source.Address.PostalCode, &source.Address.Phone)
+	if err != nil {
+		response.Error(w, "Get Shipper Error")
+		return
+	}
+
+	rows, err := database.DB.Query(getUntransmittedGroupsSql, tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Get Shipments Error")
+		return
+	}
+	var groups []string
+	for rows.Next() {
+		var group string
+		if err = rows.Scan(&group); err == nil {
+			groups = append(groups, group)
+		}
+	}
+	rows.Close()
+	if len(groups) == 0 {
+		response.JSON(w, http.StatusOK, []response.Manifest{})
+		return
+	}
+
+	// canada post returns one manifest per transmit, so each group is transmitted on its own from the shipping
+	// point of its location to keep the manifest and the labels in it together
+	manifests := []response.Manifest{}
+	for _, group := range groups {
+		manifest, err := transmitCanadaPostGroup(account, source, group)
+		if err != nil {
+			log.Printf("Transmit Group %s Error: %s", group, err.Error())
+			continue
+		}
+
+		var manifestID string
+		err = database.DB.QueryRow(addManifestSql, tokenClaims.CompanyID, tokenClaims.UserID, group, manifest.PoNumber, manifest.link).Scan(&manifestID)
+		if err != nil {
+			log.Printf("Store Manifest Error: %s", err.Error())
+			continue
+		}
+		if _, err = database.DB.Exec(setGroupTransmittedSql, tokenClaims.CompanyID, group); err != nil {
+			log.Printf("Set Group %s Transmitted Error: %s", group, err.Error())
+		}
+		if manifest.pdf != nil {
+			if err = storage.Store.Put(storage.ManifestKey(manifestID), manifest.pdf, "application/pdf"); err != nil {
+				log.Printf("Store Manifest PDF Error: %s", err.Error())
+			}
+		}
+
+		manifests = append(manifests, response.Manifest{
+			ID: manifestID,
+			PoNumber: manifest.PoNumber,
+			GroupID: group,
+			CreatedAt: time.Now().Format(time.RFC3339),
+			PdfUrl: "/postage/manifests/" + manifestID + "/pdf",
+		})
+	}
+	if len(manifests) == 0 {
+		response.Error(w, "Transmit Error")
+		return
+	}
+	response.JSON(w, http.StatusAccepted, manifests)
+}
+
+// GetManifests /manifests returns the manifests of the company, newest first
+func GetManifests (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+
+	rows, err := database.DB.Query(getManifestsSql, tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Get Manifests Error")
+		return
+	}
+	defer rows.Close()
+
+	manifests := []response.Manifest{}
+	for rows.Next() {
+		var m response.Manifest
+		var createdAt time.Time
+		if err = rows.Scan(&m.ID, &m.PoNumber, &m.GroupID, &createdAt); err != nil {
+			response.Error(w, "Get Manifests Error")
+			return
+		}
+		m.CreatedAt = createdAt.Format(time.RFC3339)
+		m.PdfUrl = "/postage/manifests/" + m.ID + "/pdf"
+		manifests = append(manifests, m)
+	}
+	response.JSON(w, http.StatusOK, manifests)
+}
+
+// GetManifestPDF /manifests/{manifestID}/pdf returns the pdf of a manifest
+// request url has manifestID
+func GetManifestPDF (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	manifestID := chi.URLParam(r, "manifestID")
+
+	var id string
+	if err := database.DB.QueryRow(getManifestSql, manifestID, tokenClaims.CompanyID).Scan(&id); err != nil {
+		response.JSON(w, http.StatusNotFound, response.BasicMessage{Message: "Manifest Not Found"})
+		return
+	}
+
+	data, err := storage.Store.Get(storage.ManifestKey(manifestID))
+	if err == storage.ErrNotFound {
+		response.JSON(w, http.StatusNotFound, response.BasicMessage{Message: "Manifest PDF Not Found"})
+		return
+	} else if err != nil {
+		response.Error(w, "Get Manifest Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", "inline; filename=\"manifest-"+manifestID+".pdf\"")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// SetCanadaPostContract /canadapost/contract sets the canada post contract the company ships on once canada post
+// confirms the customer holds it and rates a parcel with it, labels bought on it are billed to the contract and the card is charged the platform fee
+// request body has customer_number, contract_id
+func SetCanadaPostContract (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	var body map[string]string
+	err := utils.ParseRequestBody(r, &body, []string{"customer_number", "contract_id"})
+	if err != nil{
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+
+	account := canadaPostAccount{CustomerNumber: body["customer_number"], ContractID: body["contract_id"]}
+	if err = checkCanadaPostContract(tokenClaims.CompanyID, account); err != nil {
+		response.JSON(w, http.StatusBadRequest, response.BasicMessage{Message: "Canada Post Contract Not Valid"})
+		return
+	}
+	if _, err = database.DB.Exec(setCanadaPostContractSql, body["customer_number"], body["contract_id"], tokenClaims.CompanyID); err != nil {
+		response.Error(w, "Set Contract Error")
+		return
+	}
+	response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Canada Post Contract Updated"})
+}
+
+// RemoveCanadaPostContract /canadapost/contract removes the canada post contract so the company ships non-contract
+func RemoveCanadaPostContract (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+
+	if _, err := database.DB.Exec(setCanadaPostContractSql, nil, nil, tokenClaims.CompanyID); err != nil {
+		response.Error(w, "Remove Contract Error")
+		return
+	}
+	response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Canada Post Contract Removed"})
+}
+
+// checkCanadaPostContract util function that checks the contract is one of the contracts canada post has on file
+// for the customer, then rates a parcel from the company address with it, which fails unless the platform may ship
+// for the customer
+func checkCanadaPostContract (companyID string, account canadaPostAccount) error {
+	var customer struct {
+		XMLName        xml.Name `xml:"customer"`
+		CustomerNumber string   `xml:"customer-number"`
+		ContractIDs    []string `xml:"contracts>contract-id"`
+	}
+	err := canadaPostRequest("GET", "https://ct.soa-gw.canadapost.ca/rs/customer/"+url.PathEscape(account.CustomerNumber),
+		"application/vnd.cpc.customer+xml", "application/vnd.cpc.customer+xml", "", &customer)
+	if err != nil {
+		return err
+	}
+	held := false
+	for _, contractID := range customer.ContractIDs {
+		held = held || contractID == account.ContractID
+	}
+	if customer.CustomerNumber != account.CustomerNumber || !held {
+		return &postageError{"Contract Not Held By Customer"}
+	}
+
+	var postalCode string
+	if err := database.DB.QueryRow(getShippingPostalCodeSql, companyID).Scan(&postalCode); err != nil {
+		return err
+	}
+	xmlBody := formatCanadaPostRateBody(account, postalCode, postalCode, "10", "10", "10", "1", nil)
+	var rates response.CanadaPostRatesResponse
+	err = canadaPostRequest("POST", "https://ct.soa-gw.canadapost.ca/rs/ship/price", "application/vnd.cpc.ship.rate-v4+xml", "application/vnd.cpc.ship.rate-v4+xml",
+		xmlBody, &rates)
+	if err != nil {
+		return err
+	}
+	if len(rateResponseToJSON(rates)) == 0 {
+		return &postageError{"No Rates For Contract"}
+	}
+	return nil
+}
+
+// transmittedManifest is a manifest canada post created for a transmitted group with its link and pdf
+type transmittedManifest struct {
+	response.CanadaPostManifest
+	link string
+	pdf  []byte
+}
+
+// transmitCanadaPostGroup util function that transmits a shipment group and fetches the manifest created for it
+func transmitCanadaPostGroup (account canadaPostAccount, source response.Shipper, group string) (transmittedManifest, error) {
+	var manifest transmittedManifest
+	var links response.CanadaPostManifestLinks
+	err := canadaPostRequest("POST", "https://ct.soa-gw.canadapost.ca/rs/"+account.CustomerNumber+"/"+account.CustomerNumber+"/manifest",
+		"application/vnd.cpc.manifest-v8+xml", "application/vnd.cpc.manifest-v8+xml", formatCanadaPostTransmitBody(source, group), &links)
+	if err != nil {
+		return manifest, err
+	}
+	for i := range links.Links {
+		if links.Links[i].Name == "manifest" {
+			manifest.link = links.Links[i].Link
+			break
+		}
+	}
+	if manifest.link == "" {
+		return manifest, &postageError{"No Manifest Link In Transmit"}
+	}
+
+	err = canadaPostRequest("GET", manifest.link, "application/vnd.cpc.manifest-v8+xml", "application/vnd.cpc.manifest-v8+xml", "", &manifest.CanadaPostManifest)
+	if err != nil {
+		return manifest, err
+	}
+	for i := range manifest.Links {
+		if manifest.Links[i].Name == "artifact" {
+			manifest.pdf, err = getCanadaPostDocument(manifest.Links[i].Link, "application/pdf")
+			if err != nil {
+				log.Printf("Get Manifest PDF Error: %s", err.Error())
+			}
+		}
+	}
+	return manifest, nil
+}
+
+// formatCanadaPostTransmitBody formats xml body for transmitting a shipment group from its shipping point
+func formatCanadaPostTransmitBody (source response.Shipper, group string) string {
+	xml := `<?xml version="1.0" encoding="utf-8"?>`
+	xml += `<transmit-set xmlns="http://www.canadapost.ca/ws/manifest-v8">`
+	xml += `<group-ids>`
+	xml += `<group-id>`+escapeXML(group)+`</group-id>`
+	xml += `</group-ids>`
+	xml += `<requested-shipping-point>`+escapeXML(groupShippingPoint(group, source.Address.PostalCode))+`</requested-shipping-point>`
+	xml += `<cpc-pickup-indicator>true</cpc-pickup-indicator>`
+	xml += `<detailed-manifests>true</detailed-manifests>`
+	xml += `<method-of-payment>Account</method-of-payment>`
+	xml += `<manifest-address>`
+	xml += `<manifest-company>`+escapeXML(source.Address.ShipperName)+`</manifest-company>`
+	xml += `<phone-number>`+strconv.Itoa(source.Address.Phone)+`</phone-number>`
+	xml += `<address-details>`
+	xml += `<address-line-1>`+escapeXML(source.Address.Street)+`</address-line-1>`
+	xml += `<city>`+escapeXML(source.Address.City)+`</city>`
+	xml += `<prov-state>`+escapeXML(source.Address.ProvinceCode)+`</prov-state>`
+	xml += `<country-code>CA</country-code>`
+	xml += `<postal-zip-code>`+escapeXML(source.Address.PostalCode)+`</postal-zip-code>`
+	xml += `</address-details>`
+	xml += `</manifest-address>`
+	xml += `</transmit-set>`
+	return xml
+}
@@ -0,0 +1,257 @@
+package controllers
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"go.fromyama/utils"
+	"go.fromyama/utils/database"
+	"go.fromyama/utils/jwtUtil"
+	"go.fromyama/utils/response"
+	"go.fromyama/utils/roles"
+)
+
+const getCompanyMemberSql = "SELECT u.id, u.email, u.name, u.is_approved, COALESCE(u.is_head, false), " + userRoleSql + " FROM users u INNER JOIN employees e on e.user_id = u.id AND e.company_id = u.company_id WHERE u.id = $1 AND u.company_id = $2 AND u.removed_at IS NULL"
+const removeMemberSql = "UPDATE users SET is_approved = false, removed_at = now() WHERE id = $1 AND company_id = $2"
+const deleteEmployeeSql = "DELETE FROM employees WHERE user_id = $1 AND company_id = $2"
+const setMemberHeadSql = "UPDATE users SET is_head = $1, role = $2 WHERE id = $3 AND company_id = $4"
+const lockCompanyHeadSql = "SELECT COALESCE(head_id::text, '') FROM companies WHERE id = $1 FOR UPDATE"
+const addMemberAuditSql = "INSERT INTO member_audit(company_id, actor_id, target_id, action, detail) VALUES ($1, $2, $3, $4, $5)"
+const getMemberAuditSql = "SELECT a.actor_id, COALESCE(actor.email, ''), a.target_id, COALESCE(target.email, ''), a.action, COALESCE(a.detail, ''), a.created_at FROM member_audit a LEFT JOIN users actor on actor.id = a.actor_id LEFT JOIN users target on target.id = a.target_id WHERE a.company_id = $1 ORDER BY a.created_at DESC LIMIT 200"
+
+// Actions recorded in the member audit log
+const (
+	auditApprove = "approve"
+	auditReject = "reject"
+	auditRemove = "remove"
+	auditRole = "role"
+	auditTransferHead = "transfer_head"
+)
+
+// member is a user of the company
+type member struct {
+	ID string
+	Email string
+	Name string
+	Approved bool
+	IsHead bool
+	Role string
+}
+
+// errNotHead is returned when the head of the company changed since the token of the request was signed
+var errNotHead = &userError{"Only The Head Can Transfer The Company"}
+
+// headTransfer is the transaction a head transfer runs in, the head of the company stays locked until it ends
+type headTransfer interface {
+	lockHead(companyID string) (string, error)
+	setHead(companyID, userID string, head bool, role string) error
+	setCompanyHead(companyID, userID string) error
+}
+
+// txHeadTransfer runs a head transfer in a database transaction
+type txHeadTransfer struct {
+	tx *sql.Tx
+}
+
+// execer runs a statement on the database or in a transaction
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// RejectEmployee /employee/{employeeID}/reject turns down a member who signed up to the company and was not approved
+// yet, they can not log in anymore
+// request url has employeeID
+func RejectEmployee (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	m, ok := companyMember(w, tokenClaims, chi.URLParam(r, "employeeID"))
+	if !ok {
+		return
+	}
+	if m.Approved {
+		response.Error(w, "Employee Already Approved, Remove Them Instead")
+		return
+	}
+	if err := removeMember(tokenClaims, m, auditReject); err != nil {
+		response.Error(w, "Reject Employee Error")
+		return
+	}
+	response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Employee Rejected"})
+}
+
+// RemoveEmployee /employee/{employeeID} removes a member from the company and logs them out everywhere, the head
+// has to transfer the company before leaving it
+// request url has employeeID
+func RemoveEmployee (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	m, ok := companyMember(w, tokenClaims, chi.URLParam(r, "employeeID"))
+	if !ok {
+		return
+	}
+	if m.IsHead {
+		response.JSON(w, http.StatusForbidden, response.BasicMessage{Message: "Transfer The Company Before Removing Its Head"})
+		return
+	}
+	if m.ID != tokenClaims.UserID && !roles.CanManage(tokenClaims.Role, m.Role) {
+		response.JSON(w, http.StatusForbidden, response.BasicMessage{Message: "Role Not Permitted"})
+		return
+	}
+	if err := removeMember(tokenClaims, m, auditRemove); err != nil {
+		response.Error(w, "Remove Employee Error")
+		return
+	}
+	response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Employee Removed"})
+}
+
+// TransferHead /transfer-head makes an approved member the head and owner of the company, the previous head stays
+// on as an admin, only the current head can, whatever role an older token of theirs still carries
+// request body has employee_id
+func TransferHead (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	var body map[string]string
+	err := utils.ParseRequestBody(r, &body, []string{"employee_id"})
+	if err != nil{
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+	m, ok := companyMember(w, tokenClaims, body["employee_id"])
+	if !ok {
+		return
+	}
+	if m.ID == tokenClaims.UserID || m.IsHead {
+		response.Error(w, "Employee Is Already The Head")
+		return
+	}
+	if !m.Approved {
+		response.Error(w, "Employee Not Approved")
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		response.Error(w, "Transfer Head Error")
+		return
+	}
+	defer tx.Rollback()
+	err = transferHead(txHeadTransfer{tx}, tokenClaims.CompanyID, tokenClaims.UserID, m.ID)
+	if err == errNotHead {
+		response.JSON(w, http.StatusForbidden, response.BasicMessage{Message: err.Error()})
+		return
+	} else if err != nil {
+		response.Error(w, "Transfer Head Error")
+		return
+	}
+	if err = auditMemberAction(tx, tokenClaims, m.ID, auditTransferHead, ""); err != nil {
+		response.Error(w, "Transfer Head Error")
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		response.Error(w, "Transfer Head Error")
+		return
+	}
+	response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Head Transferred"})
+}
+
+// GetMemberAudit /employee/audit returns the latest approvals, rejections, removals, role changes and head
+// transfers in the company, newest first
+func GetMemberAudit (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	rows, err := database.DB.Query(getMemberAuditSql, tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Get Audit Error")
+		return
+	}
+	defer rows.Close()
+	entries := []response.AuditEntry{}
+	for rows.Next() {
+		var e response.AuditEntry
+		if err = rows.Scan(&e.ActorID, &e.ActorEmail, &e.TargetID, &e.TargetEmail, &e.Action, &e.Detail, &e.CreatedAt); err != nil {
+			response.Error(w, "Get Audit Error")
+			return
+		}
+		entries = append(entries, e)
+	}
+	response.JSON(w, http.StatusOK, entries)
+}
+
+// companyMember util function that loads a member of the company of the token, every handler changing a member
+// goes through it so members of other companies look like they do not exist, it answers the request itself and
+// returns false when the member can not be loaded
+func companyMember (w http.ResponseWriter, tokenClaims jwtUtil.TokenClaims, userID string) (member, bool) {
+	var m member
+	err := database.DB.QueryRow(getCompanyMemberSql, userID, tokenClaims.CompanyID).Scan(&m.ID, &m.Email, &m.Name, &m.Approved, &m.IsHead, &m.Role)
+	if err == sql.ErrNoRows {
+		response.JSON(w, http.StatusNotFound, response.BasicMessage{Message: "Employee Not Found"})
+		return m, false
+	} else if err != nil {
+		response.Error(w, "Get Employee Error")
+		return m, false
+	}
+	return m, true
+}
+
+// removeMember util function that takes a member out of the company and ends their sessions, the user is kept so
+// the labels they bought still name them but their email is free to be invited or sign up again
+func removeMember (tokenClaims jwtUtil.TokenClaims, m member, action string) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err = tx.Exec(removeMemberSql, m.ID, tokenClaims.CompanyID); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(deleteEmployeeSql, m.ID, tokenClaims.CompanyID); err != nil {
+		return err
+	}
+	if err = auditMemberAction(tx, tokenClaims, m.ID, action, ""); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	return revokeUserSessions(m.ID)
+}
+
+// transferHead util function that makes newHeadID the head and owner of the company in place of callerID, the
+// head is read under lock so a caller whose token still says owner after handing the company over can not hand it
+// over again
+func transferHead (t headTransfer, companyID, callerID, newHeadID string) error {
+	headID, err := t.lockHead(companyID)
+	if err != nil {
+		return err
+	}
+	if headID != callerID {
+		return errNotHead
+	}
+	if err = t.setHead(companyID, headID, false, roles.Admin); err != nil {
+		return err
+	}
+	if err = t.setHead(companyID, newHeadID, true, roles.Owner); err != nil {
+		return err
+	}
+	return t.setCompanyHead(companyID, newHeadID)
+}
+
+func (t txHeadTransfer) lockHead(companyID string) (string, error) {
+	var headID string
+	err := t.tx.QueryRow(lockCompanyHeadSql, companyID).Scan(&headID)
+	return headID, err
+}
+
+func (t txHeadTransfer) setHead(companyID, userID string, head bool, role string) error {
+	_, err := t.tx.Exec(setMemberHeadSql, head, role, userID, companyID)
+	return err
+}
+
+func (t txHeadTransfer) setCompanyHead(companyID, userID string) error {
+	_, err := t.tx.Exec(setCompanyHeadSql, userID, companyID)
+	return err
+}
+
+// auditMemberAction util function that records a change the user of the token made to a member
+func auditMemberAction (db execer, tokenClaims jwtUtil.TokenClaims, targetID, action, detail string) error {
+	_, err := db.Exec(addMemberAuditSql, tokenClaims.CompanyID, tokenClaims.UserID, targetID, action, nullString(detail))
+	return err
+}
@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"testing"
+
+	"go.fromyama/utils/roles"
+)
+
+// memoryHeadTransfer keeps the head and the roles of a company the way the database does
+type memoryHeadTransfer struct {
+	head  string
+	roles map[string]string
+	heads map[string]bool
+}
+
+func (t *memoryHeadTransfer) lockHead(string) (string, error) {
+	return t.head, nil
+}
+
+func (t *memoryHeadTransfer) setHead(_, userID string, head bool, role string) error {
+	t.heads[userID], t.roles[userID] = head, role
+	return nil
+}
+
+func (t *memoryHeadTransfer) setCompanyHead(_, userID string) error {
+	t.head = userID
+	return nil
+}
+
+func TestTransferHeadTwice(t *testing.T) {
+	company := &memoryHeadTransfer{
+		head:  "a",
+		roles: map[string]string{"a": roles.Owner, "b": roles.Admin, "c": roles.Shipper},
+		heads: map[string]bool{"a": true},
+	}
+	if err := transferHead(company, "company-1", "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	// a still has a token saying owner, the company is b's now
+	if err := transferHead(company, "company-1", "a", "c"); err != errNotHead {
+		t.Errorf("second transfer got %v, want %v", err, errNotHead)
+	}
+
+	if company.head != "b" {
+		t.Errorf("got head %s, want b", company.head)
+	}
+	want := map[string]string{"a": roles.Admin, "b": roles.Owner, "c": roles.Shipper}
+	for id, role := range want {
+		if company.roles[id] != role || company.heads[id] != (id == "b") {
+			t.Errorf("%s: got %s head %v, want %s head %v", id, company.roles[id], company.heads[id], role, id == "b")
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.fromyama/utils"
+	"go.fromyama/utils/database"
+	"go.fromyama/utils/jwtUtil"
+	"go.fromyama/utils/response"
+)
+
+const getCompanyShippingOptionsSql = "SELECT COALESCE(shipping_options, $2) FROM companies WHERE id = $1"
+const setCompanyShippingOptionsSql = "UPDATE companies SET shipping_options = $1 WHERE id = $2"
+
+// canada post option codes of the shipping options a label can be bought with
+const (
+	optionDeliveryConfirmation = "DC"
+	optionSignature            = "SO"
+	optionCoverage             = "COV"
+	optionProofOfAge18         = "PA18"
+	optionProofOfAge19         = "PA19"
+	optionCardForPickup        = "HFP"
+	optionCOD                  = "COD"
+	optionDoNotSafeDrop        = "DNS"
+)
+
+// shippingOptionNames maps the option names requests use to canada post option codes
+var shippingOptionNames = map[string]string{
+	"delivery_confirmation": optionDeliveryConfirmation,
+	"signature":             optionSignature,
+	"coverage":              optionCoverage,
+	"proof_of_age_18":       optionProofOfAge18,
+	"proof_of_age_19":       optionProofOfAge19,
+	"card_for_pickup":       optionCardForPickup,
+	"cod":                   optionCOD,
+	"do_not_safe_drop":      optionDoNotSafeDrop,
+}
+
+// defaultShippingOptions are the options of a company that never set its own, labels get delivery confirmation
+const defaultShippingOptions = optionDeliveryConfirmation
+
+// shippingOptionAmounts are the options that need an amount and the request field it is read from
+var shippingOptionAmounts = map[string]string{
+	optionCoverage: "coverage_amount",
+	optionCOD:      "cod_amount",
+}
+
+// shippingOptionConflicts are options that can not be bought together
+var shippingOptionConflicts = [][2]string{
+	{optionProofOfAge18, optionProofOfAge19},
+	{optionCardForPickup, optionDoNotSafeDrop},
+}
+
+// serviceOptions are the options each canada post service supports, services are matched by their code
+// prefix when there is no entry for the full code
+var serviceOptions = map[string][]string{
+	"DOM":    {optionDeliveryConfirmation, optionSignature, optionCoverage, optionProofOfAge18, optionProofOfAge19, optionCardForPickup, optionCOD, optionDoNotSafeDrop},
+	"USA.EP": {optionSignature, optionCoverage},
+	"USA.XP": {optionSignature, optionCoverage},
+	"USA.PW": {optionSignature, optionCoverage},
+	"USA.TP": {optionSignature, optionCoverage},
+	"USA.SP": {},
+	"INT.XP": {optionSignature, optionCoverage},
+	"INT.IP": {optionSignature, optionCoverage},
+	"INT.TP": {optionSignature, optionCoverage},
+	"INT.PW": {optionSignature, optionCoverage},
+	"INT.SP": {},
+}
+
+// shippingOption is a canada post option code with its amount for coverage and cod
+type shippingOption struct {
+	Code   string
+	Amount string
+}
+
+// SetShippingOptions /shipping/options sets the shipping options used when a label request does not give any,
+// delivery_confirmation until a company sets its own
+// request body has options (comma separated delivery_confirmation, signature, coverage, proof_of_age_18,
+// proof_of_age_19, card_for_pickup, cod, do_not_safe_drop), optionally coverage_amount, cod_amount
+func SetShippingOptions (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	var body map[string]string
+	err := utils.ParseRequestBody(r, &body, []string{"options"})
+	if err != nil {
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+	options, err := parseShippingOptions(body)
+	if err != nil {
+		response.Error(w, err.Error())
+		return
+	}
+
+	setOptionsQuery, err := database.DB.Prepare(setCompanyShippingOptionsSql)
+	if err != nil {
+		response.Error(w, "Set Shipping Options Error")
+		return
+	}
+	defer setOptionsQuery.Close()
+	if _, err = setOptionsQuery.Exec(formatShippingOptions(options), tokenClaims.CompanyID); err != nil {
+		response.Error(w, "Set Shipping Options Error")
+		return
+	}
+	response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Shipping Options Updated"})
+}
+
+// resolveShippingOptions util function that returns the options a label request asks for, falling back to the
+// company default options when the request has no options field, and checks them against the service, a default
+// delivery confirmation is left out for services outside canada that do not offer it
+func resolveShippingOptions (companyID string, body map[string]string) ([]shippingOption, error) {
+	var options []shippingOption
+	var err error
+	if _, ok := body["options"]; ok {
+		options, err = parseShippingOptions(body)
+	} else {
+		options, err = getCompanyShippingOptions(companyID)
+		for i := 0; err == nil && i < len(options); i++ {
+			if options[i].Code == optionDeliveryConfirmation && !serviceSupportsOption(body["service_code"], optionDeliveryConfirmation) {
+				options = append(options[:i], options[i+1:]...)
+				i--
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = checkServiceOptions(body["service_code"], options); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// getCompanyShippingOptions util function that returns the default shipping options of a company
+func getCompanyShippingOptions (companyID string) ([]shippingOption, error) {
+	var stored string
+	getOptionsQuery, err := database.DB.Prepare(getCompanyShippingOptionsSql)
+	if err != nil {
+		return nil, err
+	}
+	defer getOptionsQuery.Close()
+	if err = getOptionsQuery.QueryRow(companyID, defaultShippingOptions).Scan(&stored); err != nil {
+		return nil, err
+	}
+
+	var options []shippingOption
+	for _, field := range strings.Split(stored, ",") {
+		if field == "" {
+			continue
+		}
+		parts := strings.SplitN(field, ":", 2)
+		option := shippingOption{Code: parts[0]}
+		if len(parts) == 2 {
+			option.Amount = parts[1]
+		}
+		options = append(options, option)
+	}
+	return options, nil
+}
+
+// parseShippingOptions util function that reads the comma separated option names of a request body and the
+// amounts the options need
+func parseShippingOptions (body map[string]string) ([]shippingOption, error) {
+	var options []shippingOption
+	seen := map[string]bool{}
+	for _, name := range strings.Split(body["options"], ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		code, ok := shippingOptionNames[name]
+		if !ok {
+			return nil, &postageError{"Unknown Shipping Option " + name}
+		}
+		if seen[code] {
+			continue
+		}
+		seen[code] = true
+
+		option := shippingOption{Code: code}
+		if field, ok := shippingOptionAmounts[code]; ok {
+			amount, err := strconv.ParseFloat(body[field], 64)
+			if err != nil || amount <= 0 {
+				return nil, &postageError{"Shipping Option " + name + " Needs " + field}
+			}
+			option.Amount = strconv.FormatFloat(amount, 'f', 2, 64)
+		}
+		options = append(options, option)
+	}
+
+	for _, conflict := range shippingOptionConflicts {
+		if seen[conflict[0]] && seen[conflict[1]] {
+			return nil, &postageError{"Shipping Options " + conflict[0] + " And " + conflict[1] + " Can Not Be Combined"}
+		}
+	}
+	return options, nil
+}
+
+// formatShippingOptions util function that formats options the way they are stored for a company
+func formatShippingOptions (options []shippingOption) string {
+	fields := make([]string, len(options))
+	for i, option := range options {
+		fields[i] = option.Code
+		if option.Amount != "" {
+			fields[i] += ":" + option.Amount
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+// checkServiceOptions util function that returns an error if the service does not support one of the options
+func checkServiceOptions (serviceCode string, options []shippingOption) error {
+	for _, option := range options {
+		if !serviceSupportsOption(serviceCode, option.Code) {
+			return &postageError{"Shipping Option " + option.Code + " Not Available For " + serviceCode}
+		}
+	}
+	return nil
+}
+
+// serviceSupportsOption util function that returns if a canada post service supports an option code
+func serviceSupportsOption (serviceCode, code string) bool {
+	supported, ok := serviceOptions[serviceCode]
+	for prefix := serviceCode; !ok && prefix != ""; {
+		i := strings.LastIndex(prefix, ".")
+		if i < 0 {
+			break
+		}
+		prefix = prefix[:i]
+		supported, ok = serviceOptions[prefix]
+	}
+	for _, s := range supported {
+		if s == code {
+			return true
+		}
+	}
+	return false
+}
+
+// formatCanadaPostOptions util function that forms the options xml of a rate or shipment request
+func formatCanadaPostOptions (options []shippingOption) string {
+	if len(options) == 0 {
+		return ""
+	}
+	xml := `<options>`
+	for _, option := range options {
+		xml += `<option>`
+		xml += `<option-code>` + option.Code + `</option-code>`
+		if option.Amount != "" {
+			xml += `<option-amount>` + option.Amount + `</option-amount>`
+		}
+		xml += `</option>`
+	}
+	xml += `</options>`
+	return xml
+}
@@ -0,0 +1,227 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go.fromyama/utils"
+	"go.fromyama/utils/database"
+	"go.fromyama/utils/jwtUtil"
+	"go.fromyama/utils/pdf"
+	"go.fromyama/utils/response"
+	"go.fromyama/utils/storage"
+)
+
+const getBrandingSql = "SELECT company_name, street, city, province_code, country, postal_code, COALESCE(logo_url, ''), COALESCE(slip_message, '') FROM companies WHERE id = $1"
+const setBrandingSql = "UPDATE companies SET logo_url = $1, slip_message = $2 WHERE id = $3"
+const getOrderLabelSql = "SELECT id FROM labels WHERE company_id = $1 AND order_id = $2 AND voided_at IS NULL AND NOT COALESCE(is_return, false) ORDER BY created_at DESC LIMIT 1"
+
+const maxDocumentOrders = 250
+
+// papers are the page sizes in inches packing slips can be printed on
+var papers = map[string][2]float64{
+	"letter": {8.5, 11},
+	"4x6":    {4, 6},
+}
+
+type documentError struct {
+	s string
+}
+
+func (e *documentError) Error() string {
+	return e.s
+}
+
+// SetBranding /branding sets the logo and the message printed on packing slips, a field left out is cleared
+// request body has optionally logo_url (https), slip_message
+func SetBranding (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	var body map[string]string
+	err := utils.ParseRequestBody(r, &body, nil)
+	if err != nil{
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+	if logo := body["logo_url"]; logo != "" {
+		if u, err := url.Parse(logo); err != nil || u.Scheme != "https" || u.Host == "" {
+			response.Error(w, "Logo URL Must Be An https URL")
+			return
+		}
+	}
+	if len(body["slip_message"]) > 500 {
+		response.Error(w, "Slip Message Too Long, Max 500 Characters")
+		return
+	}
+
+	var logo, message *string
+	if body["logo_url"] != "" {
+		l := body["logo_url"]
+		logo = &l
+	}
+	if body["slip_message"] != "" {
+		m := body["slip_message"]
+		message = &m
+	}
+	setBrandingQuery, err := database.DB.Prepare(setBrandingSql)
+	if err != nil {
+		response.Error(w, "Set Branding Error")
+		return
+	}
+	defer setBrandingQuery.Close()
+	if _, err = setBrandingQuery.Exec(logo, message, tokenClaims.CompanyID); err != nil {
+		response.Error(w, "Set Branding Error")
+		return
+	}
+	response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Branding Updated"})
+}
+
+// GetPackingSlips /packing-slips returns a pdf with a packing slip page for every order, branded with the
+// company logo and slip message, the slip of an order that has a label is also stored with the label documents
+// request body has orders as returned by /orders/all, optionally paper (letter, 4x6)
+func GetPackingSlips (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+
+	body, err := parseOrderDocumentRequest(r)
+	if err != nil {
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+	if body.Paper == "" {
+		body.Paper = "letter"
+	}
+	paper, ok := papers[body.Paper]
+	if !ok {
+		response.Error(w, "Unknown Paper " + body.Paper)
+		return
+	}
+	branding, err := getBranding(tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Get Branding Error")
+		return
+	}
+
+	doc, err := renderDocument("assets/templates/packingSlip.html", response.PackingSlips{Branding: branding, Orders: body.Orders}, paper)
+	if err != nil {
+		response.Error(w, "Render Packing Slips Error")
+		return
+	}
+	storePackingSlips(tokenClaims.CompanyID, branding, body.Orders, paper)
+	writeDocument(w, "packing-slips", doc)
+}
+
+// GetPickList /pick-lists returns a pdf pick list of the items of every order, consolidated by sku
+// request body has orders as returned by /orders/all
+func GetPickList (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+
+	body, err := parseOrderDocumentRequest(r)
+	if err != nil {
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+	branding, err := getBranding(tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Get Branding Error")
+		return
+	}
+
+	pickList := response.PickList{
+		Branding: branding,
+		CreatedAt: time.Now().Format("2006-01-02 15:04"),
+		OrderCount: len(body.Orders),
+		Lines: utils.PickList(body.Orders),
+	}
+	for _, line := range pickList.Lines {
+		pickList.UnitCount += line.Quantity
+	}
+	doc, err := renderDocument("assets/templates/pickList.html", pickList, papers["letter"])
+	if err != nil {
+		response.Error(w, "Render Pick List Error")
+		return
+	}
+	writeDocument(w, "pick-list", doc)
+}
+
+// storePackingSlips util function that saves the slip of every order with a label in the blob store under that label
+func storePackingSlips (companyID string, branding response.Branding, orders []response.Order, paper [2]float64) {
+	getOrderLabelQuery, err := database.DB.Prepare(getOrderLabelSql)
+	if err != nil {
+		log.Printf("Store Packing Slips Error: %s", err.Error())
+		return
+	}
+	defer getOrderLabelQuery.Close()
+	for _, order := range orders {
+		if order.OrderID == "" {
+			continue
+		}
+		var labelID string
+		if err = getOrderLabelQuery.QueryRow(companyID, order.OrderID).Scan(&labelID); err != nil {
+			if err != sql.ErrNoRows {
+				log.Printf("Get Order %s Label Error: %s", order.OrderID, err.Error())
+			}
+			continue
+		}
+		slip, err := renderDocument("assets/templates/packingSlip.html", response.PackingSlips{Branding: branding, Orders: []response.Order{order}}, paper)
+		if err == nil {
+			err = storeLabelDocument(companyID, labelID, storage.KindPackingSlip, "application/pdf", slip)
+		}
+		if err != nil {
+			log.Printf("Store Packing Slip %s Error: %s", labelID, err.Error())
+		}
+	}
+}
+
+// parseOrderDocumentRequest util function that decodes the orders a document is printed for
+func parseOrderDocumentRequest (r *http.Request) (response.OrderDocumentRequest, error) {
+	var body response.OrderDocumentRequest
+	err := json.NewDecoder(r.Body).Decode(&body)
+	defer r.Body.Close()
+	if err != nil {
+		return body, err
+	}
+	if len(body.Orders) == 0 {
+		return body, &documentError{"orders Missing"}
+	}
+	if len(body.Orders) > maxDocumentOrders {
+		return body, &documentError{"Too Many Orders, Max " + strconv.Itoa(maxDocumentOrders)}
+	}
+	return body, nil
+}
+
+// getBranding util function that returns the company name, address, logo and slip message
+func getBranding (companyID string) (response.Branding, error) {
+	var b response.Branding
+	getBrandingQuery, err := database.DB.Prepare(getBrandingSql)
+	if err != nil {
+		return b, err
+	}
+	defer getBrandingQuery.Close()
+	err = getBrandingQuery.QueryRow(companyID).Scan(&b.CompanyName, &b.Address.Street, &b.Address.City, &b.Address.ProvinceCode, &b.Address.Country, &b.Address.PostalCode, &b.LogoURL, &b.Message)
+	b.Address.ShipperName = b.CompanyName
+	return b, err
+}
+
+// renderDocument util function that executes an html template and prints it on paper sized pages
+func renderDocument (templateFile string, data interface{}, paper [2]float64) ([]byte, error) {
+	var tmplBuffer bytes.Buffer
+	tmpl := template.Must(template.ParseFiles(templateFile))
+	if err := tmpl.Execute(&tmplBuffer, data); err != nil {
+		return nil, err
+	}
+	return pdf.FromHTML(tmplBuffer.Bytes(), paper[0], paper[1])
+}
+
+// writeDocument util function that writes a generated pdf
+func writeDocument (w http.ResponseWriter, name string, doc []byte) {
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", "inline; filename=\""+name+"-"+time.Now().Format("20060102-150405")+".pdf\"")
+	w.WriteHeader(http.StatusOK)
+	w.Write(doc)
+}
@@ -0,0 +1,401 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"go.fromyama/utils"
+	"go.fromyama/utils/carriers"
+	"go.fromyama/utils/database"
+	"go.fromyama/utils/jwtUtil"
+	"go.fromyama/utils/packing"
+	"go.fromyama/utils/response"
+)
+
+const updateParcelSql = "UPDATE parcel_options SET length = $1, width = $2, height = $3, name = $4, weight = $5, empty_weight = $6 WHERE id = $7 AND company_id = $8"
+const deleteParcelSql = "DELETE FROM parcel_options WHERE id = $1 AND company_id = $2"
+const setDefaultParcelSql = "UPDATE parcel_options SET is_default = (id = $1) WHERE company_id = $2 AND EXISTS (SELECT 1 FROM parcel_options WHERE id = $1 AND company_id = $2)"
+
+type parcelError struct {
+	s string
+}
+
+func (e *parcelError) Error() string {
+	return e.s
+}
+
+// UpdateParcel /parcels/{parcelID} replaces the dimensions, name and weights of a parcel option
+// request url has parcelID
+// request body has length, width, height, name, weight, optionally empty_weight
+func UpdateParcel (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	var body map[string]string
+	err := utils.ParseRequestBody(r, &body, []string{"length", "width", "height", "name", "weight"})
+	if err != nil{
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+	parcel, err := parcelOptionFromBody(body)
+	if err != nil {
+		response.Error(w, err.Error())
+		return
+	}
+	res, err := database.DB.Exec(updateParcelSql, parcel.Length, parcel.Width, parcel.Height, parcel.Name, parcel.Weight, parcel.EmptyWeight, chi.URLParam(r, "parcelID"), tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Update Parcel Error")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		response.JSON(w, http.StatusNotFound, response.BasicMessage{Message: "Parcel Not Found"})
+		return
+	}
+	response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Parcel Updated"})
+}
+
+// DeleteParcel /parcels/{parcelID} removes a parcel option, the company has no default parcel after the default
+// one is removed
+// request url has parcelID
+func DeleteParcel (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	res, err := database.DB.Exec(deleteParcelSql, chi.URLParam(r, "parcelID"), tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Delete Parcel Error")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		response.JSON(w, http.StatusNotFound, response.BasicMessage{Message: "Parcel Not Found"})
+		return
+	}
+	response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Parcel Deleted"})
+}
+
+// SetDefaultParcel /parcels/{parcelID}/default makes a parcel option the company default, the parcel used when a
+// rate or label request has no dimensions
+// request url has parcelID
+func SetDefaultParcel (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	err := setDefaultParcel(tokenClaims.CompanyID, chi.URLParam(r, "parcelID"))
+	if _, ok := err.(*parcelError); ok {
+		response.JSON(w, http.StatusNotFound, response.BasicMessage{Message: err.Error()})
+		return
+	} else if err != nil {
+		response.Error(w, "Set Default Parcel Error")
+		return
+	}
+	response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Default Parcel Set"})
+}
+
+// PackItems /pack chooses the smallest of the company parcels that hold the items, splitting them over several
+// parcels when none does, and rates the packed parcels when a destination is given
+// request body has items (sku, quantity, length, width, height in cm, weight in kg, the dimensions and weight left
+// out are taken from the product catalog), optionally parcel_ids to pack in instead of every company parcel,
+// carrier (canadapost, purolator, ups, fedex) and destination with the fields of /rates/{carrier} other than the parcel
+// and location_id of the location it ships from
+func PackItems (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+
+	var body response.PackRequest
+	err := json.NewDecoder(r.Body).Decode(&body)
+	defer r.Body.Close()
+	if err != nil {
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+	if len(body.Items) == 0 {
+		response.Error(w, "Body Parse Error, items Missing")
+		return
+	}
+
+	boxes, err := getPackingBoxes(tokenClaims.CompanyID, body.ParcelIDs)
+	if err != nil {
+		response.Error(w, "Get Parcel Error")
+		return
+	}
+	var items []packing.Item
+	for _, item := range body.Items {
+		if item.Length <= 0 || item.Width <= 0 || item.Height <= 0 || item.Weight <= 0 {
+			if err = fillItemFromProduct(tokenClaims.CompanyID, &item); err != nil {
+				response.Error(w, "Get Product Error")
+				return
+			}
+		}
+		items = append(items, packing.Item{SKU: item.Sku, Length: item.Length, Width: item.Width, Height: item.Height, Weight: item.Weight, Quantity: item.Quantity})
+	}
+	packages, err := packing.Pack(items, boxes)
+	if err != nil {
+		response.Error(w, "Packing Error, " + err.Error())
+		return
+	}
+
+	result := response.Packing{Packages: []response.PackedParcel{}, Rates: []response.PackRate{}}
+	for _, pkg := range packages {
+		result.Packages = append(result.Packages, packageToJSON(pkg))
+	}
+	if body.Destination["postal_code"] != "" {
+		if body.Carrier == "" {
+			body.Carrier = carriers.CanadaPost
+		}
+		result.Rates, err = ratePackages(tokenClaims.CompanyID, body.Carrier, body.Destination, result.Packages)
+		if err != nil {
+			response.Error(w, "Get Rate Error, " + err.Error())
+			return
+		}
+	}
+	response.JSON(w, http.StatusOK, result)
+}
+
+// parcelOptionFromBody util function that reads and checks a parcel option from a request body
+func parcelOptionFromBody (body map[string]string) (response.Parcel, error) {
+	parcel := parcelFromBody(body)
+	parcel.Name = body["name"]
+	if parcel.Length <= 0 || parcel.Width <= 0 || parcel.Height <= 0 || parcel.Weight <= 0 {
+		return parcel, &parcelError{"Parcel Dimensions And Weight Must Be Positive Numbers"}
+	}
+	if body["empty_weight"] != "" {
+		var err error
+		if parcel.EmptyWeight, err = strconv.ParseFloat(body["empty_weight"], 64); err != nil || parcel.EmptyWeight < 0 {
+			return parcel, &parcelError{"Parcel Empty Weight Must Be A Positive Number"}
+		}
+	}
+	return parcel, nil
+}
+
+// setDefaultParcel util function that makes parcelID the only default parcel of the company
+func setDefaultParcel (companyID, parcelID string) error {
+	res, err := database.DB.Exec(setDefaultParcelSql, parcelID, companyID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return &parcelError{"Parcel Not Found"}
+	}
+	return nil
+}
+
+// fillItemFromProduct util function that takes the dimensions and weight an item to pack was sent without from the
+// catalog product with its sku
+func fillItemFromProduct (companyID string, item *response.PackItem) error {
+	product, ok, err := getProduct(companyID, item.Sku)
+	if err != nil || !ok {
+		return err
+	}
+	if item.Length <= 0 || item.Width <= 0 || item.Height <= 0 {
+		item.Length, item.Width, item.Height = product.Length, product.Width, product.Height
+	}
+	if item.Weight <= 0 {
+		item.Weight = product.Weight
+	}
+	return nil
+}
+
+// getPackingBoxes util function that returns the company parcels to pack in, only those in parcelIDs when set
+func getPackingBoxes (companyID string, parcelIDs []string) ([]packing.Box, error) {
+	wanted := map[string]bool{}
+	for _, id := range parcelIDs {
+		wanted[id] = true
+	}
+	getParcelQuery, err := database.DB.Prepare(getParcelSql)
+	if err != nil {
+		return nil, err
+	}
+	defer getParcelQuery.Close()
+	rows, err := getParcelQuery.Query(companyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var boxes []packing.Box
+	for rows.Next() {
+		var p response.Parcel
+		if err = rows.Scan(&p.ID, &p.Name, &p.Length, &p.Width, &p.Height, &p.Weight, &p.EmptyWeight, &p.Default); err != nil {
+			return nil, err
+		}
+		if len(wanted) > 0 && !wanted[p.ID] {
+			continue
+		}
+		boxes = append(boxes, packing.Box{ID: p.ID, Name: p.Name, Length: p.Length, Width: p.Width, Height: p.Height, EmptyWeight: p.EmptyWeight})
+	}
+	return boxes, rows.Err()
+}
+
+// packageToJSON util function that converts a packed box to json with the quantity of every sku in it
+func packageToJSON (pkg packing.Package) response.PackedParcel {
+	packed := response.PackedParcel{
+		Parcel: response.Parcel{ID: pkg.Box.ID, Name: pkg.Box.Name, Length: pkg.Box.Length, Width: pkg.Box.Width, Height: pkg.Box.Height, Weight: pkg.Weight},
+		Weight: pkg.Weight,
+		Utilization: pkg.Utilization,
+		Items: []response.PackedItem{},
+	}
+	quantities := pkg.Quantities()
+	for _, placement := range pkg.Placements {
+		if quantity, ok := quantities[placement.SKU]; ok {
+			packed.Items = append(packed.Items, response.PackedItem{Sku: placement.SKU, Quantity: quantity})
+			delete(quantities, placement.SKU)
+		}
+	}
+	return packed
+}
+
+// ratePackages util function that rates every packed parcel to dest and returns the services offered for all of
+// them with the total customer price
+func ratePackages (companyID, carrierName string, dest map[string]string, packages []response.PackedParcel) ([]response.PackRate, error) {
+	var rated [][]response.PackRate
+	for _, pkg := range packages {
+		parcelBody := map[string]string{}
+		for k, v := range dest {
+			parcelBody[k] = v
+		}
+		parcelBody["length"] = strconv.FormatFloat(pkg.Parcel.Length, 'f', 1, 64)
+		parcelBody["width"] = strconv.FormatFloat(pkg.Parcel.Width, 'f', 1, 64)
+		parcelBody["height"] = strconv.FormatFloat(pkg.Parcel.Height, 'f', 1, 64)
+		parcelBody["weight"] = strconv.FormatFloat(pkg.Weight, 'f', 3, 64)
+
+		var rates []response.PackRate
+		var err error
+		if carrierName == carriers.CanadaPost {
+			rates, err = rateCanadaPostPackage(companyID, parcelBody)
+		} else {
+			rates, err = rateCarrierPackage(companyID, carrierName, parcelBody)
+		}
+		if err != nil {
+			return nil, err
+		}
+		rated = append(rated, rates)
+	}
+	return combinePackageRates(rated), nil
+}
+
+// rateCanadaPostPackage util function that prices one parcel with canada post
+func rateCanadaPostPackage (companyID string, body map[string]string) ([]response.PackRate, error) {
+	var source response.PostageAddress
+	getShippingInfoQuery, err := database.DB.Prepare(getShippingPostalCodeSql)
+	if err != nil {
+		return nil, err
+	}
+	defer getShippingInfoQuery.Close()
+	if err = getShippingInfoQuery.QueryRow(companyID).Scan(&source.PostalCode); err != nil {
+		return nil, err
+	}
+	if err = shipFrom(companyID, body, &source); err != nil {
+		return nil, err
+	}
+	account, err := getCanadaPostAccount(companyID)
+	if err != nil {
+		return nil, err
+	}
+	var options []shippingOption
+	if _, ok := body["options"]; ok {
+		options, err = parseShippingOptions(body)
+	} else {
+		options, err = getCompanyShippingOptions(companyID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	companyPrices, err := getCompanyPricing(companyID, account)
+	if err != nil {
+		return nil, err
+	}
+
+	xmlBody := formatCanadaPostRateBody(account, source.PostalCode, body["postal_code"], body["length"], body["width"], body["height"], body["weight"], options)
+	var resp response.CanadaPostRatesResponse
+	err = canadaPostRequest("POST", "https://ct.soa-gw.canadapost.ca/rs/ship/price", "application/vnd.cpc.ship.rate-v4+xml", "application/vnd.cpc.ship.rate-v4+xml",
+		xmlBody, &resp)
+	if err != nil {
+		return nil, err
+	}
+	var canadaPostRates []response.CanadaPostRate
+	for _, rate := range rateResponseToJSON(resp) {
+		if checkServiceOptions(rate.ServiceCode, options) == nil {
+			canadaPostRates = append(canadaPostRates, rate)
+		}
+	}
+	priceCanadaPostRates(companyPrices, canadaPostRates)
+	var rates []response.PackRate
+	for _, rate := range canadaPostRates {
+		price, _ := strconv.ParseFloat(rate.PriceDetails.Due, 64)
+		rates = append(rates, response.PackRate{Carrier: carriers.CanadaPost, ServiceCode: rate.ServiceCode, ServiceName: rate.ServiceName, Price: price})
+	}
+	return rates, nil
+}
+
+// rateCarrierPackage util function that prices one parcel with a carrier other than canada post
+func rateCarrierPackage (companyID, carrierName string, body map[string]string) ([]response.PackRate, error) {
+	carrier, err := getCarrier(carrierName)
+	if err != nil {
+		return nil, err
+	}
+	dest := postageAddressFromBody(body)
+	if dest.Country == "" {
+		dest.Country = "CA"
+	}
+	var source response.Shipper
+	getShippingInfoQuery, err := database.DB.Prepare(getShippingInfoSql)
+	if err != nil {
+		return nil, err
+	}
+	defer getShippingInfoQuery.Close()
+	err = getShippingInfoQuery.QueryRow(companyID).Scan(&source.Address.ShipperName, &source.Address.Street, &source.Address.City, &source.Address.ProvinceCode, &source.Address.Country, &source.Address.PostalCode, &source.Address.Phone)
+	if err != nil {
+		return nil, err
+	}
+	if err = shipFrom(companyID, body, &source.Address); err != nil {
+		return nil, err
+	}
+	account, err := getCanadaPostAccount(companyID)
+	if err != nil {
+		return nil, err
+	}
+	companyPrices, err := getCompanyPricing(companyID, account)
+	if err != nil {
+		return nil, err
+	}
+
+	carrierRates, err := carrier.Rates(carrierRateRequest(source.Address, dest, body))
+	if err != nil {
+		return nil, err
+	}
+	var rates []response.PackRate
+	for _, rate := range carrierRates {
+		price := companyPrices.price(carrier.Name(), rate.ServiceCode, rate.Total)
+		rates = append(rates, response.PackRate{Carrier: carrier.Name(), ServiceCode: rate.ServiceCode, ServiceName: rate.ServiceName, Price: float64(price)/100.0})
+	}
+	return rates, nil
+}
+
+// combinePackageRates util function that keeps the services every package was rated for, in the order of the
+// first package, summing their prices
+func combinePackageRates (rated [][]response.PackRate) []response.PackRate {
+	combined := []response.PackRate{}
+	if len(rated) == 0 {
+		return combined
+	}
+	for _, first := range rated[0] {
+		rate := first
+		rate.PackagePrices = []float64{first.Price}
+		offered := true
+		for _, rates := range rated[1:] {
+			found := false
+			for _, other := range rates {
+				if other.ServiceCode == first.ServiceCode {
+					rate.Price += other.Price
+					rate.PackagePrices = append(rate.PackagePrices, other.Price)
+					found = true
+					break
+				}
+			}
+			if !found {
+				offered = false
+				break
+			}
+		}
+		if offered {
+			rate.Price = float64(int64(rate.Price*100+0.5))/100.0
+			combined = append(combined, rate)
+		}
+	}
+	return combined
+}
@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+
+	"go.fromyama/utils"
+	"go.fromyama/utils/database"
+	"go.fromyama/utils/jwtUtil"
+	"go.fromyama/utils/response"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const addUserTokenSql = "INSERT INTO user_tokens(user_id, purpose, nonce, expires_at) VALUES ($1, $2, $3, $4)"
+const expireUserTokensSql = "UPDATE user_tokens SET used_at = now() WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL"
+const useUserTokenSql = "UPDATE user_tokens SET used_at = now() WHERE user_id = $1 AND purpose = $2 AND nonce = $3 AND used_at IS NULL AND expires_at > now()"
+const isUserTokenLiveSql = "SELECT exists(SELECT 1 FROM user_tokens WHERE user_id = $1 AND purpose = $2 AND nonce = $3 AND used_at IS NULL AND expires_at > now())"
+const getResetUserSql = "SELECT id, email FROM users WHERE lower(email) = lower($1) AND removed_at IS NULL"
+const setPasswordSql = "UPDATE users SET password = $1 WHERE id = $2 AND removed_at IS NULL"
+const verifyEmailSql = "UPDATE users SET email_verified_at = now() WHERE id = $1 AND email_verified_at IS NULL RETURNING email"
+const getEmailVerifiedSql = "SELECT email, email_verified_at IS NOT NULL FROM users WHERE id = $1"
+const isEmailVerifiedSql = "SELECT exists(SELECT 1 FROM users WHERE lower(email) = lower($1) AND email_verified_at IS NOT NULL AND removed_at IS NULL)"
+
+// passwordResetLifetime and emailVerificationLifetime are how long the emailed links work
+const passwordResetLifetime = time.Hour
+const emailVerificationLifetime = time.Hour*24*3
+
+type userTokenError struct {}
+
+func (e *userTokenError) Error() string {
+	return "Link Expired Or Already Used"
+}
+
+// ForgotPassword /password/forgot emails a link to reset the password, the answer is the same whether the email has
+// an account or not so it can not be used to find out who does
+// request body has email
+func ForgotPassword(w http.ResponseWriter, r *http.Request){
+	var body map[string]string
+	err := utils.ParseRequestBody(r, &body, []string{"email"})
+	if err != nil{
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+	var userID, email string
+	err = database.DB.QueryRow(getResetUserSql, body["email"]).Scan(&userID, &email)
+	if err == nil {
+		err = sendUserTokenEmail(userID, email, jwtUtil.PurposePasswordReset)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Password Reset Email Error: %s", err.Error())
+	}
+	response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Reset Link Sent If The Email Has An Account"})
+}
+
+// ResetPassword /password/reset sets a new password with the token of a reset link and logs the user out everywhere,
+// a link works once and only the latest one sent works
+// request body has token, password
+func ResetPassword(w http.ResponseWriter, r *http.Request){
+	var body map[string]string
+	err := utils.ParseRequestBody(r, &body, []string{"token", "password"})
+	if err != nil{
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+	userID, err := useUserToken(body["token"], jwtUtil.PurposePasswordReset)
+	if _, ok := err.(*userTokenError); ok {
+		response.JSON(w, http.StatusGone, response.BasicMessage{Message: err.Error()})
+		return
+	} else if err != nil {
+		response.Forbidden(w)
+		return
+	}
+	hashByte, err := bcrypt.GenerateFromPassword([]byte(body["password"]), 10)
+	if err != nil {
+		response.Error(w, "Password Hash Error")
+		return
+	}
+	if _, err = database.DB.Exec(setPasswordSql, string(hashByte), userID); err != nil {
+		response.Error(w, "Reset Password Error")
+		return
+	}
+	if err = revokeUserSessions(userID); err != nil {
+		log.Printf("Revoke Sessions Error: %s", err.Error())
+	}
+	// following the link proves the email is theirs
+	database.DB.Exec(verifyEmailSql, userID)
+	response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Password Reset"})
+}
+
+// VerifyEmail /email/verify confirms the email of the user with the token of the link sent after signup and sends
+// the welcome email
+// request body has token
+func VerifyEmail(w http.ResponseWriter, r *http.Request){
+	var body map[string]string
+	err := utils.ParseRequestBody(r, &body, []string{"token"})
+	if err != nil{
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+	userID, err := useUserToken(body["token"], jwtUtil.PurposeEmailVerification)
+	if _, ok := err.(*userTokenError); ok {
+		response.JSON(w, http.StatusGone, response.BasicMessage{Message: err.Error()})
+		return
+	} else if err != nil {
+		response.Forbidden(w)
+		return
+	}
+	var email string
+	err = database.DB.QueryRow(verifyEmailSql, userID).Scan(&email)
+	if err == sql.ErrNoRows {
+		response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Email Verified"})
+		return
+	} else if err != nil {
+		response.Error(w, "Verify Email Error")
+		return
+	}
+	if err = sendWelcomeEmail(email); err != nil {
+		log.Printf("Send Welcome Email Error: %s", err.Error())
+	}
+	response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Email Verified"})
+}
+
+// ResendVerification /email/verify/resend emails a new verification link to the user, links sent before stop working
+func ResendVerification(w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	var email string
+	var verified bool
+	if err := database.DB.QueryRow(getEmailVerifiedSql, tokenClaims.UserID).Scan(&email, &verified); err != nil {
+		response.Error(w, "Get User Error")
+		return
+	}
+	if verified {
+		response.Error(w, "Email Already Verified")
+		return
+	}
+	if err := sendUserTokenEmail(tokenClaims.UserID, email, jwtUtil.PurposeEmailVerification); err != nil {
+		response.Error(w, "Sending Email Error")
+		return
+	}
+	response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Verification Email Sent"})
+}
+
+// sendUserTokenEmail util function that emails the user a link for purpose, earlier links for the same purpose stop
+// working
+func sendUserTokenEmail (userID, email, purpose string) error {
+	templateFile, subject, path, lifetime, expiresFormat := "verifyEmail.html", "Confirm Your Email", "/email/verify", emailVerificationLifetime, "January 2, 2006"
+	if purpose == jwtUtil.PurposePasswordReset {
+		templateFile, subject, path, lifetime, expiresFormat = "passwordReset.html", "Reset Your Password", "/password/reset", passwordResetLifetime, "3:04 PM MST"
+	}
+	nonce := uuid.New().String()
+	expiresAt := time.Now().Add(lifetime)
+	token, err := jwtUtil.GeneratePurposeToken(purpose, userID, nonce, lifetime)
+	if err != nil {
+		return err
+	}
+	if _, err = database.DB.Exec(expireUserTokensSql, userID, purpose); err != nil {
+		return err
+	}
+	if _, err = database.DB.Exec(addUserTokenSql, userID, purpose, nonce, expiresAt); err != nil {
+		return err
+	}
+	html, err := renderEmail(templateFile, response.LinkEmail{
+		Link: os.Getenv("APP_URL") + path + "?token=" + url.QueryEscape(token),
+		ExpiresAt: expiresAt.Format(expiresFormat),
+	})
+	if err != nil {
+		return err
+	}
+	return SendEmail(email, subject, html, nil)
+}
+
+// useUserToken util function that checks a token emailed for purpose and marks it used, returns the user it was
+// sent to
+func useUserToken (token, purpose string) (string, error) {
+	userID, nonce, err := jwtUtil.CheckPurposeToken(token, purpose)
+	if err != nil {
+		return "", err
+	}
+	res, err := database.DB.Exec(useUserTokenSql, userID, purpose, nonce)
+	if err != nil {
+		return "", err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", &userTokenError{}
+	}
+	return userID, nil
+}
+
+// sendWelcomeEmail util function that sends newUser.html
+func sendWelcomeEmail (email string) error {
+	newUserHTML, err := renderEmail("newUser.html", nil)
+	if err != nil {
+		return err
+	}
+	return SendEmail(email, "Welcome To FromYama", newUserHTML, nil)
+}
+
+// emailVerified util function that is true when a user confirmed the email, receipts are only sent to those
+func emailVerified (email string) bool {
+	var verified bool
+	if err := database.DB.QueryRow(isEmailVerifiedSql, email).Scan(&verified); err != nil {
+		log.Printf("Check Email Verified Error: %s", err.Error())
+		return false
+	}
+	return verified
+}
@@ -0,0 +1,326 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"go.fromyama/utils"
+	"go.fromyama/utils/database"
+	"go.fromyama/utils/jwtUtil"
+	"go.fromyama/utils/response"
+)
+
+const addPickupSql = "INSERT INTO pickups(company_id, user_id, request_id, pickup_date, ready_time, closing_time, street, city, province_code, postal_code, cancel_link, status) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id"
+const getPickupsSql = "SELECT id, request_id, pickup_date, ready_time, closing_time, street, city, province_code, postal_code, status FROM pickups WHERE company_id = $1 ORDER BY pickup_date DESC"
+const getPickupSql = "SELECT COALESCE(cancel_link, ''), status FROM pickups WHERE id = $1 AND company_id = $2"
+const cancelPickupSql = "UPDATE pickups SET status = $1 WHERE id = $2"
+const getPickupLabelsSql = "SELECT id, pickup_id FROM labels WHERE company_id = $1 AND pickup_id IS NOT NULL"
+const setLabelPickupSql = "UPDATE labels SET pickup_id = $1 WHERE id = $2 AND company_id = $3 AND pickup_id IS NULL AND COALESCE(is_return, false) = false AND COALESCE(carrier, 'canadapost') = 'canadapost'"
+const setTodaysLabelsPickupSql = "UPDATE labels SET pickup_id = $1 WHERE company_id = $2 AND pickup_id IS NULL AND COALESCE(is_return, false) = false AND COALESCE(carrier, 'canadapost') = 'canadapost' AND created_at >= date_trunc('day', now())"
+const clearLabelsPickupSql = "UPDATE labels SET pickup_id = NULL WHERE pickup_id = $1"
+
+// provinceTimeZones are the time zones pickup dates are in, by the province of the pickup address
+var provinceTimeZones = map[string]string{
+	"BC": "America/Vancouver",
+	"AB": "America/Edmonton",
+	"SK": "America/Regina",
+	"MB": "America/Winnipeg",
+	"ON": "America/Toronto",
+	"QC": "America/Toronto",
+	"NB": "America/Halifax",
+	"NS": "America/Halifax",
+	"PE": "America/Halifax",
+	"NL": "America/St_Johns",
+	"YT": "America/Whitehorse",
+	"NT": "America/Yellowknife",
+	"NU": "America/Iqaluit",
+}
+
+const pickupScheduled = "scheduled"
+const pickupCancelled = "cancelled"
+
+// SchedulePickup /pickups requests a carrier pickup at the company address or a given address
+// request body has date (YYYY-MM-DD), ready_time and closing_time (HH:MM), optionally label_ids (comma separated,
+// defaults to every label bought today that is not in a pickup yet), instructions, contact_name (defaults to the
+// location contact), and street, city, province_code, postal_code to pick up somewhere other than the company
+// address, or location_id to pick up at a ship from location instead of the default one
+func SchedulePickup (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+
+	var body map[string]string
+	err := utils.ParseRequestBody(r, &body, []string{"date", "ready_time", "closing_time"})
+	if err != nil{
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+
+	var company response.Shipper
+	var paymentAccount, email string
+	getShippingInfoQuery, err := database.DB.Prepare(getShippingInfoAndPaymentSql)
+	if err != nil {
+		response.Error(w, "Get Shipper Error")
+		return
+	}
+	defer getShippingInfoQuery.Close()
+	err = getShippingInfoQuery.QueryRow(tokenClaims.CompanyID).Scan(&company.Address.ShipperName, &company.Address.Street, &company.Address.City, &company.Address.ProvinceCode, &company.Address.Country, &company.Address.PostalCode, &company.Address.Phone, &paymentAccount, &email)
+	if err != nil {
+		response.Error(w, "Get Shipper Error")
+		return
+	}
+	if err = shipFrom(tokenClaims.CompanyID, body, &company.Address); err != nil {
+		response.Error(w, "Get Shipper Error, " + err.Error())
+		return
+	}
+	location := company.Address
+	if body["street"] != "" {
+		if err = utils.CheckRequiredParams(body, []string{"city", "province_code", "postal_code"}); err != nil {
+			response.Error(w, "Body Parse Error, " + err.Error())
+			return
+		}
+		location.Street = body["street"]
+		location.City = body["city"]
+		location.ProvinceCode = body["province_code"]
+		location.PostalCode = body["postal_code"]
+	}
+	contactName := body["contact_name"]
+	if contactName == "" {
+		contactName = company.Address.ContactName
+	}
+	if contactName == "" {
+		contactName = company.Address.ShipperName
+	}
+	if err = checkPickupWindow(body["date"], body["ready_time"], body["closing_time"], pickupTimeZone(location.ProvinceCode)); err != nil {
+		response.Error(w, err.Error())
+		return
+	}
+
+	account, err := getCanadaPostAccount(tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Get Shipper Error")
+		return
+	}
+
+	var labelIDs []string
+	for _, id := range strings.Split(body["label_ids"], ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			labelIDs = append(labelIDs, id)
+		}
+	}
+	volume := len(labelIDs)
+	if volume == 0 {
+		volume = 1
+	}
+
+	var pickupInfo response.CanadaPostPickupResponse
+	err = canadaPostRequest("POST", "https://ct.soa-gw.canadapost.ca/enab/"+account.CustomerNumber+"/pickuprequest",
+		"application/vnd.cpc.pickuprequest+xml", "application/vnd.cpc.pickuprequest+xml",
+		formatCanadaPostPickupBody(location, contactName, email, body["instructions"], body["date"], body["ready_time"], body["closing_time"], volume), &pickupInfo)
+	if err != nil || pickupInfo.RequestID == "" {
+		response.Error(w, "Pickup Request Error")
+		return
+	}
+	var cancelLink string
+	for i := range pickupInfo.Links {
+		if pickupInfo.Links[i].Name == "self" {
+			cancelLink = pickupInfo.Links[i].Link
+		}
+	}
+
+	var pickupID string
+	err = database.DB.QueryRow(addPickupSql, tokenClaims.CompanyID, tokenClaims.UserID, pickupInfo.RequestID, body["date"], body["ready_time"],
+		body["closing_time"], location.Street, location.City, location.ProvinceCode, location.PostalCode, cancelLink, pickupScheduled).Scan(&pickupID)
+	if err != nil {
+		log.Printf("Store Pickup %s Error: %s", pickupInfo.RequestID, err.Error())
+		response.Error(w, "Store Pickup Error")
+		return
+	}
+
+	if len(labelIDs) == 0 {
+		_, err = database.DB.Exec(setTodaysLabelsPickupSql, pickupID, tokenClaims.CompanyID)
+	}
+	for _, id := range labelIDs {
+		if _, err = database.DB.Exec(setLabelPickupSql, pickupID, id, tokenClaims.CompanyID); err != nil {
+			break
+		}
+	}
+	if err != nil {
+		log.Printf("Set Pickup %s Labels Error: %s", pickupID, err.Error())
+	}
+
+	pickups, err := getPickups(tokenClaims.CompanyID)
+	if err == nil {
+		for i := range pickups {
+			if pickups[i].ID == pickupID {
+				response.JSON(w, http.StatusAccepted, pickups[i])
+				return
+			}
+		}
+	}
+	response.JSON(w, http.StatusAccepted, response.Pickup{ID: pickupID, RequestID: pickupInfo.RequestID, Status: pickupScheduled})
+}
+
+// GetPickups /pickups returns the pickups of the company with the labels in each
+func GetPickups (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+
+	pickups, err := getPickups(tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Get Pickups Error")
+		return
+	}
+	response.JSON(w, http.StatusOK, pickups)
+}
+
+// CancelPickup /pickups/{pickupID} cancels a scheduled pickup and frees its labels for another pickup
+// request url has pickupID
+func CancelPickup (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	pickupID := chi.URLParam(r, "pickupID")
+
+	var cancelLink, status string
+	if err := database.DB.QueryRow(getPickupSql, pickupID, tokenClaims.CompanyID).Scan(&cancelLink, &status); err != nil {
+		response.JSON(w, http.StatusNotFound, response.BasicMessage{Message: "Pickup Not Found"})
+		return
+	}
+	if status != pickupScheduled {
+		response.Error(w, "Pickup Is Not Scheduled")
+		return
+	}
+
+	if cancelLink != "" {
+		if err := canadaPostDelete(cancelLink, "application/vnd.cpc.pickuprequest+xml"); err != nil {
+			response.Error(w, "Cancel Pickup Error")
+			return
+		}
+	}
+
+	if _, err := database.DB.Exec(cancelPickupSql, pickupCancelled, pickupID); err != nil {
+		response.Error(w, "Cancel Pickup Error")
+		return
+	}
+	if _, err := database.DB.Exec(clearLabelsPickupSql, pickupID); err != nil {
+		log.Printf("Clear Pickup %s Labels Error: %s", pickupID, err.Error())
+	}
+	response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Pickup Cancelled"})
+}
+
+// getPickups util function that returns the pickups of a company with the ids of the labels in each
+func getPickups (companyID string) ([]response.Pickup, error) {
+	rows, err := database.DB.Query(getPickupsSql, companyID)
+	if err != nil {
+		return nil, err
+	}
+	pickups := []response.Pickup{}
+	index := map[string]int{}
+	for rows.Next() {
+		var p response.Pickup
+		var date time.Time
+		if err = rows.Scan(&p.ID, &p.RequestID, &date, &p.ReadyTime, &p.ClosingTime, &p.Address.Street, &p.Address.City,
+			&p.Address.ProvinceCode, &p.Address.PostalCode, &p.Status); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		p.Date = date.Format("2006-01-02")
+		p.LabelIDs = []string{}
+		index[p.ID] = len(pickups)
+		pickups = append(pickups, p)
+	}
+	rows.Close()
+
+	labelRows, err := database.DB.Query(getPickupLabelsSql, companyID)
+	if err != nil {
+		return nil, err
+	}
+	defer labelRows.Close()
+	for labelRows.Next() {
+		var labelID, pickupID string
+		if err = labelRows.Scan(&labelID, &pickupID); err != nil {
+			return nil, err
+		}
+		if i, ok := index[pickupID]; ok {
+			pickups[i].LabelIDs = append(pickups[i].LabelIDs, labelID)
+		}
+	}
+	return pickups, nil
+}
+
+// checkPickupWindow util function that checks the pickup date is today or later where the pickup is and the ready
+// time is before the closing time
+func checkPickupWindow (date, readyTime, closingTime string, zone *time.Location) error {
+	day, err := time.ParseInLocation("2006-01-02", date, zone)
+	if err != nil {
+		return &postageError{"Pickup Date Must Be YYYY-MM-DD"}
+	}
+	now := time.Now().In(zone)
+	if day.Before(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, zone)) {
+		return &postageError{"Pickup Date Is In The Past"}
+	}
+	ready, err := time.Parse("15:04", readyTime)
+	if err != nil {
+		return &postageError{"Pickup Ready Time Must Be HH:MM"}
+	}
+	closing, err := time.Parse("15:04", closingTime)
+	if err != nil {
+		return &postageError{"Pickup Closing Time Must Be HH:MM"}
+	}
+	if !ready.Before(closing) {
+		return &postageError{"Pickup Ready Time Must Be Before Closing Time"}
+	}
+	return nil
+}
+
+// pickupTimeZone util function that returns the time zone of a province, eastern time when it is not known
+func pickupTimeZone (provinceCode string) *time.Location {
+	name, ok := provinceTimeZones[strings.ToUpper(provinceCode)]
+	if !ok {
+		name = "America/Toronto"
+	}
+	zone, err := time.LoadLocation(name)
+	if err != nil {
+		return time.FixedZone("EST", -5*3600)
+	}
+	return zone
+}
+
+// formatCanadaPostPickupBody formats xml body for an on demand pickup request
+func formatCanadaPostPickupBody (location response.PostageAddress, contactName, email, instructions, date, readyTime, closingTime string, volume int) string {
+	xml := `<?xml version="1.0" encoding="utf-8"?>`
+	xml += `<pickup-request-details xmlns="http://www.canadapost.ca/ws/pickuprequest">`
+	xml += `<pickup-type>OnDemand</pickup-type>`
+	xml += `<pickup-location>`
+	xml += `<business-address-flag>false</business-address-flag>`
+	xml += `<alternate-address>`
+	xml += `<company>`+escapeXML(location.ShipperName)+`</company>`
+	xml += `<address-line-1>`+escapeXML(location.Street)+`</address-line-1>`
+	xml += `<city>`+escapeXML(location.City)+`</city>`
+	xml += `<province>`+escapeXML(location.ProvinceCode)+`</province>`
+	xml += `<postal-code>`+escapeXML(strings.ReplaceAll(location.PostalCode, " ", ""))+`</postal-code>`
+	xml += `</alternate-address>`
+	xml += `</pickup-location>`
+	xml += `<contact-info>`
+	xml += `<contact-name>`+escapeXML(contactName)+`</contact-name>`
+	xml += `<email>`+escapeXML(email)+`</email>`
+	xml += `<contact-phone>`+strconv.Itoa(location.Phone)+`</contact-phone>`
+	xml += `<receive-email-updates-flag>true</receive-email-updates-flag>`
+	xml += `</contact-info>`
+	xml += `<location-details>`
+	xml += `<five-ton-flag>false</five-ton-flag>`
+	xml += `<loading-dock-flag>false</loading-dock-flag>`
+	xml += `<pickup-instructions>`+escapeXML(instructions)+`</pickup-instructions>`
+	xml += `</location-details>`
+	xml += `<pickup-volume>`+strconv.Itoa(volume)+`</pickup-volume>`
+	xml += `<pickup-times>`
+	xml += `<on-demand-pickup-time>`
+	xml += `<date>`+escapeXML(date)+`</date>`
+	xml += `<preferred-time>`+escapeXML(readyTime)+`</preferred-time>`
+	xml += `<closing-time>`+escapeXML(closingTime)+`</closing-time>`
+	xml += `</on-demand-pickup-time>`
+	xml += `</pickup-times>`
+	xml += `</pickup-request-details>`
+	return xml
+}
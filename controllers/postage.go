@@ -7,56 +7,91 @@ import (
 	"fmt"
 	"html/template"
 	"io/ioutil"
-	"math"
+	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/stripe/stripe-go"
 	"github.com/stripe/stripe-go/charge"
 	"github.com/stripe/stripe-go/refund"
-	"go.fromyama/utils"
+	"go.fromyama/utils/carriers"
 	"go.fromyama/utils/database"
 	"go.fromyama/utils/jwtUtil"
+	"go.fromyama/utils/pricing"
 	"go.fromyama/utils/response"
+	"go.fromyama/utils/storage"
 )
 
 const getShippingInfoAndPaymentSql = "SELECT company_name, street, city, province_code, country, postal_code, phone, payment_account_id, email FROM companies c INNER JOIN users u on c.head_id = u.id where c.id = $1"
-const addLabelsSql = "INSERT INTO labels(company_id, user_id, label, refund_link) VALUES ($1, $2, $3, $4)"
+const addLabelsSql = "INSERT INTO labels(company_id, user_id, label, refund_link, tracking_pin, name, postal_code, country, service_code, label_format, group_id, carrier_cost, price, street, city, province_code, weight, charge_id, order_id, carrier, carrier_billed) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21) RETURNING id"
 const getShippingPostalCodeSql = "SELECT postal_code FROM companies WHERE id = $1"
+const getCanadaPostAccountSql = "SELECT COALESCE(canada_post_customer_number, ''), COALESCE(canada_post_contract_id, '') FROM companies WHERE id = $1"
+
+// labelRequestFields are the fields needed to buy a label
+var labelRequestFields = []string{"name", "street", "city", "province_code", "country_code",
+	"postal_code", "phone", "length", "width", "height", "weight", "service_code"}
+
+// canadaPostAccount is the canada post customer labels are bought with, companies with their own contract
+// ship on it and are billed by canada post, everyone else ships non-contract on the fromyama customer number
+type canadaPostAccount struct {
+	CustomerNumber string
+	ContractID string
+}
+
+func (a canadaPostAccount) isContract() bool {
+	return a.ContractID != ""
+}
+
+// carrierBilled is true when the carrier bills the company for labels of carrier, canada post bills contract accounts
+func (a canadaPostAccount) carrierBilled(carrier string) bool {
+	return a.isContract() && carrier == carriers.CanadaPost
+}
+
+// labelFormats returns the formats canada post can produce for the account
+func (a canadaPostAccount) labelFormats() map[string]bool {
+	if a.isContract() {
+		return canadaPostContractFormats
+	}
+	return canadaPostNonContractFormats
+}
+
+type postageError struct {
+	s string
+}
+func (e *postageError) Error() string{
+	return e.s
+}
 
 // BuyCanadaPostPostageLabel /buy/canadapost returns a pdf of the label just purchased
 // request body has name, street, city, province_code, country_code, postal_code, phone, length, width,
-// height, weight, service_code
+// height, weight, service_code, optionally label_format, options with coverage_amount and cod_amount,
+// skip_address_validation, sku whose catalog product fills the parcel fields left out, then the default parcel,
+// location_id or shopify_location_id of the location it ships from, the default location when left out, order_id of
+// the order it ships
 func BuyCanadaPostPostageLabel (w http.ResponseWriter, r *http.Request){
 	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
 
-	var body map[string]string
-	err := utils.ParseRequestBody(r, &body,[]string{"name", "street", "city", "province_code", "country_code",
-		"postal_code", "phone", "length", "width", "height", "weight", "service_code"})
+	body, err := parseParcelRequestBody(r, tokenClaims.CompanyID, labelRequestFields)
 	if err != nil{
 		response.Error(w, "Body Parse Error, " + err.Error())
 		return
 	}
 
+	dest, err := validateDestination(body)
+	if validationErr, ok := err.(*addressValidationError); ok {
+		response.JSON(w, http.StatusBadRequest, validationErr.Result)
+		return
+	} else if err != nil {
+		response.Error(w, "Address Validation Unavailable")
+		return
+	}
+
 	var source response.Shipper
-	var dest response.PostageAddress
 	var paymentAccount, email string
-	var parcel response.Parcel
-	dest.ShipperName = body["name"]
-	dest.Street = body["street"]
-	dest.City = body["city"]
-	dest.ProvinceCode = body["province_code"]
-	dest.Country = body["country_code"]
-	dest.PostalCode = body["postal_code"]
-	dest.Phone, _ = strconv.Atoi(body["phone"])
-	parcel.Length, err = strconv.ParseFloat(body["length"], 64)
-	parcel.Width, err = strconv.ParseFloat(body["width"], 64)
-	parcel.Height, err = strconv.ParseFloat(body["height"], 64)
-	parcel.Weight, err = strconv.ParseFloat(body["weight"], 64)
-
-	source.Parcels = []response.Parcel{parcel}
+	source.Parcels = []response.Parcel{parcelFromBody(body)}
 	getShippingInfoQuery, err := database.DB.Prepare(getShippingInfoAndPaymentSql)
 	defer getShippingInfoQuery.Close()
 	err = getShippingInfoQuery.QueryRow(tokenClaims.CompanyID).Scan(&source.Address.ShipperName, &source.Address.Street, &source.Address.City, &source.Address.ProvinceCode, &source.Address.Country, &source.Address.PostalCode, &source.Address.Phone, &paymentAccount, &email)
@@ -64,72 +99,82 @@ func BuyCanadaPostPostageLabel (w http.ResponseWriter, r *http.Request){
 		response.Error(w, "Get Shipper Error")
 		return
 	}
+	if err = shipFrom(tokenClaims.CompanyID, body, &source.Address); err != nil {
+		response.Error(w, "Get Shipper Error, " + err.Error())
+		return
+	}
 
-	var rate response.CanadaPostRatesResponse
-	priceXml := formatCanadaPostSingleRateBody(source, body["postal_code"], body["weight"], body["service_code"])
-	err = canadaPostRequest("POST", "https://ct.soa-gw.canadapost.ca/rs/ship/price", "application/vnd.cpc.ship.rate-v4+xml", "application/vnd.cpc.ship.rate-v4+xml",
-		priceXml, &rate)
-
-	rateJSON := rateResponseToJSON(rate)
-	total, err := strconv.ParseFloat(rateJSON[0].PriceDetails.Due, 64)
-	intAmount := int(total * 100)
-
-	stripe.Key = os.Getenv("STRIPE_SECRET")
-	params := &stripe.ChargeParams{
-		Amount: stripe.Int64(int64(intAmount)),
-		Currency: stripe.String(string(stripe.CurrencyCAD)),
-		Description: stripe.String("Label Purchase"),
-		Customer: stripe.String(paymentAccount),
+	account, err := getCanadaPostAccount(tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Get Shipper Error")
+		return
 	}
-	c, _ := charge.New(params)
-	if !c.Paid {
-		response.JSON(w, http.StatusConflict, "Payment Error")
+
+	labelFormat, err := resolveLabelFormat(tokenClaims.CompanyID, body["label_format"])
+	if err != nil {
+		response.Error(w, "Label Format Error")
 		return
 	}
-	refundParam := &stripe.RefundParams{
-		Charge: stripe.String(c.ID),
+	carrierFormat, err := carrierLabelFormat(labelFormat, account.labelFormats())
+	if err != nil {
+		response.Error(w, err.Error())
+		return
 	}
 
-	xmlBody := formatCanadaPostRequestBody(source, dest, body["weight"], body["service_code"])
-	client := &http.Client{
-		Timeout: time.Second * 20,
+	options, err := resolveShippingOptions(tokenClaims.CompanyID, body)
+	if err != nil {
+		response.Error(w, err.Error())
+		return
 	}
 
-	var canadaPostBody response.CanadaPostPostageResponse
+	companyPrices, err := getCompanyPricing(tokenClaims.CompanyID, account)
+	if err != nil {
+		response.Error(w, "Get Pricing Error")
+		return
+	}
+	cost, intAmount, err := quoteCanadaPostLabel(account, companyPrices, source, body["postal_code"], body["weight"], body["service_code"], options)
+	if err != nil {
+		response.Error(w, "Get Rate Error")
+		return
+	}
 
-	err = canadaPostRequest("POST", "https://ct.soa-gw.canadapost.ca/rs/"+os.Getenv("CANADA_POST_CUSTNUM")+"/ncshipment", "application/vnd.cpc.ncshipment-v4+xml",
-		"application/vnd.cpc.ncshipment-v4+xml",xmlBody, &canadaPostBody)
+	chargeID, err := chargeForPostage(account, paymentAccount, cost, intAmount, "Label Purchase")
 	if err != nil {
-		_, _ = refund.New(refundParam)
-		response.Error(w ,"Postage Error")
+		response.JSON(w, http.StatusConflict, "Payment Error")
 		return
 	}
 
-	var labelLink, refundLink string
-	for i := range canadaPostBody.Links {
-		if canadaPostBody.Links[i].Name == "label" {
-			labelLink = canadaPostBody.Links[i].Link
-		}
-		if canadaPostBody.Links[i].Name == "refund" {
-			refundLink = canadaPostBody.Links[i].Link
-		}
+	groupID := canadaPostGroupID(account, source.Address)
+	canadaPostBody, labelLink, refundLink, err := createCanadaPostShipment(account, source, dest, body["weight"], body["service_code"], carrierFormat, groupID, options)
+	if err != nil {
+		refundPostage(chargeID, 0)
+		response.Error(w ,"Postage Error")
+		return
 	}
 
+	var labelID string
 	addLabelQuery, err := database.DB.Prepare(addLabelsSql)
 	defer addLabelQuery.Close()
-	_, err = addLabelQuery.Exec(tokenClaims.CompanyID, tokenClaims.UserID,labelLink, refundLink)
+	err = addLabelQuery.QueryRow(tokenClaims.CompanyID, tokenClaims.UserID, labelLink, refundLink, canadaPostBody.Tracking,
+		dest.ShipperName, dest.PostalCode, dest.Country, body["service_code"], labelFormat, groupID, float64(cost)/100.0, float64(intAmount)/100.0,
+		dest.Street, dest.City, dest.ProvinceCode, body["weight"], chargeID, body["order_id"], carriers.CanadaPost, account.carrierBilled(carriers.CanadaPost)).Scan(&labelID)
 	if err != nil {
-		_, _ = refund.New(refundParam)
+		refundPostage(chargeID, 0)
 		response.Error(w ,"Store Postage Error")
 		return
 	}
 
-	getLabelReq, err := http.NewRequest("GET", labelLink, nil)
-	getLabelReq.SetBasicAuth(os.Getenv("CANADA_POST_USER"), os.Getenv("CANADA_POST_PASS"))
-	getLabelReq.Header.Add("Accept","application/pdf")
-	labelResp, err := client.Do(getLabelReq)
-	defer labelResp.Body.Close()
-	label, err := ioutil.ReadAll(labelResp.Body)
+	label, err := getCanadaPostDocument(labelLink, labelFormats[carrierFormat].ContentType)
+	if err == nil {
+		label, err = convertLabel(label, carrierFormat, labelFormat)
+	}
+	if err != nil {
+		response.Error(w, "Get Label Error")
+		return
+	}
+	if err = storeLabelDocument(tokenClaims.CompanyID, labelID, storage.KindLabel, labelFormats[labelFormat].ContentType, label); err != nil {
+		log.Printf("Store Label Error: %s", err.Error())
+	}
 
 	receipt := response.CanadaPostLabelPurchase{
 		PostalCode: body["postal_code"],
@@ -139,45 +184,66 @@ func BuyCanadaPostPostageLabel (w http.ResponseWriter, r *http.Request){
 
 	var tmplBuffer bytes.Buffer
 	tmpl := template.Must(template.ParseFiles("assets/templates/labelPurchase.html"))
-	tmpl.Execute(&tmplBuffer, receipt)
+	_ = tmpl.Execute(&tmplBuffer, receipt)
 
-	err = SendEmail("ahmad.ayubi@hotmail.com", "Shipping Label Purchased", tmplBuffer.String(), label)
-	if err != nil {
-		_, _ = refund.New(refundParam)
-		_ = SendEmail("ahmad.ayubi@hotmail.com", "Refund Label Purchase", "Refund Label Purchase", nil)
-		response.Error(w ,"Sending Email Error")
-		return
+	var attachment []byte
+	if labelFormats[labelFormat].Encoding == "PDF" {
+		attachment = label
+	}
+	if !emailVerified(email) {
+		log.Printf("Receipt For Label %s Not Sent, Email Not Verified", labelID)
+	} else if err = SendEmail(email, "Shipping Label Purchased", tmplBuffer.String(), attachment); err != nil {
+		log.Printf("Send Receipt Error For Label %s: %s", labelID, err.Error())
 	}
 
-
-
+	w.Header().Set("Content-Type", labelFormats[labelFormat].ContentType)
+	w.Header().Set("X-Label-ID", labelID)
 	w.WriteHeader(http.StatusAccepted)
-	w.Header().Set("Content-Type", "application/pdf")
 	w.Write(label)
 }
 
-// GetCanadaPostRate /rates/canadapost returns array of rates
-// request body has postal_code, weight
+// GetCanadaPostRate /rates/canadapost returns array of rates including the cost of the shipping options, services
+// that do not support the options are left out
+// request body has postal_code, weight, length, width, height, optionally options with coverage_amount and cod_amount
+// and sku, the parcel fields left out are filled as for /buy/canadapost, location_id or shopify_location_id
 func GetCanadaPostRate (w http.ResponseWriter, r *http.Request) {
 	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
 
-	var body map[string]string
-	err := utils.ParseRequestBody(r, &body,[]string{"postal_code","weight", "length", "width", "height"})
+	body, err := parseParcelRequestBody(r, tokenClaims.CompanyID, []string{"postal_code","weight", "length", "width", "height"})
 	if err != nil{
 		response.Error(w, "Body Parse Error, " + err.Error())
 		return
 	}
 
-	var sourcePostalCode string
+	var source response.PostageAddress
 
 	getShippingInfoQuery, err := database.DB.Prepare(getShippingPostalCodeSql)
 	defer getShippingInfoQuery.Close()
-	err = getShippingInfoQuery.QueryRow(tokenClaims.CompanyID).Scan(&sourcePostalCode)
+	err = getShippingInfoQuery.QueryRow(tokenClaims.CompanyID).Scan(&source.PostalCode)
+	if err != nil {
+		response.Error(w, "Get Shipper Error")
+		return
+	}
+	if err = shipFrom(tokenClaims.CompanyID, body, &source); err != nil {
+		response.Error(w, "Get Shipper Error, " + err.Error())
+		return
+	}
+	account, err := getCanadaPostAccount(tokenClaims.CompanyID)
 	if err != nil {
 		response.Error(w, "Get Shipper Error")
 		return
 	}
-	xmlBody := formatCanadaPostRateBody(sourcePostalCode, body["postal_code"], body["length"], body["width"], body["height"], body["weight"])
+	var options []shippingOption
+	if _, ok := body["options"]; ok {
+		options, err = parseShippingOptions(body)
+	} else {
+		options, err = getCompanyShippingOptions(tokenClaims.CompanyID)
+	}
+	if err != nil {
+		response.Error(w, err.Error())
+		return
+	}
+	xmlBody := formatCanadaPostRateBody(account, source.PostalCode, body["postal_code"], body["length"], body["width"], body["height"], body["weight"], options)
 
 	var rates response.CanadaPostRatesResponse
 	err = canadaPostRequest("POST", "https://ct.soa-gw.canadapost.ca/rs/ship/price", "application/vnd.cpc.ship.rate-v4+xml", "application/vnd.cpc.ship.rate-v4+xml",
@@ -187,50 +253,234 @@ func GetCanadaPostRate (w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rateJSON := rateResponseToJSON(rates)
+	companyPrices, err := getCompanyPricing(tokenClaims.CompanyID, account)
+	if err != nil {
+		response.Error(w, "Get Pricing Error")
+		return
+	}
+	rateJSON := []response.CanadaPostRate{}
+	for _, rate := range rateResponseToJSON(rates) {
+		if checkServiceOptions(rate.ServiceCode, options) == nil {
+			rateJSON = append(rateJSON, rate)
+		}
+	}
+	priceCanadaPostRates(companyPrices, rateJSON)
 	response.JSON(w, http.StatusOK, rateJSON)
 }
 
+// postageAddressFromBody util function that reads the destination address from a label request body
+func postageAddressFromBody (body map[string]string) response.PostageAddress {
+	var dest response.PostageAddress
+	dest.ShipperName = body["name"]
+	dest.Street = body["street"]
+	dest.City = body["city"]
+	dest.ProvinceCode = body["province_code"]
+	dest.Country = body["country_code"]
+	dest.PostalCode = body["postal_code"]
+	dest.Phone, _ = strconv.Atoi(body["phone"])
+	return dest
+}
+
+// parcelFromBody util function that reads the parcel dimensions from a label request body
+func parcelFromBody (body map[string]string) response.Parcel {
+	var parcel response.Parcel
+	parcel.Length, _ = strconv.ParseFloat(body["length"], 64)
+	parcel.Width, _ = strconv.ParseFloat(body["width"], 64)
+	parcel.Height, _ = strconv.ParseFloat(body["height"], 64)
+	parcel.Weight, _ = strconv.ParseFloat(body["weight"], 64)
+	return parcel
+}
+
+// quoteCanadaPostLabel util function that returns the carrier cost and the customer price in cents of a single service
+// before purchase
+func quoteCanadaPostLabel (account canadaPostAccount, companyPrices companyPricing, source response.Shipper, destPostalCode, weight, serviceCode string, options []shippingOption) (int64, int64, error) {
+	var rate response.CanadaPostRatesResponse
+	priceXml := formatCanadaPostSingleRateBody(account, source, destPostalCode, weight, serviceCode, options)
+	err := canadaPostRequest("POST", "https://ct.soa-gw.canadapost.ca/rs/ship/price", "application/vnd.cpc.ship.rate-v4+xml", "application/vnd.cpc.ship.rate-v4+xml",
+		priceXml, &rate)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	rateJSON := rateResponseToJSON(rate)
+	if len(rateJSON) == 0 {
+		return 0, 0, &postageError{"No Rate For Service " + serviceCode}
+	}
+	total, err := strconv.ParseFloat(rateJSON[0].PriceDetails.Due, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	cost := pricing.Cents(total)
+	return cost, companyPrices.price(pricing.CarrierCanadaPost, serviceCode, cost), nil
+}
+
+// createCanadaPostShipment util function that buys the label in labelFormat and returns the shipment with its label and
+// refund links, contract accounts create a shipment in groupID and the refund link is the shipment itself which can be
+// voided until it is transmitted
+func createCanadaPostShipment (account canadaPostAccount, source response.Shipper, dest response.PostageAddress, weight, serviceCode, labelFormat, groupID string, options []shippingOption) (response.CanadaPostPostageResponse, string, string, error) {
+	var canadaPostBody response.CanadaPostPostageResponse
+	var err error
+	if account.isContract() {
+		xmlBody := formatCanadaPostContractRequestBody(account, source, dest, weight, serviceCode, labelFormat, groupID, options)
+		err = canadaPostRequest("POST", "https://ct.soa-gw.canadapost.ca/rs/"+account.CustomerNumber+"/"+account.CustomerNumber+"/shipment",
+			"application/vnd.cpc.shipment-v8+xml", "application/vnd.cpc.shipment-v8+xml", xmlBody, &canadaPostBody)
+	} else {
+		xmlBody := formatCanadaPostRequestBody(source, dest, weight, serviceCode, labelFormat, options)
+		err = canadaPostRequest("POST", "https://ct.soa-gw.canadapost.ca/rs/"+account.CustomerNumber+"/ncshipment", "application/vnd.cpc.ncshipment-v4+xml",
+			"application/vnd.cpc.ncshipment-v4+xml",xmlBody, &canadaPostBody)
+	}
+	if err != nil {
+		return canadaPostBody, "", "", err
+	}
+
+	var labelLink, refundLink string
+	for i := range canadaPostBody.Links {
+		if canadaPostBody.Links[i].Name == "label" {
+			labelLink = canadaPostBody.Links[i].Link
+		}
+		if canadaPostBody.Links[i].Name == "refund" || (account.isContract() && canadaPostBody.Links[i].Name == "self") {
+			refundLink = canadaPostBody.Links[i].Link
+		}
+	}
+	if labelLink == "" {
+		return canadaPostBody, "", "", &postageError{"No Label Link In Shipment"}
+	}
+	return canadaPostBody, labelLink, refundLink, nil
+}
+
+// getCanadaPostAccount util function that returns the canada post account the company ships with
+func getCanadaPostAccount (companyID string) (canadaPostAccount, error) {
+	var account canadaPostAccount
+	getAccountQuery, err := database.DB.Prepare(getCanadaPostAccountSql)
+	if err != nil {
+		return account, err
+	}
+	defer getAccountQuery.Close()
+	if err = getAccountQuery.QueryRow(companyID).Scan(&account.CustomerNumber, &account.ContractID); err != nil {
+		return account, err
+	}
+	if !account.isContract() || account.CustomerNumber == "" {
+		return canadaPostAccount{CustomerNumber: os.Getenv("CANADA_POST_CUSTNUM")}, nil
+	}
+	return account, nil
+}
+
+// canadaPostGroupID util function that returns the group contract shipments bought today from source go in, a group
+// is transmitted as one manifest for its shipping point so it ends with the source postal code, non-contract
+// shipments have no group
+func canadaPostGroupID (account canadaPostAccount, source response.PostageAddress) string {
+	if !account.isContract() {
+		return ""
+	}
+	return time.Now().Format("20060102") + strings.ToUpper(strings.ReplaceAll(source.PostalCode, " ", ""))
+}
+
+// groupShippingPoint util function that returns the postal code a group is transmitted from, groups made before
+// they carried one are transmitted from the company postal code
+func groupShippingPoint (group, companyPostalCode string) string {
+	if len(group) > len("20060102") {
+		return group[len("20060102"):]
+	}
+	return companyPostalCode
+}
+
+// chargeForPostage util function that charges the company card for a canada post label costing cost cents priced
+// price cents and returns the charge id, contract accounts are billed the cost by canada post so they are only charged
+// the rest of the price, the charge id is empty when nothing is charged
+func chargeForPostage (account canadaPostAccount, paymentAccount string, cost, price int64, description string) (string, error) {
+	amount := chargeAmount(account.carrierBilled(carriers.CanadaPost), cost, price)
+	if amount <= 0 {
+		return "", nil
+	}
+	return chargeCompany(paymentAccount, amount, description)
+}
+
+// chargeCompany util function that charges the company card amount cents and returns the charge id
+func chargeCompany (paymentAccount string, amount int64, description string) (string, error) {
+	stripe.Key = os.Getenv("STRIPE_SECRET")
+	c, err := charge.New(&stripe.ChargeParams{
+		Amount: stripe.Int64(amount),
+		Currency: stripe.String(string(stripe.CurrencyCAD)),
+		Description: stripe.String(description),
+		Customer: stripe.String(paymentAccount),
+	})
+	if err != nil {
+		return "", err
+	}
+	if !c.Paid {
+		return "", &postageError{"Payment Error"}
+	}
+	return c.ID, nil
+}
+
+// refundPostage util function that refunds amount cents of a postage charge, 0 refunds all of it
+func refundPostage (chargeID string, amount int64) error {
+	if chargeID == "" {
+		return nil
+	}
+	stripe.Key = os.Getenv("STRIPE_SECRET")
+	params := &stripe.RefundParams{
+		Charge: stripe.String(chargeID),
+	}
+	if amount > 0 {
+		params.Amount = stripe.Int64(amount)
+	}
+	_, err := refund.New(params)
+	if err != nil {
+		log.Printf("Refund Error For Charge %s: %s", chargeID, err.Error())
+	}
+	return err
+}
+
+// escapeXML util function that escapes user supplied text for an xml element
+func escapeXML (s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
 // formatCanadaPostRequestBody formats xml body for postage purchase request
-func formatCanadaPostRequestBody (source response.Shipper, dest response.PostageAddress, weight string, serviceCode string) string{
+func formatCanadaPostRequestBody (source response.Shipper, dest response.PostageAddress, weight string, serviceCode, labelFormat string, options []shippingOption) string{
 	xml := `<?xml version="1.0" encoding="utf-8"?>`
 	xml += `<non-contract-shipment xmlns="http://www.canadapost.ca/ws/ncshipment-v4">`
-	xml += `<requested-shipping-point>`+source.Address.PostalCode+`</requested-shipping-point>`
+	xml += `<requested-shipping-point>`+escapeXML(source.Address.PostalCode)+`</requested-shipping-point>`
 	xml += `<delivery-spec>`
-	xml += `<service-code>`+serviceCode+`</service-code>`
+	xml += `<service-code>`+escapeXML(serviceCode)+`</service-code>`
 	xml += `<sender>`
-	xml += `<company>`+source.Address.ShipperName+`</company>`
+	if source.Address.ContactName != "" {
+		xml += `<name>`+escapeXML(source.Address.ContactName)+`</name>`
+	}
+	xml += `<company>`+escapeXML(source.Address.ShipperName)+`</company>`
 	xml += `<contact-phone>`+strconv.Itoa(source.Address.Phone)+`</contact-phone>`
 	xml += `<address-details>`
-	xml += `<address-line-1>`+source.Address.Street+`</address-line-1>`
-	xml += `<city>`+source.Address.City+`</city>`
-	xml += `<prov-state>`+source.Address.ProvinceCode+`</prov-state>`
-	xml += `<postal-zip-code>`+source.Address.PostalCode+`</postal-zip-code>`
+	xml += `<address-line-1>`+escapeXML(source.Address.Street)+`</address-line-1>`
+	xml += `<city>`+escapeXML(source.Address.City)+`</city>`
+	xml += `<prov-state>`+escapeXML(source.Address.ProvinceCode)+`</prov-state>`
+	xml += `<postal-zip-code>`+escapeXML(source.Address.PostalCode)+`</postal-zip-code>`
 	xml += `</address-details>`
 	xml += `</sender>`
 	xml += `<destination>`
-	xml += `<name>`+dest.ShipperName+`</name>`
+	xml += `<name>`+escapeXML(dest.ShipperName)+`</name>`
 	xml += `<address-details>`
-	xml += `<address-line-1>`+dest.Street+`</address-line-1>`
-	xml += `<city>`+dest.City+`</city>`
-	xml += `<prov-state>`+dest.ProvinceCode+`</prov-state>`
-	xml += `<country-code>`+dest.Country+`</country-code>`
-	xml += `<postal-zip-code>`+dest.PostalCode+`</postal-zip-code>`
+	xml += `<address-line-1>`+escapeXML(dest.Street)+`</address-line-1>`
+	xml += `<city>`+escapeXML(dest.City)+`</city>`
+	xml += `<prov-state>`+escapeXML(dest.ProvinceCode)+`</prov-state>`
+	xml += `<country-code>`+escapeXML(dest.Country)+`</country-code>`
+	xml += `<postal-zip-code>`+escapeXML(dest.PostalCode)+`</postal-zip-code>`
 	xml += `</address-details>`
 	xml += `</destination>`
-	xml += `<options>`
-	xml += `<option>`
-	xml += `<option-code>DC</option-code>`
-	xml += `</option>`
-	xml += `</options>`
+	xml += formatCanadaPostOptions(options)
 	xml += `<parcel-characteristics>`
-	xml += `<weight>`+weight+`</weight>`
+	xml += `<weight>`+escapeXML(weight)+`</weight>`
 	xml += `<dimensions>`
 	xml += `<length>`+fmt.Sprintf("%f",source.Parcels[0].Length)+`</length>`
 	xml += `<width>`+fmt.Sprintf("%f",source.Parcels[0].Width)+`</width>`
 	xml += `<height>`+fmt.Sprintf("%f",source.Parcels[0].Height)+`</height>`
 	xml += `</dimensions>`
 	xml += `</parcel-characteristics>`
+	xml += `<print-preferences>`
+	xml += `<output-format>`+labelFormats[labelFormat].OutputFormat+`</output-format>`
+	xml += `</print-preferences>`
 	xml += `<preferences>`
 	xml += `<show-packing-instructions>true</show-packing-instructions>`
 	xml += `</preferences>`
@@ -239,11 +489,73 @@ func formatCanadaPostRequestBody (source response.Shipper, dest response.Postage
 	return xml
 }
 
+// formatCanadaPostContractRequestBody formats xml body for contract shipment request
+func formatCanadaPostContractRequestBody (account canadaPostAccount, source response.Shipper, dest response.PostageAddress, weight, serviceCode, labelFormat, groupID string, options []shippingOption) string{
+	xml := `<?xml version="1.0" encoding="utf-8"?>`
+	xml += `<shipment xmlns="http://www.canadapost.ca/ws/shipment-v8">`
+	xml += `<group-id>`+escapeXML(groupID)+`</group-id>`
+	xml += `<requested-shipping-point>`+escapeXML(source.Address.PostalCode)+`</requested-shipping-point>`
+	xml += `<expected-mailing-date>`+time.Now().Format("2006-01-02")+`</expected-mailing-date>`
+	xml += `<delivery-spec>`
+	xml += `<service-code>`+escapeXML(serviceCode)+`</service-code>`
+	xml += `<sender>`
+	if source.Address.ContactName != "" {
+		xml += `<name>`+escapeXML(source.Address.ContactName)+`</name>`
+	}
+	xml += `<company>`+escapeXML(source.Address.ShipperName)+`</company>`
+	xml += `<contact-phone>`+strconv.Itoa(source.Address.Phone)+`</contact-phone>`
+	xml += `<address-details>`
+	xml += `<address-line-1>`+escapeXML(source.Address.Street)+`</address-line-1>`
+	xml += `<city>`+escapeXML(source.Address.City)+`</city>`
+	xml += `<prov-state>`+escapeXML(source.Address.ProvinceCode)+`</prov-state>`
+	xml += `<country-code>CA</country-code>`
+	xml += `<postal-zip-code>`+escapeXML(source.Address.PostalCode)+`</postal-zip-code>`
+	xml += `</address-details>`
+	xml += `</sender>`
+	xml += `<destination>`
+	xml += `<name>`+escapeXML(dest.ShipperName)+`</name>`
+	xml += `<address-details>`
+	xml += `<address-line-1>`+escapeXML(dest.Street)+`</address-line-1>`
+	xml += `<city>`+escapeXML(dest.City)+`</city>`
+	xml += `<prov-state>`+escapeXML(dest.ProvinceCode)+`</prov-state>`
+	xml += `<country-code>`+escapeXML(dest.Country)+`</country-code>`
+	xml += `<postal-zip-code>`+escapeXML(dest.PostalCode)+`</postal-zip-code>`
+	xml += `</address-details>`
+	xml += `</destination>`
+	xml += formatCanadaPostOptions(options)
+	xml += `<parcel-characteristics>`
+	xml += `<weight>`+escapeXML(weight)+`</weight>`
+	xml += `<dimensions>`
+	xml += `<length>`+fmt.Sprintf("%f",source.Parcels[0].Length)+`</length>`
+	xml += `<width>`+fmt.Sprintf("%f",source.Parcels[0].Width)+`</width>`
+	xml += `<height>`+fmt.Sprintf("%f",source.Parcels[0].Height)+`</height>`
+	xml += `</dimensions>`
+	xml += `</parcel-characteristics>`
+	xml += `<print-preferences>`
+	xml += `<output-format>`+labelFormats[labelFormat].OutputFormat+`</output-format>`
+	xml += `<encoding>`+labelFormats[labelFormat].Encoding+`</encoding>`
+	xml += `</print-preferences>`
+	xml += `<preferences>`
+	xml += `<show-packing-instructions>true</show-packing-instructions>`
+	xml += `</preferences>`
+	xml += `<settlement-info>`
+	xml += `<contract-id>`+escapeXML(account.ContractID)+`</contract-id>`
+	xml += `<intended-method-of-payment>Account</intended-method-of-payment>`
+	xml += `</settlement-info>`
+	xml += `</delivery-spec>`
+	xml += `</shipment>`
+	return xml
+}
+
 // formatCanadaPostRateBody formats xml body for rate checking canada post request
-func formatCanadaPostRateBody (sourcePostalCode, destPostalCode, length, width, height, weight string) string {
+func formatCanadaPostRateBody (account canadaPostAccount, sourcePostalCode, destPostalCode, length, width, height, weight string, options []shippingOption) string {
 	xml := `<?xml version="1.0" encoding="utf-8"?>`
 	xml += `<mailing-scenario xmlns="http://www.canadapost.ca/ws/ship/rate-v4">`
-	xml += `<customer-number>`+os.Getenv("CANADA_POST_CUSTNUM")+`</customer-number>`
+	xml += `<customer-number>`+account.CustomerNumber+`</customer-number>`
+	if account.isContract() {
+		xml += `<contract-id>`+account.ContractID+`</contract-id>`
+	}
+	xml += formatCanadaPostOptions(options)
 	xml += `<parcel-characteristics>`
 	xml += `<weight>`+weight+`</weight>`
 	xml += `<dimensions><length>`+length+"</length>"
@@ -258,10 +570,14 @@ func formatCanadaPostRateBody (sourcePostalCode, destPostalCode, length, width,
 }
 
 // formatCanadaPostSingleRateBody util function that forms xml for price checking before purchase
-func formatCanadaPostSingleRateBody (source response.Shipper, destPostalCode, weight, serviceCode string) string {
+func formatCanadaPostSingleRateBody (account canadaPostAccount, source response.Shipper, destPostalCode, weight, serviceCode string, options []shippingOption) string {
 	xml := `<?xml version="1.0" encoding="utf-8"?>`
 	xml += `<mailing-scenario xmlns="http://www.canadapost.ca/ws/ship/rate-v4">`
-	xml += `<customer-number>`+os.Getenv("CANADA_POST_CUSTNUM")+`</customer-number>`
+	xml += `<customer-number>`+account.CustomerNumber+`</customer-number>`
+	if account.isContract() {
+		xml += `<contract-id>`+account.ContractID+`</contract-id>`
+	}
+	xml += formatCanadaPostOptions(options)
 	xml += `<parcel-characteristics>`
 	xml += `<weight>`+weight+`</weight>`
 	xml += `<dimensions><length>`+fmt.Sprintf("%f",source.Parcels[0].Length)+"</length>"
@@ -276,7 +592,7 @@ func formatCanadaPostSingleRateBody (source response.Shipper, destPostalCode, we
 	return xml
 }
 
-// rateResponseToJSON converts response to json struct
+// rateResponseToJSON converts response to json struct, due is the carrier cost before pricing
 func rateResponseToJSON (resp response.CanadaPostRatesResponse) []response.CanadaPostRate{
 	var rateJSON []response.CanadaPostRate
 	for i := range resp.PriceQuote{
@@ -288,6 +604,14 @@ func rateResponseToJSON (resp response.CanadaPostRatesResponse) []response.Canad
 				AdjustmentName: resp.PriceQuote[i].PriceDetails.Adjustments.Adjustment[j].AdjustmentName,
 			})
 		}
+		var options []response.CanadaPostOption
+		for j := range resp.PriceQuote[i].PriceDetails.Options.Option {
+			options = append(options, response.CanadaPostOption{
+				OptionCode: resp.PriceQuote[i].PriceDetails.Options.Option[j].OptionCode,
+				OptionName: resp.PriceQuote[i].PriceDetails.Options.Option[j].OptionName,
+				OptionPrice: resp.PriceQuote[i].PriceDetails.Options.Option[j].OptionPrice,
+			})
+		}
 		due, _ := strconv.ParseFloat(resp.PriceQuote[i].PriceDetails.Due, 64)
 		rateJSON = append(rateJSON, response.CanadaPostRate{
 			ServiceCode: resp.PriceQuote[i].ServiceCode,
@@ -298,7 +622,8 @@ func rateResponseToJSON (resp response.CanadaPostRatesResponse) []response.Canad
 				Gst: resp.PriceQuote[i].PriceDetails.Taxes.Gst,
 				Hst: resp.PriceQuote[i].PriceDetails.Taxes.Hst.Percent,
 				Pst: resp.PriceQuote[i].PriceDetails.Taxes.Pst,
-				Due: fmt.Sprintf("%f",math.Ceil(due*100)/100 + 1.1),
+				Due: fmt.Sprintf("%f", float64(pricing.Cents(due))/100.0),
+				Options: options,
 				Adjustments: adjustments,
 			},
 			AmDelivery: resp.PriceQuote[i].ServiceStandard.AmDelivery,
@@ -328,13 +653,40 @@ func canadaPostRequest(method, url, acceptType, contentType, xmlBody string, par
 	req.Header.Add("Accept-language", "en-CA")
 
 	resp, err := client.Do(req)
-	defer resp.Body.Close()
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 	respBody, _ := ioutil.ReadAll(resp.Body)
 	if err = xml.Unmarshal(respBody, parseTo); err != nil{
 		return err
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+// canadaPostDelete util function to delete a canada post resource by its link, canada post answers with an
+// empty body so only the status is checked
+func canadaPostDelete(link, acceptType string) error{
+	req, err := http.NewRequest("DELETE", link, nil)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{
+		Timeout: time.Second * 20,
+	}
+
+	req.SetBasicAuth(os.Getenv("CANADA_POST_USER"), os.Getenv("CANADA_POST_PASS"))
+	req.Header.Add("Accept", acceptType)
+	req.Header.Add("Accept-language", "en-CA")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &postageError{"Canada Post Delete Failed With " + resp.Status}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"go.fromyama/utils/database"
+	"go.fromyama/utils/jwtUtil"
+	"go.fromyama/utils/pricing"
+	"go.fromyama/utils/response"
+)
+
+const getCompanyPricingPlanSql = "SELECT p.rules FROM companies c INNER JOIN pricing_plans p ON p.id = c.pricing_plan_id WHERE c.id = $1"
+const countMonthlyLabelsSql = "SELECT count(*) FROM labels WHERE company_id = $1 AND created_at >= date_trunc('month', now())"
+
+// companyPricing is the plan a company is priced with and how many labels it bought this month
+type companyPricing struct {
+	Plan     pricing.Plan
+	Volume   int
+	Contract bool
+}
+
+// price returns the customer price in cents of a label costing cost cents
+func (p companyPricing) price(carrier, serviceCode string, cost int64) int64 {
+	return p.Plan.Price(carrier, serviceCode, cost, p.Volume)
+}
+
+// chargeAmount returns the cents charged to the company card for a label costing cost cents priced price cents, labels
+// the carrier bills for are only charged the part of the price above the carrier cost
+func chargeAmount (carrierBilled bool, cost, price int64) int64 {
+	if !carrierBilled {
+		return price
+	}
+	if price < cost {
+		return 0
+	}
+	return price - cost
+}
+
+// GetPricingPlan /pricing returns the pricing plan of the company and its label volume this month
+func GetPricingPlan (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+
+	account, err := getCanadaPostAccount(tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Get Pricing Error")
+		return
+	}
+	companyPrices, err := getCompanyPricing(tokenClaims.CompanyID, account)
+	if err != nil {
+		response.Error(w, "Get Pricing Error")
+		return
+	}
+	response.JSON(w, http.StatusOK, response.PricingPlan{
+		Plan: companyPrices.Plan,
+		MonthlyLabels: companyPrices.Volume,
+		CarrierBilled: companyPrices.Contract,
+	})
+}
+
+// getCompanyPricing util function that loads the pricing plan of a company, companies without a plan are
+// priced with pricing.DefaultPlan
+func getCompanyPricing (companyID string, account canadaPostAccount) (companyPricing, error) {
+	companyPrices := companyPricing{Plan: pricing.DefaultPlan, Contract: account.isContract()}
+
+	var rules []byte
+	err := database.DB.QueryRow(getCompanyPricingPlanSql, companyID).Scan(&rules)
+	if err != nil && err != sql.ErrNoRows {
+		return companyPrices, err
+	}
+	if err == nil {
+		if companyPrices.Plan, err = pricing.Parse(rules); err != nil {
+			return companyPrices, err
+		}
+	}
+
+	if err = database.DB.QueryRow(countMonthlyLabelsSql, companyID).Scan(&companyPrices.Volume); err != nil {
+		return companyPrices, err
+	}
+	return companyPrices, nil
+}
+
+// priceCanadaPostRates util function that replaces the carrier cost due of each rate with the customer price
+func priceCanadaPostRates (companyPrices companyPricing, rates []response.CanadaPostRate) {
+	for i := range rates {
+		due, _ := strconv.ParseFloat(rates[i].PriceDetails.Due, 64)
+		price := companyPrices.price(pricing.CarrierCanadaPost, rates[i].ServiceCode, pricing.Cents(due))
+		rates[i].PriceDetails.Due = fmt.Sprintf("%f", float64(price)/100.0)
+	}
+}
@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"database/sql"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"go.fromyama/utils"
+	"go.fromyama/utils/database"
+	"go.fromyama/utils/jwtUtil"
+	"go.fromyama/utils/response"
+)
+
+const getProductsSql = "SELECT sku, name, weight, length, width, height, COALESCE(hs_code, ''), COALESCE(origin_country, '') FROM products WHERE company_id = $1 ORDER BY sku"
+const getProductSql = "SELECT sku, name, weight, length, width, height, COALESCE(hs_code, ''), COALESCE(origin_country, '') FROM products WHERE company_id = $1 AND sku = $2"
+const setProductSql = "INSERT INTO products (company_id, sku, name, weight, length, width, height, hs_code, origin_country) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) " +
+	"ON CONFLICT (company_id, sku) DO UPDATE SET name = $3, weight = $4, length = $5, width = $6, height = $7, hs_code = $8, origin_country = $9"
+const deleteProductSql = "DELETE FROM products WHERE company_id = $1 AND sku = $2"
+const getDefaultParcelSql = "SELECT length, width, height, weight FROM parcel_options WHERE company_id = $1 AND is_default"
+
+// hsCodePattern is a harmonized system code, 6 to 10 digits optionally grouped with dots
+var hsCodePattern = regexp.MustCompile(`^\d{4}\.?\d{2}(\.?\d{2}){0,2}$`)
+
+// GetProducts /products returns the company product catalog ordered by sku
+func GetProducts (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+
+	rows, err := database.DB.Query(getProductsSql, tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Get Products Error")
+		return
+	}
+	defer rows.Close()
+	products := []response.Product{}
+	for rows.Next() {
+		var p response.Product
+		if err = rows.Scan(&p.Sku, &p.Name, &p.Weight, &p.Length, &p.Width, &p.Height, &p.HsCode, &p.OriginCountry); err != nil {
+			response.Error(w, "Get Products Error")
+			return
+		}
+		products = append(products, p)
+	}
+	response.JSON(w, http.StatusOK, products)
+}
+
+// SetProduct /products/{sku} adds a product to the catalog or replaces the one with the same sku
+// request url has sku
+// request body has name, weight in kg, length, width, height in cm, optionally hs_code and origin_country
+// declared to customs
+func SetProduct (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	sku := chi.URLParam(r, "sku")
+
+	var body map[string]string
+	err := utils.ParseRequestBody(r, &body, []string{"name", "weight", "length", "width", "height"})
+	if err != nil{
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+	product := response.Product{Sku: sku, Name: body["name"], HsCode: body["hs_code"], OriginCountry: strings.ToUpper(body["origin_country"])}
+	dimensions := map[string]*float64{"weight": &product.Weight, "length": &product.Length, "width": &product.Width, "height": &product.Height}
+	for _, field := range []string{"weight", "length", "width", "height"} {
+		value := dimensions[field]
+		if *value, err = strconv.ParseFloat(body[field], 64); err != nil || *value <= 0 {
+			response.Error(w, "Product " + field + " Must Be A Positive Number")
+			return
+		}
+	}
+	if product.HsCode != "" && !hsCodePattern.MatchString(product.HsCode) {
+		response.Error(w, "HS Code Must Be 6 To 10 Digits")
+		return
+	}
+	if product.OriginCountry != "" && len(product.OriginCountry) != 2 {
+		response.Error(w, "Origin Country Must Be A 2 Letter Country Code")
+		return
+	}
+
+	_, err = database.DB.Exec(setProductSql, tokenClaims.CompanyID, product.Sku, product.Name, product.Weight, product.Length, product.Width, product.Height,
+		nullString(product.HsCode), nullString(product.OriginCountry))
+	if err != nil {
+		response.Error(w, "Set Product Error")
+		return
+	}
+	response.JSON(w, http.StatusOK, product)
+}
+
+// DeleteProduct /products/{sku} removes a product from the catalog
+// request url has sku
+func DeleteProduct (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+
+	res, err := database.DB.Exec(deleteProductSql, tokenClaims.CompanyID, chi.URLParam(r, "sku"))
+	if err != nil {
+		response.Error(w, "Delete Product Error")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		response.JSON(w, http.StatusNotFound, response.BasicMessage{Message: "Product Not Found"})
+		return
+	}
+	response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Product Deleted"})
+}
+
+// getProduct util function that returns the catalog product with sku, ok is false when there is none
+func getProduct (companyID, sku string) (response.Product, bool, error) {
+	var p response.Product
+	err := database.DB.QueryRow(getProductSql, companyID, sku).Scan(&p.Sku, &p.Name, &p.Weight, &p.Length, &p.Width, &p.Height, &p.HsCode, &p.OriginCountry)
+	if err == sql.ErrNoRows {
+		return p, false, nil
+	}
+	return p, err == nil, err
+}
+
+// parseParcelRequestBody util function that parses a rate or label request body and checks the needed fields once
+// the ones left out are filled from the product catalog and the default parcel
+func parseParcelRequestBody (r *http.Request, companyID string, needed []string) (map[string]string, error) {
+	var body map[string]string
+	if err := utils.ParseRequestBody(r, &body, nil); err != nil {
+		return nil, err
+	}
+	if err := fillParcelDetails(companyID, body); err != nil {
+		return nil, err
+	}
+	return body, utils.CheckRequiredParams(body, needed)
+}
+
+// fillParcelDetails util function that completes a rate or label request body, the fields left out are taken from
+// the catalog product with the body sku, then the dimensions still missing from the company default parcel
+func fillParcelDetails (companyID string, body map[string]string) error {
+	if body["sku"] != "" {
+		product, ok, err := getProduct(companyID, body["sku"])
+		if err != nil {
+			return err
+		}
+		if ok {
+			fillMissing(body, map[string]string{
+				"weight": strconv.FormatFloat(product.Weight, 'f', -1, 64),
+				"length": strconv.FormatFloat(product.Length, 'f', -1, 64),
+				"width": strconv.FormatFloat(product.Width, 'f', -1, 64),
+				"height": strconv.FormatFloat(product.Height, 'f', -1, 64),
+				"contents": product.Name,
+				"hs_code": product.HsCode,
+				"origin_country": product.OriginCountry,
+			})
+		}
+	}
+	if body["length"] != "" && body["width"] != "" && body["height"] != "" && body["weight"] != "" {
+		return nil
+	}
+	var parcel response.Parcel
+	err := database.DB.QueryRow(getDefaultParcelSql, companyID).Scan(&parcel.Length, &parcel.Width, &parcel.Height, &parcel.Weight)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	fillMissing(body, map[string]string{
+		"length": strconv.FormatFloat(parcel.Length, 'f', -1, 64),
+		"width": strconv.FormatFloat(parcel.Width, 'f', -1, 64),
+		"height": strconv.FormatFloat(parcel.Height, 'f', -1, 64),
+		"weight": strconv.FormatFloat(parcel.Weight, 'f', -1, 64),
+	})
+	return nil
+}
+
+// fillMissing util function that sets the fields of body that are empty to the non empty values
+func fillMissing (body map[string]string, values map[string]string) {
+	for field, value := range values {
+		if body[field] == "" && value != "" {
+			body[field] = value
+		}
+	}
+}
+
+// nullString util function that stores an empty string as null
+func nullString (s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
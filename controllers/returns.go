@@ -0,0 +1,274 @@
+package controllers
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+
+	"go.fromyama/utils"
+	"go.fromyama/utils/address"
+	"go.fromyama/utils/carriers"
+	"go.fromyama/utils/database"
+	"go.fromyama/utils/jwtUtil"
+	"go.fromyama/utils/response"
+	"go.fromyama/utils/storage"
+)
+
+const getReturnSourceLabelSql = "SELECT COALESCE(name, ''), COALESCE(street, ''), COALESCE(city, ''), COALESCE(province_code, ''), COALESCE(country, ''), COALESCE(postal_code, ''), COALESCE(weight, ''), COALESCE(order_id, '') FROM labels WHERE id = $1 AND company_id = $2"
+const addReturnLabelSql = "INSERT INTO labels(company_id, user_id, label, tracking_pin, name, street, city, province_code, postal_code, country, service_code, label_format, carrier_cost, price, weight, order_id, return_of, carrier, refund_link, charge_id, carrier_billed, is_return) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, true) RETURNING id"
+
+// canadaPostReturnFormats are the formats the authorized return endpoint can produce itself
+var canadaPostReturnFormats = canadaPostNonContractFormats
+
+// BuyReturnLabel /returns creates a prepaid authorized return label from the buyer back to the company
+// request body has service_code, weight and either label_id of the outbound label or name, street, city,
+// province_code, postal_code of the buyer with optionally order_id, optionally length, width, height,
+// label_format, email to send the label to the buyer, location_id of the location it goes back to
+func BuyReturnLabel (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+
+	var body map[string]string
+	err := utils.ParseRequestBody(r, &body, []string{"service_code"})
+	if err != nil{
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+
+	// the buyer of the outbound shipment is the one returning the parcel
+	returner := postageAddressFromBody(body)
+	weight := body["weight"]
+	if body["label_id"] != "" {
+		getLabelQuery, err := database.DB.Prepare(getReturnSourceLabelSql)
+		if err != nil {
+			response.Error(w, "Get Label Error")
+			return
+		}
+		defer getLabelQuery.Close()
+		var labelWeight, orderID string
+		err = getLabelQuery.QueryRow(body["label_id"], tokenClaims.CompanyID).Scan(&returner.ShipperName, &returner.Street, &returner.City,
+			&returner.ProvinceCode, &returner.Country, &returner.PostalCode, &labelWeight, &orderID)
+		if err != nil {
+			response.JSON(w, http.StatusNotFound, response.BasicMessage{Message: "Label Not Found"})
+			return
+		}
+		if weight == "" {
+			weight = labelWeight
+		}
+		if body["order_id"] == "" {
+			body["order_id"] = orderID
+		}
+	} else if err = utils.CheckRequiredParams(body, []string{"name", "street", "city", "province_code", "postal_code"}); err != nil {
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+	if weight == "" {
+		response.Error(w, "Body Parse Error, weight Missing")
+		return
+	}
+
+	if returner.Country == "" {
+		returner.Country = "CA"
+	}
+	validated, err := address.Provider.Validate(address.Address{
+		Name: returner.ShipperName,
+		Street: returner.Street,
+		City: returner.City,
+		Province: returner.ProvinceCode,
+		Country: returner.Country,
+		PostalCode: returner.PostalCode,
+	})
+	if err != nil {
+		response.Error(w, "Address Validation Unavailable")
+		return
+	}
+	if !validated.Valid {
+		response.JSON(w, http.StatusBadRequest, validated)
+		return
+	}
+	if validated.Address.Country != "CA" {
+		response.Error(w, "Returns Can Only Be Sent From Canada")
+		return
+	}
+	returner.Street = validated.Address.Street
+	returner.City = validated.Address.City
+	returner.ProvinceCode = validated.Address.Province
+	returner.Country = validated.Address.Country
+	returner.PostalCode = validated.Address.PostalCode
+
+	var company response.Shipper
+	var paymentAccount, email string
+	getShippingInfoQuery, err := database.DB.Prepare(getShippingInfoAndPaymentSql)
+	if err != nil {
+		response.Error(w, "Get Shipper Error")
+		return
+	}
+	defer getShippingInfoQuery.Close()
+	err = getShippingInfoQuery.QueryRow(tokenClaims.CompanyID).Scan(&company.Address.ShipperName, &company.Address.Street, &company.Address.City, &company.Address.ProvinceCode, &company.Address.Country, &company.Address.PostalCode, &company.Address.Phone, &paymentAccount, &email)
+	if err != nil {
+		response.Error(w, "Get Shipper Error")
+		return
+	}
+	if err = shipFrom(tokenClaims.CompanyID, body, &company.Address); err != nil {
+		response.Error(w, "Get Shipper Error, " + err.Error())
+		return
+	}
+
+	account, err := getCanadaPostAccount(tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Get Shipper Error")
+		return
+	}
+	returnAccount := account
+	if !account.isContract() {
+		// authorized returns need a contract, companies without one return on the platform contract
+		returnAccount.ContractID = os.Getenv("CANADA_POST_CONTRACT_ID")
+		if returnAccount.ContractID == "" {
+			response.Error(w, "Returns Need A Canada Post Contract")
+			return
+		}
+	}
+
+	labelFormat, err := resolveLabelFormat(tokenClaims.CompanyID, body["label_format"])
+	if err != nil {
+		response.Error(w, "Label Format Error")
+		return
+	}
+	carrierFormat, err := carrierLabelFormat(labelFormat, canadaPostReturnFormats)
+	if err != nil {
+		response.Error(w, err.Error())
+		return
+	}
+
+	companyPrices, err := getCompanyPricing(tokenClaims.CompanyID, account)
+	if err != nil {
+		response.Error(w, "Get Pricing Error")
+		return
+	}
+	origin := response.Shipper{Address: returner, Parcels: []response.Parcel{parcelFromBody(body)}}
+	cost, price, err := quoteCanadaPostLabel(returnAccount, companyPrices, origin, company.Address.PostalCode, weight, body["service_code"], nil)
+	if err != nil {
+		response.Error(w, "Get Rate Error")
+		return
+	}
+
+	chargeID, err := chargeForPostage(account, paymentAccount, cost, price, "Return Label Purchase")
+	if err != nil {
+		response.JSON(w, http.StatusConflict, response.BasicMessage{Message: "Payment Error"})
+		return
+	}
+
+	var authorizedReturn response.CanadaPostPostageResponse
+	err = canadaPostRequest("POST", "https://ct.soa-gw.canadapost.ca/rs/"+returnAccount.CustomerNumber+"/"+returnAccount.CustomerNumber+"/authorizedreturn",
+		"application/vnd.cpc.authreturn-v2+xml", "application/vnd.cpc.authreturn-v2+xml",
+		formatCanadaPostReturnBody(returnAccount, company, returner, weight, body["service_code"], carrierFormat, body["order_id"]), &authorizedReturn)
+	var labelLink, refundLink string
+	for i := range authorizedReturn.Links {
+		if authorizedReturn.Links[i].Name == "returnLabel" {
+			labelLink = authorizedReturn.Links[i].Link
+		}
+		if authorizedReturn.Links[i].Name == "refund" {
+			refundLink = authorizedReturn.Links[i].Link
+		}
+	}
+	if err != nil || labelLink == "" {
+		refundPostage(chargeID, 0)
+		response.Error(w, "Return Postage Error")
+		return
+	}
+
+	var labelID string
+	var returnOf interface{}
+	if body["label_id"] != "" {
+		returnOf = body["label_id"]
+	}
+	addLabelQuery, err := database.DB.Prepare(addReturnLabelSql)
+	if err == nil {
+		defer addLabelQuery.Close()
+		err = addLabelQuery.QueryRow(tokenClaims.CompanyID, tokenClaims.UserID, labelLink, authorizedReturn.Tracking, returner.ShipperName,
+			returner.Street, returner.City, returner.ProvinceCode, returner.PostalCode, returner.Country, body["service_code"], labelFormat,
+			float64(cost)/100.0, float64(price)/100.0, weight, body["order_id"], returnOf, carriers.CanadaPost, refundLink, chargeID, account.carrierBilled(carriers.CanadaPost)).Scan(&labelID)
+	}
+	if err != nil {
+		refundPostage(chargeID, 0)
+		response.Error(w, "Store Postage Error")
+		return
+	}
+
+	label, err := getCanadaPostDocument(labelLink, labelFormats[carrierFormat].ContentType)
+	if err == nil {
+		label, err = convertLabel(label, carrierFormat, labelFormat)
+	}
+	if err != nil {
+		response.Error(w, "Get Label Error")
+		return
+	}
+	if err = storeLabelDocument(tokenClaims.CompanyID, labelID, storage.KindLabel, labelFormats[labelFormat].ContentType, label); err != nil {
+		log.Printf("Store Label Error: %s", err.Error())
+	}
+
+	result := response.ReturnLabel{
+		LabelID: labelID,
+		ReturnOf: body["label_id"],
+		OrderID: body["order_id"],
+		TrackingNumber: authorizedReturn.Tracking,
+		Total: float64(price)/100.0,
+		PdfUrl: "/postage/labels/" + labelID + "/pdf",
+	}
+	if body["email"] != "" && labelFormats[labelFormat].Encoding == "PDF" {
+		var tmplBuffer bytes.Buffer
+		tmpl := template.Must(template.ParseFiles("assets/templates/returnLabel.html"))
+		_ = tmpl.Execute(&tmplBuffer, response.ReturnLabelEmail{CompanyName: company.Address.ShipperName, TrackingNumber: authorizedReturn.Tracking})
+		if err = SendEmail(body["email"], "Your Return Label", tmplBuffer.String(), label); err != nil {
+			log.Printf("Send Return Label Error: %s", err.Error())
+		} else {
+			result.Emailed = true
+		}
+	}
+
+	response.JSON(w, http.StatusAccepted, result)
+}
+
+// formatCanadaPostReturnBody formats xml body for authorized return request, the returner is the buyer and the
+// receiver is the company
+func formatCanadaPostReturnBody (account canadaPostAccount, company response.Shipper, returner response.PostageAddress, weight, serviceCode, labelFormat, orderID string) string {
+	xml := `<?xml version="1.0" encoding="utf-8"?>`
+	xml += `<authorized-return xmlns="http://www.canadapost.ca/ws/authreturn-v2">`
+	xml += `<service-code>`+escapeXML(serviceCode)+`</service-code>`
+	xml += `<returner>`
+	xml += `<name>`+escapeXML(returner.ShipperName)+`</name>`
+	xml += `<domestic-address>`
+	xml += `<address-line-1>`+escapeXML(returner.Street)+`</address-line-1>`
+	xml += `<city>`+escapeXML(returner.City)+`</city>`
+	xml += `<province>`+escapeXML(returner.ProvinceCode)+`</province>`
+	xml += `<postal-code>`+escapeXML(returner.PostalCode)+`</postal-code>`
+	xml += `</domestic-address>`
+	xml += `</returner>`
+	xml += `<receiver>`
+	xml += `<company>`+escapeXML(company.Address.ShipperName)+`</company>`
+	xml += `<domestic-address>`
+	xml += `<address-line-1>`+escapeXML(company.Address.Street)+`</address-line-1>`
+	xml += `<city>`+escapeXML(company.Address.City)+`</city>`
+	xml += `<province>`+escapeXML(company.Address.ProvinceCode)+`</province>`
+	xml += `<postal-code>`+escapeXML(company.Address.PostalCode)+`</postal-code>`
+	xml += `</domestic-address>`
+	xml += `</receiver>`
+	xml += `<parcel-characteristics>`
+	xml += `<weight>`+escapeXML(weight)+`</weight>`
+	xml += `</parcel-characteristics>`
+	xml += `<print-preferences>`
+	xml += `<output-format>`+labelFormats[labelFormat].OutputFormat+`</output-format>`
+	xml += `<encoding>`+labelFormats[labelFormat].Encoding+`</encoding>`
+	xml += `</print-preferences>`
+	xml += `<settlement-info>`
+	xml += `<contract-id>`+escapeXML(account.ContractID)+`</contract-id>`
+	xml += `</settlement-info>`
+	if orderID != "" {
+		xml += `<references>`
+		xml += `<customer-ref-1>`+escapeXML(orderID)+`</customer-ref-1>`
+		xml += `</references>`
+	}
+	xml += `</authorized-return>`
+	return xml
+}
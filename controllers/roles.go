@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"go.fromyama/utils"
+	"go.fromyama/utils/database"
+	"go.fromyama/utils/jwtUtil"
+	"go.fromyama/utils/response"
+	"go.fromyama/utils/roles"
+)
+
+// userRoleSql is the role of a user, members from before roles existed are the owner when head and shippers
+// otherwise since they could buy labels
+const userRoleSql = "COALESCE(role, CASE WHEN is_head THEN 'owner' ELSE 'shipper' END)"
+
+const setMemberRoleSql = "UPDATE users SET role = $1 WHERE id = $2 AND company_id = $3"
+
+// GetRoles /roles returns every role and its permissions
+func GetRoles (w http.ResponseWriter, r *http.Request){
+	all := []response.Role{}
+	for _, role := range roles.All {
+		all = append(all, response.Role{Name: role, Permissions: roles.Permissions(role)})
+	}
+	response.JSON(w, http.StatusOK, all)
+}
+
+// SetMemberRole /employee/{employeeID}/role changes the role of a member of the company, members can only change
+// members less trusted than themselves to roles less trusted than their own and the owner role changes with the head
+// of the company, the member gets the role when their token is next refreshed
+// request url has employeeID
+// request body has role
+func SetMemberRole (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	var body map[string]string
+	err := utils.ParseRequestBody(r, &body, []string{"role"})
+	if err != nil{
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+	role := body["role"]
+	if !roles.Valid(role) {
+		response.Error(w, "Unknown Role " + role)
+		return
+	}
+	if role == roles.Owner {
+		response.Error(w, "Owner Role Can Not Be Assigned")
+		return
+	}
+	m, ok := companyMember(w, tokenClaims, chi.URLParam(r, "employeeID"))
+	if !ok {
+		return
+	}
+	if m.ID == tokenClaims.UserID {
+		response.JSON(w, http.StatusForbidden, response.BasicMessage{Message: "Can Not Change Your Own Role"})
+		return
+	}
+	if !roles.CanManage(tokenClaims.Role, m.Role) || !roles.CanManage(tokenClaims.Role, role) {
+		response.JSON(w, http.StatusForbidden, response.BasicMessage{Message: "Role Not Permitted"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		response.Error(w, "Set Role Error")
+		return
+	}
+	defer tx.Rollback()
+	if _, err = tx.Exec(setMemberRoleSql, role, m.ID, tokenClaims.CompanyID); err != nil {
+		response.Error(w, "Set Role Error")
+		return
+	}
+	if err = auditMemberAction(tx, tokenClaims, m.ID, auditRole, m.Role + " -> " + role); err != nil {
+		response.Error(w, "Set Role Error")
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		response.Error(w, "Set Role Error")
+		return
+	}
+	response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Role Changed"})
+}
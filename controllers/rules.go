@@ -0,0 +1,339 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"go.fromyama/utils/address"
+	"go.fromyama/utils/carriers"
+	"go.fromyama/utils/database"
+	"go.fromyama/utils/jwtUtil"
+	"go.fromyama/utils/response"
+	"go.fromyama/utils/rules"
+)
+
+const getRulesSql = "SELECT id, name, priority, enabled, conditions, action FROM shipping_rules WHERE company_id = $1 ORDER BY priority, id"
+const addRuleSql = "INSERT INTO shipping_rules (company_id, name, priority, enabled, conditions, action) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id"
+const updateRuleSql = "UPDATE shipping_rules SET name = $1, priority = $2, enabled = $3, conditions = $4, action = $5 WHERE id = $6 AND company_id = $7"
+const deleteRuleSql = "DELETE FROM shipping_rules WHERE id = $1 AND company_id = $2"
+const parcelExistsSql = "SELECT EXISTS (SELECT 1 FROM parcel_options WHERE id = $1 AND company_id = $2)"
+const locationExistsSql = "SELECT EXISTS (SELECT 1 FROM locations WHERE id = $1 AND company_id = $2)"
+const getParcelOptionSql = "SELECT length, width, height, COALESCE(empty_weight, 0) FROM parcel_options WHERE id = $1 AND company_id = $2"
+
+const maxPrepareOrders = 250
+
+// GetShippingRules /rules returns the company shipping rules in the order they are tried
+func GetShippingRules (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	companyRules, err := getShippingRules(tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Get Rules Error")
+		return
+	}
+	response.JSON(w, http.StatusOK, companyRules)
+}
+
+// AddShippingRule /rules adds a shipping rule
+// request body has name, priority (lowest is tried first), conditions (field, operator, value), action (carrier,
+// service_code, parcel_id, options, location_id) and optionally enabled (defaults to true)
+func AddShippingRule (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	rule, err := parseShippingRule(r, tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Rule Error, " + err.Error())
+		return
+	}
+	conditions, _ := json.Marshal(rule.Conditions)
+	action, _ := json.Marshal(rule.Action)
+	err = database.DB.QueryRow(addRuleSql, tokenClaims.CompanyID, rule.Name, rule.Priority, rule.Enabled, string(conditions), string(action)).Scan(&rule.ID)
+	if err != nil {
+		response.Error(w, "Add Rule Error")
+		return
+	}
+	response.JSON(w, http.StatusCreated, rule)
+}
+
+// UpdateShippingRule /rules/{ruleID} replaces a shipping rule
+// request url has ruleID
+// request body has the same fields as adding a rule
+func UpdateShippingRule (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	rule, err := parseShippingRule(r, tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Rule Error, " + err.Error())
+		return
+	}
+	rule.ID = chi.URLParam(r, "ruleID")
+	conditions, _ := json.Marshal(rule.Conditions)
+	action, _ := json.Marshal(rule.Action)
+	res, err := database.DB.Exec(updateRuleSql, rule.Name, rule.Priority, rule.Enabled, string(conditions), string(action), rule.ID, tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Update Rule Error")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		response.JSON(w, http.StatusNotFound, response.BasicMessage{Message: "Rule Not Found"})
+		return
+	}
+	response.JSON(w, http.StatusOK, rule)
+}
+
+// DeleteShippingRule /rules/{ruleID} removes a shipping rule
+// request url has ruleID
+func DeleteShippingRule (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	res, err := database.DB.Exec(deleteRuleSql, chi.URLParam(r, "ruleID"), tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Delete Rule Error")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		response.JSON(w, http.StatusNotFound, response.BasicMessage{Message: "Rule Not Found"})
+		return
+	}
+	response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Rule Deleted"})
+}
+
+// DryRunShippingRules /rules/dry-run returns which rule an order matches, why the rules tried before it did not,
+// and the shipment it would be prepared with, nothing is stored
+// request body has order as returned by /orders/all, optionally rules to try instead of the saved ones
+func DryRunShippingRules (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+
+	var body response.RuleDryRunRequest
+	err := json.NewDecoder(r.Body).Decode(&body)
+	defer r.Body.Close()
+	if err != nil {
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+	companyRules := body.Rules
+	if companyRules == nil {
+		if companyRules, err = getShippingRules(tokenClaims.CompanyID); err != nil {
+			response.Error(w, "Get Rules Error")
+			return
+		}
+	}
+	for _, rule := range companyRules {
+		if err = rules.Validate(rule); err != nil {
+			response.Error(w, "Rule Error, " + err.Error())
+			return
+		}
+	}
+
+	products := map[string]response.Product{}
+	evaluation := rules.Evaluate(companyRules, orderFacts(tokenClaims.CompanyID, body.Order, products))
+	shipment, err := prepareShipment(tokenClaims.CompanyID, body.Order, evaluation.Matched, products)
+	if err != nil {
+		response.Error(w, "Prepare Shipment Error, " + err.Error())
+		return
+	}
+	response.JSON(w, http.StatusOK, response.RuleDryRun{Evaluation: evaluation, Shipment: shipment})
+}
+
+// PrepareShipments /prepare applies the company shipping rules to orders and returns the label request of each,
+// ready for /batches once the fields the orders do not have are added
+// request body has orders as returned by /orders/all
+func PrepareShipments (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+
+	var body response.PrepareRequest
+	err := json.NewDecoder(r.Body).Decode(&body)
+	defer r.Body.Close()
+	if err != nil {
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+	if len(body.Orders) == 0 {
+		response.Error(w, "Body Parse Error, orders Missing")
+		return
+	}
+	if len(body.Orders) > maxPrepareOrders {
+		response.Error(w, "Too Many Orders, Max " + strconv.Itoa(maxPrepareOrders))
+		return
+	}
+	companyRules, err := getShippingRules(tokenClaims.CompanyID)
+	if err != nil {
+		response.Error(w, "Get Rules Error")
+		return
+	}
+
+	products := map[string]response.Product{}
+	prepared := []response.PreparedShipment{}
+	for _, order := range body.Orders {
+		evaluation := rules.Evaluate(companyRules, orderFacts(tokenClaims.CompanyID, order, products))
+		shipment, err := prepareShipment(tokenClaims.CompanyID, order, evaluation.Matched, products)
+		if err != nil {
+			response.Error(w, "Prepare Shipment Error, " + err.Error())
+			return
+		}
+		p := response.PreparedShipment{OrderID: order.OrderID, Shipment: shipment}
+		if evaluation.Matched != nil {
+			p.RuleID, p.RuleName = evaluation.Matched.ID, evaluation.Matched.Name
+		}
+		prepared = append(prepared, p)
+	}
+	response.JSON(w, http.StatusOK, prepared)
+}
+
+// getShippingRules util function that returns the rules of a company by priority
+func getShippingRules (companyID string) ([]rules.Rule, error) {
+	rows, err := database.DB.Query(getRulesSql, companyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	companyRules := []rules.Rule{}
+	for rows.Next() {
+		var rule rules.Rule
+		var conditions, action []byte
+		if err = rows.Scan(&rule.ID, &rule.Name, &rule.Priority, &rule.Enabled, &conditions, &action); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(conditions, &rule.Conditions); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(action, &rule.Action); err != nil {
+			return nil, err
+		}
+		companyRules = append(companyRules, rule)
+	}
+	return companyRules, rows.Err()
+}
+
+// parseShippingRule util function that decodes a rule from the request body and checks its action refers to a
+// known carrier and to a parcel and location of the company
+func parseShippingRule (r *http.Request, companyID string) (rules.Rule, error) {
+	// a rule is enabled unless the body says otherwise
+	rule := rules.Rule{Enabled: true}
+	err := json.NewDecoder(r.Body).Decode(&rule)
+	defer r.Body.Close()
+	if err != nil {
+		return rule, err
+	}
+	if err = rules.Validate(rule); err != nil {
+		return rule, err
+	}
+	if rule.Conditions == nil {
+		rule.Conditions = []rules.Condition{}
+	}
+	if rule.Action.Carrier != "" && rule.Action.Carrier != carriers.CanadaPost {
+		if _, err = getCarrier(rule.Action.Carrier); err != nil {
+			return rule, err
+		}
+		if err = checkCarrierOptions(rule.Action.Carrier, map[string]string{"options": rule.Action.Options}); err != nil {
+			return rule, err
+		}
+	}
+	if rule.Action.Options != "" && (rule.Action.Carrier == "" || rule.Action.Carrier == carriers.CanadaPost) {
+		if _, err = parseShippingOptions(map[string]string{"options": rule.Action.Options}); err != nil {
+			return rule, err
+		}
+	}
+	var exists bool
+	if rule.Action.ParcelID != "" {
+		if err = database.DB.QueryRow(parcelExistsSql, rule.Action.ParcelID, companyID).Scan(&exists); err != nil || !exists {
+			return rule, &parcelError{"Parcel Not Found"}
+		}
+	}
+	if rule.Action.LocationID != "" {
+		if err = database.DB.QueryRow(locationExistsSql, rule.Action.LocationID, companyID).Scan(&exists); err != nil || !exists {
+			return rule, &locationError{"Location Not Found"}
+		}
+	}
+	return rule, nil
+}
+
+// orderFacts util function that returns the fields of an order rules are tested on, the weight of an order the
+// platform did not weigh is the catalog weight of its items
+func orderFacts (companyID string, order response.Order, products map[string]response.Product) rules.Facts {
+	facts := rules.Facts{
+		Platform: strings.ToLower(order.Type),
+		Country: address.NormalizeCountry(order.ShippingAddress.Country),
+		Province: order.ShippingAddress.Province,
+		Weight: order.Weight,
+		Tags: order.Tags,
+	}
+	facts.Total, _ = strconv.ParseFloat(order.Total, 64)
+	for _, item := range order.Items {
+		if item.Sku != "" {
+			facts.SKUs = append(facts.SKUs, item.Sku)
+		}
+	}
+	if facts.Weight <= 0 {
+		facts.Weight = catalogWeight(companyID, order.Items, products)
+	}
+	return facts
+}
+
+// catalogWeight util function that sums the catalog weight of items, products caches the catalog across orders
+func catalogWeight (companyID string, items []response.Item, products map[string]response.Product) float64 {
+	var weight float64
+	for _, item := range items {
+		product, ok := products[item.Sku]
+		if !ok && item.Sku != "" {
+			product, _, _ = getProduct(companyID, item.Sku)
+			products[item.Sku] = product
+		}
+		quantity, err := strconv.Atoi(item.Quantity)
+		if err != nil || quantity < 1 {
+			quantity = 1
+		}
+		weight += product.Weight * float64(quantity)
+	}
+	return weight
+}
+
+// prepareShipment util function that returns the label request fields of an order with the action of the rule
+// it matched, the parcel of the action sets the dimensions and adds its empty weight
+func prepareShipment (companyID string, order response.Order, rule *rules.Rule, products map[string]response.Product) (map[string]string, error) {
+	shipping := order.ShippingAddress
+	shipment := map[string]string{
+		"order_id": order.OrderID,
+		"name": shipping.Name,
+		"street": shipping.Address1,
+		"city": shipping.City,
+		"province_code": shipping.Province,
+		"country_code": address.NormalizeCountry(shipping.Country),
+		"postal_code": shipping.PostalCode,
+		"location_id": order.LocationID,
+	}
+	weight := order.Weight
+	if weight <= 0 {
+		weight = catalogWeight(companyID, order.Items, products)
+	}
+	if rule != nil {
+		action := rule.Action
+		shipment["carrier"] = action.Carrier
+		shipment["service_code"] = action.ServiceCode
+		shipment["options"] = action.Options
+		if action.LocationID != "" {
+			shipment["location_id"] = action.LocationID
+		}
+		if action.ParcelID != "" {
+			var parcel response.Parcel
+			err := database.DB.QueryRow(getParcelOptionSql, action.ParcelID, companyID).Scan(&parcel.Length, &parcel.Width, &parcel.Height, &parcel.EmptyWeight)
+			if err != nil {
+				return nil, &parcelError{"Parcel Not Found"}
+			}
+			shipment["length"] = strconv.FormatFloat(parcel.Length, 'f', -1, 64)
+			shipment["width"] = strconv.FormatFloat(parcel.Width, 'f', -1, 64)
+			shipment["height"] = strconv.FormatFloat(parcel.Height, 'f', -1, 64)
+			weight += parcel.EmptyWeight
+		}
+	}
+	if weight > 0 {
+		shipment["weight"] = strconv.FormatFloat(weight, 'f', 3, 64)
+	}
+	// the label endpoints reject empty fields
+	for field, value := range shipment {
+		if value == "" {
+			delete(shipment, field)
+		}
+	}
+	return shipment, nil
+}
@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"database/sql"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"go.fromyama/utils"
+	"go.fromyama/utils/database"
+	"go.fromyama/utils/jwtUtil"
+	"go.fromyama/utils/response"
+)
+
+const createSessionSql = "INSERT INTO sessions(user_id, device, ip_address) VALUES ($1, $2, $3) RETURNING id"
+const addRefreshTokenSql = "INSERT INTO refresh_tokens(session_id, token_hash, expires_at) VALUES ($1, $2, $3)"
+const getRefreshTokenSql = "SELECT t.id, t.session_id, s.user_id, t.used_at IS NOT NULL, t.expires_at < now(), s.revoked_at IS NOT NULL FROM refresh_tokens t INNER JOIN sessions s on s.id = t.session_id WHERE t.token_hash = $1"
+const useRefreshTokenSql = "UPDATE refresh_tokens SET used_at = now() WHERE id = $1 AND used_at IS NULL"
+const touchSessionSql = "UPDATE sessions SET last_used_at = now() WHERE id = $1"
+const getSessionUserSql = "SELECT email, company_id, is_approved, " + userRoleSql + ", totp_enabled_at IS NOT NULL, " + requireTwoFactorSql + " FROM users WHERE id = $1 AND removed_at IS NULL"
+const getSessionsSql = "SELECT id, COALESCE(device, ''), COALESCE(ip_address, ''), created_at, COALESCE(last_used_at, created_at) FROM sessions WHERE user_id = $1 AND revoked_at IS NULL ORDER BY COALESCE(last_used_at, created_at) DESC"
+const revokeSessionSql = "UPDATE sessions SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL"
+const revokeUserSessionSql = "UPDATE sessions SET revoked_at = now() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL"
+const revokeUserSessionsSql = "UPDATE sessions SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL"
+
+// RefreshToken /user/refresh trades a refresh token for a new token and refresh token, the claims are read again
+// from the user so approval, role and two factor policy changes apply, a refresh token works once and presenting a used one again revokes its
+// session since either the client or someone who stole it already moved on to the next one
+// request body has refresh_token
+func RefreshToken(w http.ResponseWriter, r *http.Request){
+	var body map[string]string
+	err := utils.ParseRequestBody(r, &body, []string{"refresh_token"})
+	if err != nil{
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+
+	var tokenID, sessionID, userID string
+	var used, expired, revoked bool
+	err = database.DB.QueryRow(getRefreshTokenSql, jwtUtil.HashRefreshToken(body["refresh_token"])).Scan(&tokenID, &sessionID, &userID, &used, &expired, &revoked)
+	if err == sql.ErrNoRows {
+		response.Forbidden(w)
+		return
+	} else if err != nil {
+		response.Error(w, "Refresh Token Error")
+		return
+	}
+	if revoked || expired {
+		response.Forbidden(w)
+		return
+	}
+	if used {
+		revokeReusedSession(sessionID)
+		response.Forbidden(w)
+		return
+	}
+	res, err := database.DB.Exec(useRefreshTokenSql, tokenID)
+	if err != nil {
+		response.Error(w, "Refresh Token Error")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// another request used the token between the read and the update
+		revokeReusedSession(sessionID)
+		response.Forbidden(w)
+		return
+	}
+
+	tokenClaims, err := userTokenClaims(userID)
+	tokenClaims.SessionID = sessionID
+	if err == sql.ErrNoRows {
+		database.DB.Exec(revokeSessionSql, sessionID)
+		response.Forbidden(w)
+		return
+	} else if err != nil {
+		response.Error(w, "Refresh Token Error")
+		return
+	}
+	token, err := issueSessionTokens(tokenClaims)
+	if err != nil {
+		response.Error(w, "Token Generation Error")
+		return
+	}
+	database.DB.Exec(touchSessionSql, sessionID)
+	response.JSON(w, http.StatusAccepted, *token)
+}
+
+// GetSessions /user/sessions returns the devices the user is logged in on, current is the one making the request
+func GetSessions(w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	rows, err := database.DB.Query(getSessionsSql, tokenClaims.UserID)
+	if err != nil {
+		response.Error(w, "Get Sessions Error")
+		return
+	}
+	defer rows.Close()
+	sessions := []response.Session{}
+	for rows.Next() {
+		var s response.Session
+		if err = rows.Scan(&s.ID, &s.Device, &s.IPAddress, &s.CreatedAt, &s.LastUsedAt); err != nil {
+			response.Error(w, "Get Sessions Error")
+			return
+		}
+		s.Current = s.ID == tokenClaims.SessionID
+		sessions = append(sessions, s)
+	}
+	response.JSON(w, http.StatusOK, sessions)
+}
+
+// RevokeSession /user/sessions/{sessionID} logs the user out on one device, its refresh token stops working and
+// tokens already issued to it run out within jwtUtil.AccessTokenLifetime
+// request url has sessionID
+func RevokeSession(w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	res, err := database.DB.Exec(revokeUserSessionSql, chi.URLParam(r, "sessionID"), tokenClaims.UserID)
+	if err != nil {
+		response.Error(w, "Revoke Session Error")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		response.JSON(w, http.StatusNotFound, response.BasicMessage{Message: "Session Not Found"})
+		return
+	}
+	response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Session Revoked"})
+}
+
+// Logout /user/logout ends the session of the token making the request
+func Logout(w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	if tokenClaims.SessionID != "" {
+		if _, err := database.DB.Exec(revokeUserSessionSql, tokenClaims.SessionID, tokenClaims.UserID); err != nil {
+			response.Error(w, "Logout Error")
+			return
+		}
+	}
+	response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Logged Out"})
+}
+
+// LogoutEverywhere /user/logout/all ends every session of the user, including the one making the request
+func LogoutEverywhere(w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	if err := revokeUserSessions(tokenClaims.UserID); err != nil {
+		response.Error(w, "Logout Error")
+		return
+	}
+	response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Logged Out Everywhere"})
+}
+
+// startSession util function that opens a session for the device making the request and returns its first token
+// and refresh token
+func startSession (r *http.Request, tokenClaims jwtUtil.TokenClaims) (*response.Token, error) {
+	device := r.UserAgent()
+	if len(device) > 255 {
+		device = device[:255]
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	err = database.DB.QueryRow(createSessionSql, tokenClaims.UserID, nullString(device), nullString(ip)).Scan(&tokenClaims.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	return issueSessionTokens(tokenClaims)
+}
+
+// issueSessionTokens util function that signs a token for the session of tokenClaims and stores a new refresh token
+// for it, only the hash of the refresh token is stored
+func issueSessionTokens (tokenClaims jwtUtil.TokenClaims) (*response.Token, error) {
+	refreshToken, hash, err := jwtUtil.NewRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	_, err = database.DB.Exec(addRefreshTokenSql, tokenClaims.SessionID, hash, time.Now().Add(jwtUtil.RefreshTokenLifetime))
+	if err != nil {
+		return nil, err
+	}
+	token, err := jwtUtil.GenerateToken(tokenClaims)
+	if err != nil {
+		return nil, err
+	}
+	return &response.Token{
+		Raw: token,
+		RefreshToken: refreshToken,
+		ExpiresIn: int(jwtUtil.AccessTokenLifetime.Seconds()),
+	}, nil
+}
+
+// revokeReusedSession util function that ends a session whose used refresh token was presented again
+func revokeReusedSession (sessionID string) {
+	log.Printf("Refresh Token Reused, Revoking Session %s", sessionID)
+	if _, err := database.DB.Exec(revokeSessionSql, sessionID); err != nil {
+		log.Printf("Revoke Session Error: %s", err.Error())
+	}
+}
+
+// revokeUserSessions util function that ends every session of a user
+func revokeUserSessions (userID string) error {
+	_, err := database.DB.Exec(revokeUserSessionsSql, userID)
+	return err
+}
+
+// userTokenClaims util function that reads the claims of a user for a new token, users their company requires two
+// factor authentication of and who have not set it up yet can only set it up
+func userTokenClaims (userID string) (jwtUtil.TokenClaims, error) {
+	tokenClaims := jwtUtil.TokenClaims{UserID: userID}
+	var enabled, required bool
+	err := database.DB.QueryRow(getSessionUserSql, userID).Scan(&tokenClaims.Email, &tokenClaims.CompanyID, &tokenClaims.Approved, &tokenClaims.Role, &enabled, &required)
+	tokenClaims.TwoFactorSetupRequired = twoFactorSetupRequired(tokenClaims.Role, enabled, required)
+	return tokenClaims, err
+}
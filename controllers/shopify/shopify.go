@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -25,6 +26,7 @@ import (
 const updateShopifyTokenSql = "UPDATE companies SET shopify_store = $1 ,shopify_token = $2, temp_data = null WHERE temp_data = $3"
 const updateTempUUIDSql = "UPDATE companies SET temp_data = $1 WHERE id = $2"
 const getShopifyTokenSql = "SELECT shopify_token, shopify_store FROM companies WHERE id = $1"
+const getMappedLocationsSql = "SELECT shopify_location_id, id FROM locations WHERE company_id = $1 AND shopify_location_id IS NOT NULL"
 
 // FulfillOrder /fulfill fulfills order
 // request body has order_id, location_id, notify_customer
@@ -136,7 +138,14 @@ func GetUnfulfilledOrders (w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		response.Error(w, "Unmarshal Error")
 	} else {
-		response.JSON(w, http.StatusOK, formatShopifyOrder(jsonResp))
+		locations, err := getMappedLocations(tokenClaims.CompanyID)
+		if err != nil {
+			response.Error(w, "Get Locations Error")
+			return
+		}
+		orders := formatShopifyOrder(jsonResp, locations)
+		utils.ValidateOrderAddresses(&orders)
+		response.JSON(w, http.StatusOK, orders)
 	}
 }
 
@@ -219,8 +228,9 @@ func Callback(w http.ResponseWriter, r *http.Request){
 	}
 }
 
-// formatShopifyOrder util function that takes response from shopify and formats to fy order
-func formatShopifyOrder (resp response.ShopifyUnfulfilledResponse) response.Orders {
+// formatShopifyOrder util function that takes response from shopify and formats to fy order, orders assigned to a
+// shopify location mapped in locations ship from the mapped location
+func formatShopifyOrder (resp response.ShopifyUnfulfilledResponse, locations map[string]string) response.Orders {
 	var orders response.Orders
 
 	for i := range resp.Orders {
@@ -253,6 +263,10 @@ func formatShopifyOrder (resp response.ShopifyUnfulfilledResponse) response.Orde
 			Currency: resp.Orders[i].Currency,
 			Name: resp.Orders[i].Name,
 			WasPaid: resp.Orders[i].FinancialStatus == "paid",
+			Note: resp.Orders[i].Note,
+			LocationID: locations[strconv.FormatInt(resp.Orders[i].LocationID, 10)],
+			Weight: float64(resp.Orders[i].TotalWeight)/1000.0,
+			Tags: splitTags(resp.Orders[i].Tags),
 			Items: items,
 			ShippingAddress: add,
 		}
@@ -261,6 +275,35 @@ func formatShopifyOrder (resp response.ShopifyUnfulfilledResponse) response.Orde
 	return orders
 }
 
+// splitTags util function that splits the comma separated tags of a shopify order
+func splitTags (tags string) []string {
+	var split []string
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			split = append(split, tag)
+		}
+	}
+	return split
+}
+
+// getMappedLocations util function that returns the ship from location ids of the company by shopify location id
+func getMappedLocations (companyID string) (map[string]string, error) {
+	rows, err := database.DB.Query(getMappedLocationsSql, companyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	locations := map[string]string{}
+	for rows.Next() {
+		var shopifyID, id string
+		if err = rows.Scan(&shopifyID, &id); err != nil {
+			return nil, err
+		}
+		locations[shopifyID] = id
+	}
+	return locations, rows.Err()
+}
+
 // shopifyRequest util function to make shopify api requests
 func shopifyRequest (method, url, token string, body []byte) ([]byte, error) {
 	client := &http.Client{
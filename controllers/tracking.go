@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"go.fromyama/utils/carriers"
+	"go.fromyama/utils/database"
+	"go.fromyama/utils/jwtUtil"
+	"go.fromyama/utils/response"
+	"go.fromyama/utils/tracking"
+)
+
+const getLabelTrackingSql = "SELECT COALESCE(carrier, 'canadapost'), COALESCE(tracking_pin, ''), COALESCE(tracking_status, ''), tracking_checked_at FROM labels WHERE id = $1 AND company_id = $2"
+const getTrackingEventsSql = "SELECT status, code, description, location, occurred_at FROM tracking_events WHERE label_id = $1 ORDER BY occurred_at DESC"
+const addTrackingEventSql = "INSERT INTO tracking_events(label_id, status, code, description, location, occurred_at) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (label_id, code, occurred_at) DO NOTHING"
+const updateLabelTrackingSql = "UPDATE labels SET tracking_status = $1, tracking_checked_at = now() WHERE id = $2"
+const getLabelsToTrackSql = "SELECT id, COALESCE(carrier, 'canadapost'), tracking_pin FROM labels WHERE tracking_pin IS NOT NULL AND tracking_pin <> '' AND COALESCE(tracking_status, '') <> $1 AND voided_at IS NULL AND created_at > now() - interval '60 days' ORDER BY tracking_checked_at NULLS FIRST LIMIT 200"
+
+// canadaPostTimeZones offsets of the zone abbreviations canada post uses for tracking events
+var canadaPostTimeZones = map[string]int{
+	"NST": -3*3600 - 1800, "NDT": -2*3600 - 1800,
+	"AST": -4 * 3600, "ADT": -3 * 3600,
+	"EST": -5 * 3600, "EDT": -4 * 3600,
+	"CST": -6 * 3600, "CDT": -5 * 3600,
+	"MST": -7 * 3600, "MDT": -6 * 3600,
+	"PST": -8 * 3600, "PDT": -7 * 3600,
+}
+
+// GetLabelTracking /labels/{labelID}/tracking returns the tracking status and event history of a label
+// request url has labelID, optionally refresh=true to check the carrier now
+func GetLabelTracking (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	labelID := chi.URLParam(r, "labelID")
+
+	getTrackingQuery, err := database.DB.Prepare(getLabelTrackingSql)
+	if err != nil {
+		response.Error(w, "Get Tracking Error")
+		return
+	}
+	defer getTrackingQuery.Close()
+
+	var carrierName string
+	var checkedAt *time.Time
+	result := response.LabelTracking{LabelID: labelID, Events: []response.TrackingEvent{}}
+	if err = getTrackingQuery.QueryRow(labelID, tokenClaims.CompanyID).Scan(&carrierName, &result.TrackingNumber, &result.Status, &checkedAt); err != nil {
+		response.JSON(w, http.StatusNotFound, response.BasicMessage{Message: "Label Not Found"})
+		return
+	}
+	if result.TrackingNumber == "" {
+		response.Error(w, "Label Has No Tracking Number")
+		return
+	}
+
+	if r.URL.Query().Get("refresh") == "true" {
+		status, err := trackLabel(labelID, carrierName, result.TrackingNumber)
+		if err != nil {
+			response.Error(w, "Tracking Request Error")
+			return
+		}
+		result.Status = status
+		now := time.Now()
+		checkedAt = &now
+	}
+	if result.Status == "" {
+		result.Status = tracking.StatusUnknown
+	}
+	if checkedAt != nil {
+		result.CheckedAt = checkedAt.Format(time.RFC3339)
+	}
+
+	rows, err := database.DB.Query(getTrackingEventsSql, labelID)
+	if err != nil {
+		response.Error(w, "Get Tracking Error")
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e response.TrackingEvent
+		var occurredAt time.Time
+		if err = rows.Scan(&e.Status, &e.Code, &e.Description, &e.Location, &occurredAt); err != nil {
+			response.Error(w, "Get Tracking Error")
+			return
+		}
+		e.OccurredAt = occurredAt.Format(time.RFC3339)
+		result.Events = append(result.Events, e)
+	}
+
+	response.JSON(w, http.StatusOK, result)
+}
+
+// StartTrackingPoller checks the carrier for new tracking events of undelivered labels every interval
+func StartTrackingPoller (interval time.Duration) {
+	go func() {
+		for {
+			pollTracking()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// pollTracking util function that updates the labels that were checked the longest time ago
+func pollTracking () {
+	rows, err := database.DB.Query(getLabelsToTrackSql, tracking.StatusDelivered)
+	if err != nil {
+		log.Printf("Tracking Poll Error: %s", err.Error())
+		return
+	}
+	type pending struct {
+		id, carrier, pin string
+	}
+	var labels []pending
+	for rows.Next() {
+		var l pending
+		if err = rows.Scan(&l.id, &l.carrier, &l.pin); err == nil {
+			labels = append(labels, l)
+		}
+	}
+	rows.Close()
+
+	for _, l := range labels {
+		if _, err = trackLabel(l.id, l.carrier, l.pin); err != nil {
+			log.Printf("Tracking Poll Error For Label %s: %s", l.id, err.Error())
+		}
+	}
+}
+
+// trackLabel util function that fetches the events for a tracking pin from the carrier, stores the new ones and
+// returns the status of the most recent event
+func trackLabel (labelID, carrierName, pin string) (string, error) {
+	events, err := carrierEvents(carrierName, pin)
+	if err != nil {
+		return "", err
+	}
+
+	status := tracking.StatusUnknown
+	var latest time.Time
+	for _, event := range events {
+		eventStatus := tracking.NormalizeDescription(event.Description)
+		_, err = database.DB.Exec(addTrackingEventSql, labelID, eventStatus, event.Code, event.Description, event.Location, event.OccurredAt)
+		if err != nil {
+			return "", err
+		}
+		if event.OccurredAt.After(latest) {
+			latest = event.OccurredAt
+			status = eventStatus
+		}
+	}
+
+	if _, err = database.DB.Exec(updateLabelTrackingSql, status, labelID); err != nil {
+		return "", err
+	}
+	return status, nil
+}
+
+// carrierEvents util function that returns the tracking events of a pin from the carrier the label was bought from
+func carrierEvents (carrierName, pin string) ([]carriers.Event, error) {
+	if carrierName != carriers.CanadaPost {
+		carrier, err := getCarrier(carrierName)
+		if err != nil {
+			return nil, err
+		}
+		return carrier.Track(pin)
+	}
+
+	var detail response.CanadaPostTrackingDetail
+	err := canadaPostRequest("GET", "https://ct.soa-gw.canadapost.ca/vis/track/pin/"+pin+"/detail", "application/vnd.cpc.track-v2+xml",
+		"application/vnd.cpc.track-v2+xml", "", &detail)
+	if err != nil {
+		return nil, err
+	}
+	var events []carriers.Event
+	for _, event := range detail.SignificantEvents {
+		occurredAt, err := canadaPostEventTime(event.Date, event.Time, event.TimeZone)
+		if err != nil {
+			continue
+		}
+		events = append(events, carriers.Event{
+			Code: event.Identifier,
+			Description: event.Description,
+			Location: strings.TrimSpace(strings.Trim(event.Site+", "+event.Province, ", ")),
+			OccurredAt: occurredAt,
+		})
+	}
+	return events, nil
+}
+
+// canadaPostEventTime util function that parses the date, time and zone abbreviation of a tracking event
+func canadaPostEventTime (date, clock, zone string) (time.Time, error) {
+	offset, ok := canadaPostTimeZones[strings.ToUpper(zone)]
+	if !ok {
+		offset = canadaPostTimeZones["EST"]
+	}
+	return time.ParseInLocation("2006-01-02 15:04:05", date+" "+clock, time.FixedZone(zone, offset))
+}
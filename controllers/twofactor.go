@@ -0,0 +1,476 @@
+package controllers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"go.fromyama/utils"
+	"go.fromyama/utils/database"
+	"go.fromyama/utils/jwtUtil"
+	"go.fromyama/utils/response"
+	"go.fromyama/utils/roles"
+	"go.fromyama/utils/totp"
+)
+
+// requireTwoFactorSql is whether the company of a user requires two factor authentication of owners and admins
+const requireTwoFactorSql = "COALESCE((SELECT require_two_factor FROM companies WHERE companies.id = users.company_id), false)"
+
+const getTwoFactorSql = "SELECT email, COALESCE(totp_secret, ''), totp_enabled_at IS NOT NULL, COALESCE(totp_last_counter, 0), " + userRoleSql + ", " + requireTwoFactorSql + " FROM users WHERE id = $1 AND removed_at IS NULL"
+const setTotpSecretSql = "UPDATE users SET totp_secret = $1, totp_last_counter = NULL WHERE id = $2 AND totp_enabled_at IS NULL"
+const enableTotpSql = "UPDATE users SET totp_enabled_at = now() WHERE id = $1 AND totp_enabled_at IS NULL"
+const disableTotpSql = "UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_counter = NULL, totp_failures = 0 WHERE id = $1"
+const useTotpCounterSql = "UPDATE users SET totp_last_counter = $1 WHERE id = $2 AND COALESCE(totp_last_counter, 0) < $1"
+const addTotpAttemptSql = "UPDATE users SET totp_failures = COALESCE(totp_failures, 0) + 1 WHERE id = $1 AND removed_at IS NULL AND (totp_locked_until IS NULL OR totp_locked_until <= now()) RETURNING totp_failures"
+const lockTotpSql = "UPDATE users SET totp_failures = 0, totp_locked_until = $2 WHERE id = $1"
+const resetTotpFailuresSql = "UPDATE users SET totp_failures = 0 WHERE id = $1"
+const deleteRecoveryCodesSql = "DELETE FROM recovery_codes WHERE user_id = $1"
+const addRecoveryCodeSql = "INSERT INTO recovery_codes(user_id, code_hash) VALUES ($1, $2)"
+const useRecoveryCodeSql = "UPDATE recovery_codes SET used_at = now() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL"
+const getCompanyTwoFactorSql = "SELECT COALESCE(require_two_factor, false) FROM companies WHERE id = $1"
+const setCompanyTwoFactorSql = "UPDATE companies SET require_two_factor = $1 WHERE id = $2"
+
+// twoFactorChallengeLifetime is how long the second login step can take
+const twoFactorChallengeLifetime = time.Minute*5
+
+// maxTwoFactorFailures is how many codes can be tried without one being accepted before checking codes is locked
+// for twoFactorLockout
+const maxTwoFactorFailures = 5
+const twoFactorLockout = time.Minute*15
+
+const recoveryCodeCount = 10
+
+const totpIssuer = "FromYama"
+
+// twoFactorUser is the two factor state of a user
+type twoFactorUser struct {
+	Email string
+	Secret string
+	Enabled bool
+	LastCounter int64
+	Role string
+	Required bool
+}
+
+// twoFactorStore keeps the attempts of users at a second factor, the codes they used and their login challenges
+type twoFactorStore interface {
+	// addAttempt counts an attempt and returns the attempts since the count last started over, false while the
+	// user is locked out
+	addAttempt(userID string) (int, bool, error)
+	lock(userID string, until time.Time) error
+	resetAttempts(userID string) error
+	// useTotpCounter, useRecoveryCode and useChallenge are false when it was already used
+	useTotpCounter(userID string, counter int64) (bool, error)
+	useRecoveryCode(userID, hash string) (bool, error)
+	addChallenge(userID, nonce string, expiresAt time.Time) error
+	challengeLive(userID, nonce string) (bool, error)
+	useChallenge(userID, nonce string) (bool, error)
+}
+
+// dbTwoFactorStore keeps two factor state in the users, recovery_codes and user_tokens tables
+type dbTwoFactorStore struct {}
+
+// LoginTwoFactor /login/2fa is the second login step of users with two factor authentication, it checks a code
+// from their authenticator app or one of their recovery codes and returns jwt token and a refresh token, each
+// two_factor_token logs in once
+// request body has two_factor_token from the first step, code
+func LoginTwoFactor(w http.ResponseWriter, r *http.Request){
+	var body map[string]string
+	err := utils.ParseRequestBody(r, &body, []string{"two_factor_token", "code"})
+	if err != nil{
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+	store := dbTwoFactorStore{}
+	userID, nonce, err := openTwoFactorChallenge(store, body["two_factor_token"])
+	if err != nil {
+		response.Forbidden(w)
+		return
+	}
+	if !checkSecondFactor(w, userID, body["code"]) {
+		return
+	}
+	if used, err := store.useChallenge(userID, nonce); err != nil || !used {
+		response.Forbidden(w)
+		return
+	}
+	tokenClaims, err := userTokenClaims(userID)
+	if err != nil {
+		response.Forbidden(w)
+		return
+	}
+	token, err := startSession(r, tokenClaims)
+	if err != nil {
+		response.Error(w, "Token Generation Error")
+		return
+	}
+	response.JSON(w, http.StatusAccepted, *token)
+}
+
+// EnrollTwoFactor /2fa/enroll starts two factor setup, it returns a new secret and the otpauth uri to show as a QR
+// code, two factor authentication is only on once a code of the secret is confirmed
+func EnrollTwoFactor(w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	user, err := getTwoFactorUser(tokenClaims.UserID)
+	if err != nil {
+		response.Error(w, "Get User Error")
+		return
+	}
+	if user.Enabled {
+		response.JSON(w, http.StatusConflict, response.BasicMessage{Message: "Two Factor Already Enabled"})
+		return
+	}
+	secret, err := totp.NewSecret()
+	if err != nil {
+		response.Error(w, "Two Factor Secret Error")
+		return
+	}
+	encrypted, err := utils.AESEncrypt(secret)
+	if err != nil {
+		response.Error(w, "Two Factor Secret Error")
+		return
+	}
+	if _, err = database.DB.Exec(setTotpSecretSql, encrypted, tokenClaims.UserID); err != nil {
+		response.Error(w, "Enroll Two Factor Error")
+		return
+	}
+	response.JSON(w, http.StatusCreated, response.TwoFactorEnrollment{
+		Secret: secret,
+		ProvisioningURI: totp.ProvisioningURI(secret, totpIssuer, user.Email),
+	})
+}
+
+// ConfirmTwoFactor /2fa/confirm turns two factor authentication on with a code of the enrolled secret and returns
+// the recovery codes, they are only shown this once, a token that required two factor setup has to be refreshed
+// request body has code
+func ConfirmTwoFactor(w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	var body map[string]string
+	err := utils.ParseRequestBody(r, &body, []string{"code"})
+	if err != nil{
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+	user, err := getTwoFactorUser(tokenClaims.UserID)
+	if err != nil {
+		response.Error(w, "Get User Error")
+		return
+	}
+	if user.Enabled {
+		response.JSON(w, http.StatusConflict, response.BasicMessage{Message: "Two Factor Already Enabled"})
+		return
+	}
+	if user.Secret == "" {
+		response.Error(w, "Enroll Two Factor First")
+		return
+	}
+	if !checkSecondFactor(w, tokenClaims.UserID, body["code"]) {
+		return
+	}
+	if _, err = database.DB.Exec(enableTotpSql, tokenClaims.UserID); err != nil {
+		response.Error(w, "Confirm Two Factor Error")
+		return
+	}
+	codes, err := replaceRecoveryCodes(tokenClaims.UserID)
+	if err != nil {
+		response.Error(w, "Recovery Codes Error")
+		return
+	}
+	response.JSON(w, http.StatusAccepted, response.RecoveryCodes{RecoveryCodes: codes})
+}
+
+// DisableTwoFactor /2fa/disable turns two factor authentication off, owners and admins can not while their company
+// requires it
+// request body has code, from the authenticator app or a recovery code
+func DisableTwoFactor(w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	var body map[string]string
+	err := utils.ParseRequestBody(r, &body, []string{"code"})
+	if err != nil{
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+	user, err := getTwoFactorUser(tokenClaims.UserID)
+	if err != nil {
+		response.Error(w, "Get User Error")
+		return
+	}
+	if !user.Enabled {
+		response.Error(w, "Two Factor Not Enabled")
+		return
+	}
+	if user.Required && roles.RequiresTwoFactor(user.Role) {
+		response.JSON(w, http.StatusForbidden, response.BasicMessage{Message: "Company Requires Two Factor"})
+		return
+	}
+	if !checkSecondFactor(w, tokenClaims.UserID, body["code"]) {
+		return
+	}
+	if _, err = database.DB.Exec(disableTotpSql, tokenClaims.UserID); err != nil {
+		response.Error(w, "Disable Two Factor Error")
+		return
+	}
+	if _, err = database.DB.Exec(deleteRecoveryCodesSql, tokenClaims.UserID); err != nil {
+		response.Error(w, "Disable Two Factor Error")
+		return
+	}
+	response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Two Factor Disabled"})
+}
+
+// RegenerateRecoveryCodes /2fa/recovery-codes replaces the recovery codes of the user, the old ones stop working
+// request body has code, from the authenticator app or a recovery code
+func RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	var body map[string]string
+	err := utils.ParseRequestBody(r, &body, []string{"code"})
+	if err != nil{
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+	user, err := getTwoFactorUser(tokenClaims.UserID)
+	if err != nil {
+		response.Error(w, "Get User Error")
+		return
+	}
+	if !user.Enabled {
+		response.Error(w, "Two Factor Not Enabled")
+		return
+	}
+	if !checkSecondFactor(w, tokenClaims.UserID, body["code"]) {
+		return
+	}
+	codes, err := replaceRecoveryCodes(tokenClaims.UserID)
+	if err != nil {
+		response.Error(w, "Recovery Codes Error")
+		return
+	}
+	response.JSON(w, http.StatusAccepted, response.RecoveryCodes{RecoveryCodes: codes})
+}
+
+// SetTwoFactorPolicy /security/two-factor sets whether owners and admins of the company need two factor
+// authentication, those without it can only set it up after they next log in or refresh their token
+// request body has required, true or false
+func SetTwoFactorPolicy (w http.ResponseWriter, r *http.Request){
+	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
+	var body map[string]string
+	err := utils.ParseRequestBody(r, &body, []string{"required"})
+	if err != nil{
+		response.Error(w, "Body Parse Error, " + err.Error())
+		return
+	}
+	if body["required"] != "true" && body["required"] != "false" {
+		response.Error(w, "Required Must Be true Or false")
+		return
+	}
+	if _, err = database.DB.Exec(setCompanyTwoFactorSql, body["required"] == "true", tokenClaims.CompanyID); err != nil {
+		response.Error(w, "Set Two Factor Policy Error")
+		return
+	}
+	response.JSON(w, http.StatusAccepted, response.BasicMessage{Message: "Two Factor Policy Set"})
+}
+
+// startTwoFactorChallenge util function that answers the first login step of a user with two factor authentication
+// with a short lived token for the second step, its nonce is stored so the token is used up once it logs in
+func startTwoFactorChallenge (w http.ResponseWriter, userID string) {
+	token, err := newTwoFactorChallenge(dbTwoFactorStore{}, userID, time.Now())
+	if err != nil {
+		response.Error(w, "Token Generation Error")
+		return
+	}
+	response.JSON(w, http.StatusOK, response.TwoFactorChallenge{
+		TwoFactorRequired: true,
+		TwoFactorToken: token,
+		ExpiresIn: int(twoFactorChallengeLifetime.Seconds()),
+	})
+}
+
+// checkSecondFactor util function that checks a code of the authenticator app or a recovery code of a user, it
+// answers the request itself and returns false when the code is not accepted
+func checkSecondFactor (w http.ResponseWriter, userID, code string) bool {
+	user, err := getTwoFactorUser(userID)
+	if err == sql.ErrNoRows {
+		response.Forbidden(w)
+		return false
+	} else if err != nil {
+		response.Error(w, "Two Factor Check Error")
+		return false
+	}
+	store := dbTwoFactorStore{}
+	allowed, err := allowTwoFactorAttempt(store, userID, time.Now())
+	if err != nil {
+		response.Error(w, "Two Factor Check Error")
+		return false
+	}
+	if !allowed {
+		response.JSON(w, http.StatusTooManyRequests, response.BasicMessage{Message: "Too Many Attempts, Try Again Later"})
+		return false
+	}
+	accepted, err := acceptSecondFactor(store, userID, user, code, time.Now())
+	if err != nil {
+		response.Error(w, "Two Factor Check Error")
+		return false
+	}
+	if !accepted {
+		response.JSON(w, http.StatusForbidden, response.BasicMessage{Message: "Invalid Code"})
+		return false
+	}
+	if err = store.resetAttempts(userID); err != nil {
+		log.Printf("Reset Two Factor Attempts Error: %s", err.Error())
+	}
+	return true
+}
+
+// allowTwoFactorAttempt util function that counts an attempt at a second factor before its code is checked, so
+// parallel guesses can not get past the limit, and locks the user out for twoFactorLockout once there is one more
+// than allowed, false when the code must not be checked
+func allowTwoFactorAttempt (store twoFactorStore, userID string, now time.Time) (bool, error) {
+	attempts, open, err := store.addAttempt(userID)
+	if err != nil || !open {
+		return false, err
+	}
+	if attempts > maxTwoFactorFailures {
+		return false, store.lock(userID, now.Add(twoFactorLockout))
+	}
+	return true, nil
+}
+
+// acceptSecondFactor util function that is true for a code of the authenticator app of user that was not used yet
+// or, once two factor is on, an unused recovery code, either is used up
+func acceptSecondFactor (store twoFactorStore, userID string, user twoFactorUser, code string, now time.Time) (bool, error) {
+	if secret, err := utils.AESDecrypt(user.Secret); err == nil && user.Secret != "" {
+		if counter, ok := totp.Validate(secret, code, now); ok {
+			return store.useTotpCounter(userID, counter)
+		}
+	}
+	if !user.Enabled {
+		return false, nil
+	}
+	return store.useRecoveryCode(userID, totp.HashRecoveryCode(code))
+}
+
+// newTwoFactorChallenge util function that returns a token for the second login step of a user, its nonce is kept
+// so the token logs in once
+func newTwoFactorChallenge (store twoFactorStore, userID string, now time.Time) (string, error) {
+	nonce := uuid.New().String()
+	token, err := jwtUtil.GeneratePurposeToken(jwtUtil.PurposeTwoFactor, userID, nonce, twoFactorChallengeLifetime)
+	if err != nil {
+		return "", err
+	}
+	return token, store.addChallenge(userID, nonce, now.Add(twoFactorChallengeLifetime))
+}
+
+// openTwoFactorChallenge util function that returns the user and nonce of a second login step token that has not
+// logged in yet
+func openTwoFactorChallenge (store twoFactorStore, token string) (string, string, error) {
+	userID, nonce, err := jwtUtil.CheckPurposeToken(token, jwtUtil.PurposeTwoFactor)
+	if err != nil {
+		return "", "", err
+	}
+	live, err := store.challengeLive(userID, nonce)
+	if err != nil {
+		return "", "", err
+	}
+	if !live {
+		return "", "", &userTokenError{}
+	}
+	return userID, nonce, nil
+}
+
+func (dbTwoFactorStore) addAttempt(userID string) (int, bool, error) {
+	var attempts int
+	err := database.DB.QueryRow(addTotpAttemptSql, userID).Scan(&attempts)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	return attempts, err == nil, err
+}
+
+func (dbTwoFactorStore) lock(userID string, until time.Time) error {
+	_, err := database.DB.Exec(lockTotpSql, userID, until)
+	return err
+}
+
+func (dbTwoFactorStore) resetAttempts(userID string) error {
+	_, err := database.DB.Exec(resetTotpFailuresSql, userID)
+	return err
+}
+
+func (dbTwoFactorStore) useTotpCounter(userID string, counter int64) (bool, error) {
+	return execChangedRow(useTotpCounterSql, counter, userID)
+}
+
+func (dbTwoFactorStore) useRecoveryCode(userID, hash string) (bool, error) {
+	return execChangedRow(useRecoveryCodeSql, userID, hash)
+}
+
+func (dbTwoFactorStore) addChallenge(userID, nonce string, expiresAt time.Time) error {
+	_, err := database.DB.Exec(addUserTokenSql, userID, jwtUtil.PurposeTwoFactor, nonce, expiresAt)
+	return err
+}
+
+func (dbTwoFactorStore) challengeLive(userID, nonce string) (bool, error) {
+	var live bool
+	err := database.DB.QueryRow(isUserTokenLiveSql, userID, jwtUtil.PurposeTwoFactor, nonce).Scan(&live)
+	return live, err
+}
+
+func (dbTwoFactorStore) useChallenge(userID, nonce string) (bool, error) {
+	return execChangedRow(useUserTokenSql, userID, jwtUtil.PurposeTwoFactor, nonce)
+}
+
+// execChangedRow util function that runs a statement and is true when it changed a row
+func execChangedRow (query string, args ...interface{}) (bool, error) {
+	res, err := database.DB.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// getTwoFactorUser util function that loads the two factor state of a user, Secret is still encrypted
+func getTwoFactorUser (userID string) (twoFactorUser, error) {
+	var u twoFactorUser
+	err := database.DB.QueryRow(getTwoFactorSql, userID).Scan(&u.Email, &u.Secret, &u.Enabled, &u.LastCounter, &u.Role, &u.Required)
+	return u, err
+}
+
+// replaceRecoveryCodes util function that stores new recovery codes for a user in place of the old ones, only their
+// hashes are stored
+func replaceRecoveryCodes (userID string) ([]string, error) {
+	codes, err := totp.NewRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err = tx.Exec(deleteRecoveryCodesSql, userID); err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		if _, err = tx.Exec(addRecoveryCodeSql, userID, totp.HashRecoveryCode(code)); err != nil {
+			return nil, err
+		}
+	}
+	return codes, tx.Commit()
+}
+
+// companyRequiresTwoFactor util function that is true when the company requires two factor authentication of its
+// owners and admins
+func companyRequiresTwoFactor (companyID string) (bool, error) {
+	var required bool
+	err := database.DB.QueryRow(getCompanyTwoFactorSql, companyID).Scan(&required)
+	return required, err
+}
+
+// twoFactorSetupRequired util function that is true when a user has to set up two factor authentication before
+// using the api
+func twoFactorSetupRequired (role string, enabled, required bool) bool {
+	return required && !enabled && roles.RequiresTwoFactor(role)
+}
@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"go.fromyama/utils"
+	"go.fromyama/utils/jwtUtil"
+	"go.fromyama/utils/totp"
+)
+
+// memoryTwoFactorStore keeps the two factor state of the tests the way the database does
+type memoryTwoFactorStore struct {
+	mu            sync.Mutex
+	attempts      int
+	lockedUntil   time.Time
+	lastCounter   int64
+	recoveryCodes map[string]bool
+	challenges    map[string]bool
+}
+
+func newMemoryTwoFactorStore(recoveryCodes ...string) *memoryTwoFactorStore {
+	store := &memoryTwoFactorStore{recoveryCodes: map[string]bool{}, challenges: map[string]bool{}}
+	for _, code := range recoveryCodes {
+		store.recoveryCodes[totp.HashRecoveryCode(code)] = false
+	}
+	return store
+}
+
+func (s *memoryTwoFactorStore) addAttempt(string) (int, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lockedUntil.After(time.Now()) {
+		return 0, false, nil
+	}
+	s.attempts++
+	return s.attempts, true, nil
+}
+
+func (s *memoryTwoFactorStore) lock(_ string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts, s.lockedUntil = 0, until
+	return nil
+}
+
+func (s *memoryTwoFactorStore) resetAttempts(string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts = 0
+	return nil
+}
+
+func (s *memoryTwoFactorStore) useTotpCounter(_ string, counter int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if counter <= s.lastCounter {
+		return false, nil
+	}
+	s.lastCounter = counter
+	return true, nil
+}
+
+func (s *memoryTwoFactorStore) useRecoveryCode(_, hash string) (bool, error) {
+	return s.use(s.recoveryCodes, hash), nil
+}
+
+func (s *memoryTwoFactorStore) addChallenge(_, nonce string, _ time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.challenges[nonce] = false
+	return nil
+}
+
+func (s *memoryTwoFactorStore) challengeLive(_, nonce string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	used, ok := s.challenges[nonce]
+	return ok && !used, nil
+}
+
+func (s *memoryTwoFactorStore) useChallenge(_, nonce string) (bool, error) {
+	return s.use(s.challenges, nonce), nil
+}
+
+func (s *memoryTwoFactorStore) use(m map[string]bool, key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	used, ok := m[key]
+	if !ok || used {
+		return false
+	}
+	m[key] = true
+	return true
+}
+
+// newTwoFactorUser returns a user with two factor on and the secret of their authenticator app
+func newTwoFactorUser(t *testing.T) (twoFactorUser, string) {
+	os.Setenv("AES_KEY", "0123456789abcdef0123456789abcdef")
+	secret, err := totp.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := utils.AESEncrypt(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return twoFactorUser{Email: "owner@fromyama.com", Secret: encrypted, Enabled: true, Role: "owner"}, secret
+}
+
+func TestAllowTwoFactorAttempt(t *testing.T) {
+	store := newMemoryTwoFactorStore()
+	now := time.Now()
+	for i := 0; i < maxTwoFactorFailures; i++ {
+		if allowed, err := allowTwoFactorAttempt(store, "user-1", now); err != nil || !allowed {
+			t.Fatalf("attempt %d got %v %v, want allowed", i+1, allowed, err)
+		}
+	}
+	if allowed, _ := allowTwoFactorAttempt(store, "user-1", now); allowed {
+		t.Fatal("attempt past the limit allowed")
+	}
+	if want := now.Add(twoFactorLockout); !store.lockedUntil.Equal(want) {
+		t.Errorf("got locked until %s, want %s", store.lockedUntil, want)
+	}
+	if allowed, _ := allowTwoFactorAttempt(store, "user-1", now); allowed {
+		t.Error("attempt while locked out allowed")
+	}
+
+	store.lockedUntil = now.Add(-time.Second)
+	if allowed, err := allowTwoFactorAttempt(store, "user-1", now); err != nil || !allowed {
+		t.Errorf("attempt after the lockout got %v %v, want allowed", allowed, err)
+	}
+}
+
+func TestAllowTwoFactorAttemptInParallel(t *testing.T) {
+	store := newMemoryTwoFactorStore()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowedCount := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if allowed, _ := allowTwoFactorAttempt(store, "user-1", time.Now()); allowed {
+				mu.Lock()
+				allowedCount++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowedCount != maxTwoFactorFailures {
+		t.Errorf("got %d attempts allowed, want %d", allowedCount, maxTwoFactorFailures)
+	}
+}
+
+func TestAcceptSecondFactor(t *testing.T) {
+	user, secret := newTwoFactorUser(t)
+	store := newMemoryTwoFactorStore("abcde-12345")
+	now := time.Now()
+	code, err := totp.Code(secret, totp.Counter(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		code string
+		want bool
+	}{
+		{"authenticator code", code, true},
+		{"authenticator code used again", code, false},
+		{"recovery code", "abcde-12345", true},
+		{"recovery code used again", "abcde-12345", false},
+		{"unknown recovery code", "zzzzz-99999", false},
+	}
+	for _, tt := range tests {
+		if got, err := acceptSecondFactor(store, "user-1", user, tt.code, now); err != nil || got != tt.want {
+			t.Errorf("%s: got %v %v, want %v", tt.name, got, err, tt.want)
+		}
+	}
+
+	// recovery codes only work once two factor is on
+	store = newMemoryTwoFactorStore("abcde-12345")
+	user.Enabled = false
+	if got, _ := acceptSecondFactor(store, "user-1", user, "abcde-12345", now); got {
+		t.Error("recovery code accepted before two factor is on")
+	}
+}
+
+func TestTwoFactorChallenge(t *testing.T) {
+	os.Setenv("JWT_KEYS", "")
+	os.Setenv("JWT_SECRET", "test-secret")
+	if err := jwtUtil.LoadKeys(); err != nil {
+		t.Fatal(err)
+	}
+	store := newMemoryTwoFactorStore()
+	token, err := newTwoFactorChallenge(store, "user-1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userID, nonce, err := openTwoFactorChallenge(store, token)
+	if err != nil || userID != "user-1" {
+		t.Fatalf("got %s %v, want user-1", userID, err)
+	}
+	// opening does not use the challenge up so a mistyped code can be tried again
+	if _, _, err = openTwoFactorChallenge(store, token); err != nil {
+		t.Fatalf("challenge closed before logging in: %v", err)
+	}
+	if used, _ := store.useChallenge(userID, nonce); !used {
+		t.Fatal("challenge not used up")
+	}
+	if _, _, err = openTwoFactorChallenge(store, token); err == nil {
+		t.Error("used challenge opened again")
+	}
+
+	invitation, _ := jwtUtil.GeneratePurposeToken(jwtUtil.PurposeInvitation, "user-1", nonce, time.Minute)
+	if _, _, err = openTwoFactorChallenge(store, invitation); err == nil {
+		t.Error("token for another purpose opened a challenge")
+	}
+}
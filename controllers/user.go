@@ -1,10 +1,11 @@
 package controllers
 
 import (
+	"bytes"
 	"crypto/tls"
 	"encoding/base64"
 	"fmt"
-	"io/ioutil"
+	"html/template"
 	"net/http"
 	"net/mail"
 	"net/smtp"
@@ -14,14 +15,15 @@ import (
 	"go.fromyama/utils/database"
 	"go.fromyama/utils/jwtUtil"
 	"go.fromyama/utils/response"
+	"go.fromyama/utils/roles"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
-const createUserSql = "INSERT INTO users(name, email, password, company_id, is_approved, is_head) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id"
+const createUserSql = "INSERT INTO users(name, email, password, company_id, is_approved, is_head, role, email_verified_at) VALUES ($1, $2, $3, $4, $5, $6, $7, CASE WHEN $8 THEN now() END) RETURNING id"
 const addEmployeeSql = "INSERT INTO employees(company_id, user_id) VALUES ($1, $2)"
-const loginUserSql = "SELECT id, company_id, password, is_approved FROM users WHERE email = $1"
-const getUserDetailSql = "SELECT c.id, u.email, u.name as name, c.company_name, u.id, u.is_head, u.is_approved FROM (SELECT * FROM users WHERE email = $1) u INNER JOIN companies c on c.id = u.company_id"
+const loginUserSql = "SELECT id, company_id, password, is_approved, " + userRoleSql + ", totp_enabled_at IS NOT NULL, " + requireTwoFactorSql + " FROM users WHERE lower(email) = lower($1) AND removed_at IS NULL"
+const getUserDetailSql = "SELECT c.id, u.email, u.name as name, c.company_name, u.id, u.is_head, u.is_approved, u.role, u.email_verified_at IS NOT NULL FROM (SELECT id, company_id, email, name, is_head, is_approved, email_verified_at, " + userRoleSql + " AS role FROM users WHERE lower(email) = lower($1) AND removed_at IS NULL) u INNER JOIN companies c on c.id = u.company_id"
 
 type userError struct {
 	s string
@@ -40,7 +42,7 @@ func SignUpUser(w http.ResponseWriter, r *http.Request){
 		return
 	}
 
-	_, token, err := SignUpUserAndGenerateToken(w, false,false, body["name"], body["email"], body["password"], body["company_id"])
+	_, token, err := SignUpUserAndGenerateToken(w, r, false,false, false, roles.Shipper, body["name"], body["email"], body["password"], body["company_id"])
 	if err != nil {
 		return
 	}
@@ -48,7 +50,8 @@ func SignUpUser(w http.ResponseWriter, r *http.Request){
 	response.JSON(w, http.StatusCreated, *token)
 }
 
-// LoginUser /login checks user email and password and returns jwt token
+// LoginUser /login checks user email and password and returns jwt token and a refresh token for a new session, users
+// with two factor authentication get a two_factor_token for /login/2fa instead
 // request body has email, password
 func LoginUser(w http.ResponseWriter, r *http.Request){
 	var body map[string]string
@@ -66,9 +69,9 @@ func LoginUser(w http.ResponseWriter, r *http.Request){
 	}
 
 	row := query.QueryRow(body["email"])
-	var id, companyID, hash string
-	var approved bool
-	err = row.Scan(&id, &companyID, &hash, &approved)
+	var id, companyID, hash, role string
+	var approved, twoFactorEnabled, twoFactorRequired bool
+	err = row.Scan(&id, &companyID, &hash, &approved, &role, &twoFactorEnabled, &twoFactorRequired)
 	if err != nil {
 		response.Error(w, "User Credential Fetch Error")
 		return
@@ -85,18 +88,24 @@ func LoginUser(w http.ResponseWriter, r *http.Request){
 		UserID: id,
 		CompanyID: companyID,
 		Approved: approved,
+		Role: role,
+		TwoFactorSetupRequired: twoFactorSetupRequired(role, twoFactorEnabled, twoFactorRequired),
 	}
 
-	token, err := jwtUtil.GenerateToken(tokenClaims)
 	if !(<-authChannel) {
 		response.Forbidden(w)
-	} else if err != nil {
+		return
+	}
+	if twoFactorEnabled {
+		startTwoFactorChallenge(w, id)
+		return
+	}
+	token, err := startSession(r, tokenClaims)
+	if err != nil {
 		response.Error(w, "Token Generation Error")
-	} else {
-		response.JSON(w, http.StatusAccepted, response.Token{
-			Raw: token,
-		})
+		return
 	}
+	response.JSON(w, http.StatusAccepted, *token)
 }
 
 // GetUserDetails /details returns the users details
@@ -110,17 +119,18 @@ func GetUserDetails(w http.ResponseWriter, r *http.Request){
 	}
 
 	var q response.UserDetails
-	if err = query.QueryRow(claims.Email).Scan(&q.UserData.CompanyID, &q.UserData.Email,&q.UserData.Name,&q.CompanyName, &q.UserData.ID, &q.UserData.IsHead, &q.UserData.IsApproved); err != nil {
+	if err = query.QueryRow(claims.Email).Scan(&q.UserData.CompanyID, &q.UserData.Email,&q.UserData.Name,&q.CompanyName, &q.UserData.ID, &q.UserData.IsHead, &q.UserData.IsApproved, &q.UserData.Role, &q.UserData.EmailVerified); err != nil {
 		response.Error(w, "Company Details Fetch Error")
 		return
 	}
 	response.JSON(w, http.StatusAccepted, q)
 }
 
-// SignUpUserAndGenerateToken util function that signs up user and generates the jwt token
-func SignUpUserAndGenerateToken(w http.ResponseWriter, approved, isHead bool,name, email, password, companyID string) (string, *response.Token, error) {
+// SignUpUserAndGenerateToken util function that signs up user with role and starts a session for the device of the
+// request, users whose email is not verified yet get a link to verify it and the welcome email after they do
+func SignUpUserAndGenerateToken(w http.ResponseWriter, r *http.Request, approved, isHead, emailVerified bool, role, name, email, password, companyID string) (string, *response.Token, error) {
 
-	takenQuery, err := database.DB.Prepare("SELECT exists(SELECT 1 from users where email=$1)")
+	takenQuery, err := database.DB.Prepare("SELECT exists(SELECT 1 from users where lower(email) = lower($1) AND removed_at IS NULL)")
 	defer takenQuery.Close()
 	if err != nil {
 		response.Error(w, "Check Existing Email Error")
@@ -149,7 +159,7 @@ func SignUpUserAndGenerateToken(w http.ResponseWriter, approved, isHead bool,nam
 		return "", nil, err
 	}
 	var userIdString string
-	err = userCreateQuery.QueryRow(name, email, string(hashByte), companyID, approved, isHead).Scan(&userIdString)
+	err = userCreateQuery.QueryRow(name, email, string(hashByte), companyID, approved, isHead, role, emailVerified).Scan(&userIdString)
 	if err != nil {
 		response.Error(w, "Create User Error")
 		return "", nil, err
@@ -167,35 +177,47 @@ func SignUpUserAndGenerateToken(w http.ResponseWriter, approved, isHead bool,nam
 		UserID: userIdString,
 		CompanyID: companyID,
 		Approved: approved,
+		Role: role,
+	}
+	if roles.RequiresTwoFactor(role) {
+		required, err := companyRequiresTwoFactor(companyID)
+		if err != nil {
+			response.Error(w, "Two Factor Policy Error")
+			return "", nil, err
+		}
+		tokenClaims.TwoFactorSetupRequired = required
 	}
 
-	token, err := jwtUtil.GenerateToken(tokenClaims)
+	token, err := startSession(r, tokenClaims)
 	if err != nil {
 		response.Error(w, "Token Generation Error")
 		return "", nil, err
 	}
 
-	newUserHTML, err := ioutil.ReadFile("assets/templates/newUser.html")
-	err = SendEmail(email, "Welcome To FromYama", string(newUserHTML), nil)
+	if emailVerified {
+		err = sendWelcomeEmail(email)
+	} else {
+		err = sendUserTokenEmail(userIdString, email, jwtUtil.PurposeEmailVerification)
+	}
 	if err != nil {
 		response.Error(w, "Sending Email Error")
 		return "", nil, err
 	}
 
-	return userIdString, &response.Token{
-		Raw: token,
-	}, nil
+	return userIdString, token, nil
 }
 
-// RefreshToken /user/refresh refreshes the token without needing to check password
-func RefreshToken(w http.ResponseWriter, r *http.Request){
-	tokenClaims := r.Context().Value("claims").(jwtUtil.TokenClaims)
-	token, err := jwtUtil.GenerateToken(tokenClaims)
+// renderEmail util function that fills an email template from assets/templates with data
+func renderEmail(templateFile string, data interface{}) (string, error) {
+	var tmplBuffer bytes.Buffer
+	tmpl, err := template.ParseFiles("assets/templates/" + templateFile)
 	if err != nil {
-		response.Error(w, "Token Generation Error")
-		return
+		return "", err
+	}
+	if err = tmpl.Execute(&tmplBuffer, data); err != nil {
+		return "", err
 	}
-	response.JSON(w, http.StatusAccepted, response.Token{Raw: token})
+	return tmplBuffer.String(), nil
 }
 
 // SendEmail util function that sends email to user
@@ -15,7 +15,7 @@ require (
 	github.com/jackc/pgx v3.6.2+incompatible
 	github.com/joho/godotenv v1.3.0
 	github.com/lib/pq v1.10.1 // indirect
-	github.com/pkg/errors v0.9.1 // indirect
+	github.com/pdfcpu/pdfcpu v0.3.12
 	github.com/shopspring/decimal v1.2.0 // indirect
 	github.com/stretchr/testify v1.7.0 // indirect
 	github.com/stripe/stripe-go v70.15.0+incompatible
@@ -46,6 +46,10 @@ func ProtectedApprovedUserRoute(next http.Handler) http.Handler {
 			response.JSON(w, http.StatusUnauthorized, response.BasicMessage{
 				Message: "Not Approved",
 			})
+		} else if claims.TwoFactorSetupRequired {
+			response.JSON(w, http.StatusForbidden, response.BasicMessage{
+				Message: "Two Factor Setup Required",
+			})
 		} else {
 			ctx := context.WithValue(r.Context(), "claims", *claims)
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go.fromyama/utils/jwtUtil"
+	"go.fromyama/utils/response"
+	"go.fromyama/utils/roles"
+)
+
+// Permission only lets members whose role has the permission through, it goes after ProtectedApprovedUserRoute
+// which puts the claims in the context
+func Permission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value("claims").(jwtUtil.TokenClaims)
+			if !ok {
+				response.Forbidden(w)
+			} else if !roles.Can(claims.Role, permission) {
+				response.JSON(w, http.StatusForbidden, response.BasicMessage{
+					Message: "Role Not Permitted",
+				})
+			} else {
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
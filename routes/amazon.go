@@ -5,14 +5,15 @@ import (
 
 	"go.fromyama/controllers/amazon"
 	"go.fromyama/middleware"
+	"go.fromyama/utils/roles"
 )
 
 
 func AmazonRoutes() *chi.Mux{
 	router:= chi.NewRouter()
 
-	router.With(middleware.ProtectedApprovedUserRoute).Post("/authorize", amazon.Authorize)
-	router.With(middleware.ProtectedApprovedUserRoute).Get("/orders/all", amazon.GetUnfulfilledOrders)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageSettings)).Post("/authorize", amazon.Authorize)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Get("/orders/all", amazon.GetUnfulfilledOrders)
 
 	return router
 }
@@ -5,25 +5,59 @@ import (
 
 	"go.fromyama/controllers"
 	"go.fromyama/middleware"
+	"go.fromyama/utils/roles"
 )
 
 func CompanyRoutes() *chi.Mux{
 	router:= chi.NewRouter()
 	router.Post("/register", controllers.RegisterCompany)
 
-	router.With(middleware.ProtectedApprovedUserRoute).Get("/platforms", controllers.GetConnectedPlatforms)
-	router.With(middleware.ProtectedApprovedUserRoute).Get("/employee/all", controllers.GetAllEmployeeDetails)
-
-	router.With(middleware.ProtectedApprovedUserRoute).Put("/employee/approve/{employeeID}", controllers.ApproveEmployee)
-	router.With(middleware.ProtectedApprovedUserRoute).Get("/employee/approved/{employeeID}",controllers.IsEmployeeApproved)
-	router.With(middleware.ProtectedApprovedUserRoute).Get("/details", controllers.GetCompanyDetails)
-
-	router.With(middleware.ProtectedApprovedUserRoute).Post("/add/payment/method", controllers.AddPaymentMethod)
-	router.With(middleware.ProtectedApprovedUserRoute).Post("/add/payment/charge", controllers.ChargePaymentAccount)
-
-	router.With(middleware.ProtectedApprovedUserRoute).Post("/add/parcel", controllers.AddParcel)
-	router.With(middleware.ProtectedApprovedUserRoute).Get("/shipper", controllers.GetShipper)
-
-	router.With(middleware.ProtectedApprovedUserRoute).Delete("/unregister",controllers.UnregisterCompany)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Get("/platforms", controllers.GetConnectedPlatforms)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Get("/employee/all", controllers.GetAllEmployeeDetails)
+
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageMembers)).Put("/employee/approve/{employeeID}", controllers.ApproveEmployee)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageMembers)).Put("/employee/{employeeID}/role", controllers.SetMemberRole)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageMembers)).Post("/employee/{employeeID}/reject", controllers.RejectEmployee)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageMembers)).Delete("/employee/{employeeID}", controllers.RemoveEmployee)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageMembers)).Get("/employee/audit", controllers.GetMemberAudit)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.TransferOwnership)).Post("/transfer-head", controllers.TransferHead)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageMembers)).Post("/invitations", controllers.InviteEmployee)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageMembers)).Get("/invitations", controllers.GetInvitations)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageMembers)).Post("/invitations/{invitationID}/resend", controllers.ResendInvitation)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageMembers)).Delete("/invitations/{invitationID}", controllers.RevokeInvitation)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Get("/roles", controllers.GetRoles)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Get("/employee/approved/{employeeID}",controllers.IsEmployeeApproved)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Get("/details", controllers.GetCompanyDetails)
+
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageBilling)).Post("/add/payment/method", controllers.AddPaymentMethod)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageBilling)).Post("/add/payment/charge", controllers.ChargePaymentAccount)
+
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageSettings)).Post("/add/parcel", controllers.AddParcel)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageSettings)).Put("/parcels/{parcelID}", controllers.UpdateParcel)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageSettings)).Delete("/parcels/{parcelID}", controllers.DeleteParcel)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageSettings)).Put("/parcels/{parcelID}/default", controllers.SetDefaultParcel)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Get("/products", controllers.GetProducts)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageSettings)).Put("/products/{sku}", controllers.SetProduct)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageSettings)).Delete("/products/{sku}", controllers.DeleteProduct)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Get("/shipper", controllers.GetShipper)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Get("/locations", controllers.GetLocations)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageSettings)).Post("/locations", controllers.AddLocation)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageSettings)).Put("/locations/{locationID}", controllers.UpdateLocation)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageSettings)).Delete("/locations/{locationID}", controllers.DeleteLocation)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageSettings)).Put("/locations/{locationID}/default", controllers.SetDefaultLocation)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageSettings)).Put("/label/format", controllers.SetLabelFormat)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageSettings)).Put("/branding", controllers.SetBranding)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageSettings)).Put("/shipping/options", controllers.SetShippingOptions)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Get("/rules", controllers.GetShippingRules)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageSettings)).Post("/rules", controllers.AddShippingRule)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Post("/rules/dry-run", controllers.DryRunShippingRules)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageSettings)).Put("/rules/{ruleID}", controllers.UpdateShippingRule)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageSettings)).Delete("/rules/{ruleID}", controllers.DeleteShippingRule)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Get("/pricing", controllers.GetPricingPlan)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageBilling)).Put("/canadapost/contract", controllers.SetCanadaPostContract)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageBilling)).Delete("/canadapost/contract", controllers.RemoveCanadaPostContract)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageSecurity)).Put("/security/two-factor", controllers.SetTwoFactorPolicy)
+
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.DeleteCompany)).Delete("/unregister",controllers.UnregisterCompany)
 	return router
 }
\ No newline at end of file
@@ -5,16 +5,17 @@ import (
 
 	"go.fromyama/controllers/etsy"
 	"go.fromyama/middleware"
+	"go.fromyama/utils/roles"
 )
 
 func EtsyRoutes() *chi.Mux{
 	router:= chi.NewRouter()
 
 	router.Get("/callback", etsy.Callback)
-	router.With(middleware.ProtectedApprovedUserRoute).Post("/generate-link", etsy.GenerateAuthURL)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageSettings)).Post("/generate-link", etsy.GenerateAuthURL)
 
-	router.With(middleware.ProtectedApprovedUserRoute).Post("/fulfill/{orderID}",etsy.FulfillOrder)
-	router.With(middleware.ProtectedApprovedUserRoute).Get("/orders/all", etsy.GetUnfulfilledOrders)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.Ship)).Post("/fulfill/{orderID}",etsy.FulfillOrder)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Get("/orders/all", etsy.GetUnfulfilledOrders)
 
 	return router
 }
@@ -5,13 +5,37 @@ import (
 
 	"go.fromyama/controllers"
 	"go.fromyama/middleware"
+	"go.fromyama/utils/roles"
 )
 
 func PostageRoutes() *chi.Mux{
 	router:= chi.NewRouter()
 
-	router.With(middleware.ProtectedApprovedUserRoute).Post("/buy/canadapost", controllers.BuyCanadaPostPostageLabel)
-	router.With(middleware.ProtectedApprovedUserRoute).Post("/rates/canadapost", controllers.GetCanadaPostRate)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.Ship)).Post("/buy/canadapost", controllers.BuyCanadaPostPostageLabel)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Post("/rates/canadapost", controllers.GetCanadaPostRate)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.Ship)).Post("/buy/{carrier}", controllers.BuyCarrierLabel)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Post("/rates/{carrier}", controllers.GetCarrierRates)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Post("/address/validate", controllers.ValidateAddress)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.Ship)).Post("/returns", controllers.BuyReturnLabel)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.Ship)).Post("/batches", controllers.BuyLabelBatch)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Get("/batches/{batchID}/pdf", controllers.GetLabelBatchPDF)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.Ship)).Post("/pickups", controllers.SchedulePickup)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Get("/pickups", controllers.GetPickups)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.Ship)).Delete("/pickups/{pickupID}", controllers.CancelPickup)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.Ship)).Post("/manifests", controllers.TransmitShipments)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Get("/manifests", controllers.GetManifests)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Get("/manifests/{manifestID}/pdf", controllers.GetManifestPDF)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Post("/packing-slips", controllers.GetPackingSlips)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Post("/pick-lists", controllers.GetPickList)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Post("/pack", controllers.PackItems)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Post("/prepare", controllers.PrepareShipments)
+
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Get("/labels", controllers.GetLabels)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Get("/labels/{labelID}/pdf", controllers.GetLabelPDF)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Get("/labels/{labelID}/tracking", controllers.GetLabelTracking)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.Ship)).Post("/labels/{labelID}/void", controllers.VoidLabel)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Get("/labels/{labelID}/documents", controllers.GetLabelDocuments)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Get("/labels/{labelID}/documents/{kind}", controllers.GetLabelDocument)
 
 	return router
 }
\ No newline at end of file
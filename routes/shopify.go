@@ -5,17 +5,18 @@ import (
 
 	"go.fromyama/controllers/shopify"
 	"go.fromyama/middleware"
+	"go.fromyama/utils/roles"
 )
 
 func ShopifyRoutes() *chi.Mux{
 	router:= chi.NewRouter()
 
 	router.Get("/callback", shopify.Callback)
-	router.With(middleware.ProtectedApprovedUserRoute).Post("/generate-link",shopify.GenerateAuthURL)
-	router.With(middleware.ProtectedApprovedUserRoute).Get("/locations", shopify.GetLocations)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ManageSettings)).Post("/generate-link",shopify.GenerateAuthURL)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Get("/locations", shopify.GetLocations)
 
-	router.With(middleware.ProtectedApprovedUserRoute).Post("/fulfill/{orderID}", shopify.FulfillOrder)
-	router.With(middleware.ProtectedApprovedUserRoute).Get("/orders/all", shopify.GetUnfulfilledOrders)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.Ship)).Post("/fulfill/{orderID}", shopify.FulfillOrder)
+	router.With(middleware.ProtectedApprovedUserRoute, middleware.Permission(roles.ViewShipments)).Get("/orders/all", shopify.GetUnfulfilledOrders)
 
 	return router
 }
@@ -11,8 +11,22 @@ func UserRoutes() *chi.Mux{
 	router:= chi.NewRouter()
 	router.Post("/signup", controllers.SignUpUser)
 	router.Post("/login", controllers.LoginUser)
+	router.Post("/login/2fa", controllers.LoginTwoFactor)
+	router.Post("/invitations/accept", controllers.AcceptInvitation)
+	router.Post("/password/forgot", controllers.ForgotPassword)
+	router.Post("/password/reset", controllers.ResetPassword)
+	router.Post("/email/verify", controllers.VerifyEmail)
+	router.With(middleware.ProtectedRoute).Post("/email/verify/resend", controllers.ResendVerification)
 	router.With(middleware.ProtectedRoute).Get("/details",controllers.GetUserDetails)
-	router.With(middleware.ProtectedRoute).Get("/refresh", controllers.RefreshToken)
+	router.Post("/refresh", controllers.RefreshToken)
+	router.With(middleware.ProtectedRoute).Post("/logout", controllers.Logout)
+	router.With(middleware.ProtectedRoute).Post("/logout/all", controllers.LogoutEverywhere)
+	router.With(middleware.ProtectedRoute).Get("/sessions", controllers.GetSessions)
+	router.With(middleware.ProtectedRoute).Delete("/sessions/{sessionID}", controllers.RevokeSession)
+	router.With(middleware.ProtectedRoute).Post("/2fa/enroll", controllers.EnrollTwoFactor)
+	router.With(middleware.ProtectedRoute).Post("/2fa/confirm", controllers.ConfirmTwoFactor)
+	router.With(middleware.ProtectedRoute).Post("/2fa/disable", controllers.DisableTwoFactor)
+	router.With(middleware.ProtectedRoute).Post("/2fa/recovery-codes", controllers.RegenerateRecoveryCodes)
 	return router
 }
 
@@ -4,11 +4,17 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 
+	"go.fromyama/controllers"
 	"go.fromyama/routes"
+	"go.fromyama/utils/address"
 	"go.fromyama/utils/database"
+	"go.fromyama/utils/jwtUtil"
+	"go.fromyama/utils/pdf"
+	"go.fromyama/utils/storage"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -47,6 +53,19 @@ func main() {
 		log.Fatal("Error Connecting To Database")
 		return
 	}
+	if err = storage.ConnectToBlobStore(); err != nil {
+		log.Fatalf("Error Connecting To Blob Store: %s", err.Error())
+		return
+	}
+	if err = jwtUtil.LoadKeys(); err != nil {
+		log.Fatalf("Error Loading JWT Keys: %s", err.Error())
+		return
+	}
+	address.ConnectToProvider()
+	pdf.ConnectToRenderer()
+	controllers.ConnectToCarriers()
+	controllers.StartDocumentRetention(time.Hour)
+	controllers.StartTrackingPoller(time.Minute * 30)
 	walkF := func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
 		log.Printf("%s, %s\n", method, route)
 		return nil
@@ -0,0 +1,110 @@
+package address
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Address is a shipping address as it is validated and normalized
+type Address struct {
+	Name       string `json:"name,omitempty"`
+	Street     string `json:"street"`
+	Street2    string `json:"street2,omitempty"`
+	City       string `json:"city"`
+	Province   string `json:"province"`
+	Country    string `json:"country"`
+	PostalCode string `json:"postal_code"`
+}
+
+// Issue is a problem found with one field of an address
+type Issue struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Result is the normalized address and the issues found with it, an address with issues should not be
+// shipped to
+type Result struct {
+	Address Address `json:"address"`
+	Valid   bool    `json:"valid"`
+	POBox   bool    `json:"po_box"`
+	Issues  []Issue `json:"issues,omitempty"`
+}
+
+// Validator checks and normalizes addresses
+type Validator interface {
+	Validate(a Address) (Result, error)
+}
+
+type addressError struct {
+	s string
+}
+
+func (e *addressError) Error() string {
+	return e.s
+}
+
+// Provider is the validator addresses are checked with
+var Provider Validator = Rules{}
+
+// ConnectToProvider sets Provider from ADDRESS_PROVIDER, "http" posts addresses to ADDRESS_PROVIDER_URL after
+// the offline rules pass, anything else uses the offline rules only
+func ConnectToProvider() {
+	if os.Getenv("ADDRESS_PROVIDER") == "http" {
+		Provider = &HTTPProvider{
+			URL: os.Getenv("ADDRESS_PROVIDER_URL"),
+			Key: os.Getenv("ADDRESS_PROVIDER_KEY"),
+		}
+		return
+	}
+	Provider = Rules{}
+}
+
+// HTTPProvider is a validation service that takes an Address as json and answers with a Result, addresses
+// are checked with the offline rules first so the service only sees addresses that are well formed
+type HTTPProvider struct {
+	URL string
+	Key string
+}
+
+// Validate checks the address with the offline rules and then the provider
+func (p *HTTPProvider) Validate(a Address) (Result, error) {
+	result, err := Rules{}.Validate(a)
+	if err != nil || !result.Valid {
+		return result, err
+	}
+
+	body, err := json.Marshal(result.Address)
+	if err != nil {
+		return result, err
+	}
+	req, err := http.NewRequest("POST", p.URL, bytes.NewBuffer(body))
+	if err != nil {
+		return result, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.Key != "" {
+		req.Header.Set("Authorization", "Bearer "+p.Key)
+	}
+	client := &http.Client{
+		Timeout: time.Second * 10,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return result, &addressError{"Address Provider Failed With " + resp.Status}
+	}
+
+	var provided Result
+	if err = json.NewDecoder(resp.Body).Decode(&provided); err != nil {
+		return result, err
+	}
+	provided.POBox = provided.POBox || result.POBox
+	return provided, nil
+}
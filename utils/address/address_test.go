@@ -0,0 +1,86 @@
+package address
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRulesNormalize(t *testing.T) {
+	result, err := Rules{}.Validate(Address{
+		Street: "  123  Main St ", City: "Toronto", Province: "ontario", Country: "Canada", PostalCode: "m5v3l9",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Address{Street: "123 Main St", City: "Toronto", Province: "ON", Country: "CA", PostalCode: "M5V 3L9"}
+	if !result.Valid || result.Address != want {
+		t.Errorf("got %+v, want %+v", result, want)
+	}
+}
+
+func TestRulesIssues(t *testing.T) {
+	cases := []struct {
+		address Address
+		field   string
+	}{
+		{Address{Street: "1 A St", City: "X", Province: "ZZ", Country: "CA", PostalCode: "K1A 0B1"}, "province"},
+		{Address{Street: "1 A St", City: "X", Province: "ON", Country: "CA", PostalCode: "12345"}, "postal_code"},
+		{Address{Street: "1 A St", City: "X", Province: "BC", Country: "CA", PostalCode: "K1A 0B1"}, "postal_code"},
+		{Address{Street: "1 A St", City: "X", Province: "Texas", Country: "US", PostalCode: "7870"}, "postal_code"},
+		{Address{Street: "1 A St", City: "X", Province: "XX", Country: "US", PostalCode: "78701"}, "province"},
+		{Address{Street: "", City: "X", Province: "ON", Country: "CA", PostalCode: "K1A 0B1"}, "street"},
+	}
+	for _, c := range cases {
+		result, _ := Rules{}.Validate(c.address)
+		if result.Valid || len(result.Issues) == 0 || result.Issues[0].Field != c.field {
+			t.Errorf("%+v: got %+v, want issue on %s", c.address, result.Issues, c.field)
+		}
+	}
+}
+
+func TestRulesUSZip(t *testing.T) {
+	result, _ := Rules{}.Validate(Address{Street: "1 A St", City: "Austin", Province: "texas", Country: "USA", PostalCode: "787011234"})
+	if !result.Valid || result.Address.PostalCode != "78701-1234" || result.Address.Province != "TX" || result.Address.Country != "US" {
+		t.Errorf("got %+v", result)
+	}
+}
+
+func TestRulesPOBox(t *testing.T) {
+	for _, street := range []string{"PO Box 12", "P.O. BOX 5", "Case Postale 40", "C.P. 123", "General Delivery"} {
+		result, _ := Rules{}.Validate(Address{Street: street, City: "X", Province: "QC", Country: "CA", PostalCode: "H2X 1Y4"})
+		if !result.POBox {
+			t.Errorf("%q not flagged as a po box", street)
+		}
+	}
+	result, _ := Rules{}.Validate(Address{Street: "12 Boxwood Cres", City: "X", Province: "ON", Country: "CA", PostalCode: "K1A 0B1"})
+	if result.POBox {
+		t.Errorf("street address flagged as a po box")
+	}
+}
+
+func TestHTTPProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer key" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var a Address
+		_ = json.NewDecoder(r.Body).Decode(&a)
+		a.Street = "123 MAIN ST"
+		_ = json.NewEncoder(w).Encode(Result{Address: a, Valid: true})
+	}))
+	defer server.Close()
+
+	provider := &HTTPProvider{URL: server.URL, Key: "key"}
+	result, err := provider.Validate(Address{Street: "123 main street", City: "Toronto", Province: "ON", Country: "CA", PostalCode: "M5V3L9"})
+	if err != nil || !result.Valid || result.Address.Street != "123 MAIN ST" || result.Address.PostalCode != "M5V 3L9" {
+		t.Errorf("got %+v %v", result, err)
+	}
+
+	result, err = provider.Validate(Address{Street: "123 main street", City: "Toronto", Province: "ON", Country: "CA", PostalCode: "bad"})
+	if err != nil || result.Valid {
+		t.Errorf("malformed address should fail before the provider, got %+v %v", result, err)
+	}
+}
@@ -0,0 +1,147 @@
+package address
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Rules is the offline validator, it knows the postal code formats and province codes of canada and the
+// united states and only normalizes addresses in other countries
+type Rules struct{}
+
+var countryNames = map[string]string{
+	"CANADA": "CA", "CAN": "CA",
+	"UNITED STATES": "US", "UNITED STATES OF AMERICA": "US", "USA": "US", "U.S.A.": "US", "U.S.": "US",
+}
+
+var canadaProvinces = map[string]string{
+	"AB": "ALBERTA", "BC": "BRITISH COLUMBIA", "MB": "MANITOBA", "NB": "NEW BRUNSWICK",
+	"NL": "NEWFOUNDLAND AND LABRADOR", "NS": "NOVA SCOTIA", "NT": "NORTHWEST TERRITORIES", "NU": "NUNAVUT",
+	"ON": "ONTARIO", "PE": "PRINCE EDWARD ISLAND", "QC": "QUEBEC", "SK": "SASKATCHEWAN", "YT": "YUKON",
+}
+
+var unitedStates = map[string]string{
+	"AL": "ALABAMA", "AK": "ALASKA", "AZ": "ARIZONA", "AR": "ARKANSAS", "CA": "CALIFORNIA", "CO": "COLORADO",
+	"CT": "CONNECTICUT", "DE": "DELAWARE", "DC": "DISTRICT OF COLUMBIA", "FL": "FLORIDA", "GA": "GEORGIA",
+	"HI": "HAWAII", "ID": "IDAHO", "IL": "ILLINOIS", "IN": "INDIANA", "IA": "IOWA", "KS": "KANSAS",
+	"KY": "KENTUCKY", "LA": "LOUISIANA", "ME": "MAINE", "MD": "MARYLAND", "MA": "MASSACHUSETTS",
+	"MI": "MICHIGAN", "MN": "MINNESOTA", "MS": "MISSISSIPPI", "MO": "MISSOURI", "MT": "MONTANA",
+	"NE": "NEBRASKA", "NV": "NEVADA", "NH": "NEW HAMPSHIRE", "NJ": "NEW JERSEY", "NM": "NEW MEXICO",
+	"NY": "NEW YORK", "NC": "NORTH CAROLINA", "ND": "NORTH DAKOTA", "OH": "OHIO", "OK": "OKLAHOMA",
+	"OR": "OREGON", "PA": "PENNSYLVANIA", "RI": "RHODE ISLAND", "SC": "SOUTH CAROLINA", "SD": "SOUTH DAKOTA",
+	"TN": "TENNESSEE", "TX": "TEXAS", "UT": "UTAH", "VT": "VERMONT", "VA": "VIRGINIA", "WA": "WASHINGTON",
+	"WV": "WEST VIRGINIA", "WI": "WISCONSIN", "WY": "WYOMING", "PR": "PUERTO RICO", "GU": "GUAM",
+	"VI": "VIRGIN ISLANDS", "AS": "AMERICAN SAMOA", "MP": "NORTHERN MARIANA ISLANDS",
+	"AA": "ARMED FORCES AMERICAS", "AE": "ARMED FORCES EUROPE", "AP": "ARMED FORCES PACIFIC",
+}
+
+// canadaPostalPrefixes maps the first letter of a canadian postal code to the provinces it is used in
+var canadaPostalPrefixes = map[byte][]string{
+	'A': {"NL"}, 'B': {"NS"}, 'C': {"PE"}, 'E': {"NB"}, 'G': {"QC"}, 'H': {"QC"}, 'J': {"QC"},
+	'K': {"ON"}, 'L': {"ON"}, 'M': {"ON"}, 'N': {"ON"}, 'P': {"ON"}, 'R': {"MB"}, 'S': {"SK"},
+	'T': {"AB"}, 'V': {"BC"}, 'X': {"NT", "NU"}, 'Y': {"YT"},
+}
+
+var canadaPostalCode = regexp.MustCompile(`^[ABCEGHJ-NPRSTVXY][0-9][ABCEGHJ-NPRSTV-Z][0-9][ABCEGHJ-NPRSTV-Z][0-9]$`)
+var usZipCode = regexp.MustCompile(`^([0-9]{5})(?:-?([0-9]{4}))?$`)
+var poBox = regexp.MustCompile(`(?i)\b(P\.?\s*O\.?\s*BOX|POST\s+OFFICE\s+BOX|POSTAL\s+BOX|BOX\s+\d+|CASE\s+POSTALE|C\.?\s*P\.?\s+\d+|GENERAL\s+DELIVERY|POSTE\s+RESTANTE)\b`)
+var spaces = regexp.MustCompile(`\s+`)
+
+// Validate normalizes the country, postal code and province of the address and checks they agree
+func (Rules) Validate(a Address) (Result, error) {
+	result := Result{Address: a}
+	add := func(field, message string) {
+		result.Issues = append(result.Issues, Issue{Field: field, Message: message})
+	}
+	n := &result.Address
+
+	n.Name = clean(n.Name)
+	n.Street = clean(n.Street)
+	n.Street2 = clean(n.Street2)
+	n.City = clean(n.City)
+	n.Country = NormalizeCountry(n.Country)
+	n.Province = strings.ToUpper(clean(n.Province))
+	n.PostalCode = strings.ToUpper(clean(n.PostalCode))
+
+	if n.Street == "" {
+		add("street", "Street Missing")
+	}
+	if n.City == "" {
+		add("city", "City Missing")
+	}
+	if len(n.Country) != 2 {
+		add("country", "Country Must Be A 2 Letter Code")
+	}
+	result.POBox = poBox.MatchString(n.Street) || poBox.MatchString(n.Street2)
+
+	switch n.Country {
+	case "CA":
+		n.Province = provinceCode(n.Province, canadaProvinces)
+		if _, ok := canadaProvinces[n.Province]; !ok {
+			add("province", "Unknown Province "+n.Province)
+		}
+		postal := strings.ReplaceAll(n.PostalCode, " ", "")
+		if !canadaPostalCode.MatchString(postal) {
+			add("postal_code", "Postal Code Must Look Like A1A 1A1")
+			break
+		}
+		n.PostalCode = postal[:3] + " " + postal[3:]
+		if provinces, ok := canadaPostalPrefixes[postal[0]]; ok && !contains(provinces, n.Province) {
+			add("postal_code", "Postal Code "+n.PostalCode+" Is Not In "+n.Province)
+		}
+	case "US":
+		n.Province = provinceCode(n.Province, unitedStates)
+		if _, ok := unitedStates[n.Province]; !ok {
+			add("province", "Unknown State "+n.Province)
+		}
+		zip := usZipCode.FindStringSubmatch(strings.ReplaceAll(n.PostalCode, " ", ""))
+		if zip == nil {
+			add("postal_code", "Zip Code Must Look Like 12345 Or 12345-6789")
+			break
+		}
+		n.PostalCode = zip[1]
+		if zip[2] != "" {
+			n.PostalCode += "-" + zip[2]
+		}
+	}
+
+	result.Valid = len(result.Issues) == 0
+	return result, nil
+}
+
+// NormalizeCountry returns the 2 letter code of a country name or code
+func NormalizeCountry(country string) string {
+	country = strings.ToUpper(clean(country))
+	if code, ok := countryNames[country]; ok {
+		return code
+	}
+	return country
+}
+
+// provinceCode util function that returns the code of a province given by its code or its full name
+func provinceCode(province string, codes map[string]string) string {
+	if _, ok := codes[province]; ok {
+		return province
+	}
+	name := strings.ReplaceAll(strings.ReplaceAll(province, "É", "E"), ".", "")
+	for code, full := range codes {
+		if full == name {
+			return code
+		}
+	}
+	return province
+}
+
+// clean util function that trims an address field and collapses the spaces in it
+func clean(s string) string {
+	return spaces.ReplaceAllString(strings.TrimSpace(s), " ")
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
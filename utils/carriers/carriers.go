@@ -0,0 +1,179 @@
+package carriers
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// carrier names used in requests and stored on labels
+const (
+	CanadaPost = "canadapost"
+	Purolator  = "purolator"
+	UPS        = "ups"
+	FedEx      = "fedex"
+)
+
+// label formats a carrier can be asked for
+const (
+	FormatPDFLetter = "pdf_8.5x11"
+	FormatPDF4x6    = "pdf_4x6"
+	FormatZPL       = "zpl"
+)
+
+// Address is a shipper or receiver address
+type Address struct {
+	Name        string
+	Company     string
+	Street      string
+	Street2     string
+	City        string
+	Province    string
+	Country     string
+	PostalCode  string
+	Phone       string
+	Email       string
+	Residential bool
+}
+
+// Parcel is a single package, dimensions in cm and weight in kg
+type Parcel struct {
+	Length float64
+	Width  float64
+	Height float64
+	Weight float64
+}
+
+// RateRequest asks for the rates of every service between two addresses, or only ServiceCode when it is set,
+// Contents, Value in cents, HSCode and OriginCountry are declared to customs when the parcel leaves canada
+type RateRequest struct {
+	From          Address
+	To            Address
+	Parcel        Parcel
+	ServiceCode   string
+	Contents      string
+	Value         int64
+	HSCode        string
+	OriginCountry string
+}
+
+// Surcharge is a fee added to the base price of a rate
+type Surcharge struct {
+	Code   string
+	Name   string
+	Amount int64
+}
+
+// Rate is the normalized price of a service, amounts are in cents and weights in kg
+type Rate struct {
+	Carrier           string
+	ServiceCode       string
+	ServiceName       string
+	Base              int64
+	Surcharges        []Surcharge
+	Taxes             int64
+	Total             int64
+	BillableWeight    float64
+	DimensionalWeight float64
+	Residential       bool
+	TransitDays       int
+	ExpectedDelivery  string
+}
+
+// ShipRequest buys a label for ServiceCode in LabelFormat
+type ShipRequest struct {
+	RateRequest
+	LabelFormat string
+	Reference   string
+}
+
+// Shipment is a bought label, ShipmentID is what the label is fetched and voided with
+type Shipment struct {
+	ShipmentID     string
+	TrackingNumber string
+	Label          []byte
+	Cost           int64
+}
+
+// Event is a tracking event as the carrier reported it
+type Event struct {
+	Code        string
+	Description string
+	Location    string
+	OccurredAt  time.Time
+}
+
+// Carrier rates, buys, reprints, voids and tracks labels with one carrier
+type Carrier interface {
+	Name() string
+	LabelFormats() map[string]bool
+	Rates(req RateRequest) ([]Rate, error)
+	Ship(req ShipRequest) (Shipment, error)
+	Label(shipmentID, format string) ([]byte, error)
+	Void(shipmentID string) error
+	Track(trackingNumber string) ([]Event, error)
+}
+
+type carrierError struct {
+	s string
+}
+
+func (e *carrierError) Error() string {
+	return e.s
+}
+
+// Error returns an error with message s, for carrier implementations
+func Error(s string) error {
+	return &carrierError{s}
+}
+
+var registry = map[string]Carrier{}
+var registryLock sync.RWMutex
+
+// Register makes a carrier available by its name
+func Register(c Carrier) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	registry[c.Name()] = c
+}
+
+// Get returns a registered carrier
+func Get(name string) (Carrier, bool) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	c, ok := registry[name]
+	return c, ok
+}
+
+// Names returns the names of the registered carriers in order
+func Names() []string {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DimensionalWeight returns the dimensional weight in kg of a parcel for a carrier divisor in cm3 per kg
+func DimensionalWeight(p Parcel, divisor float64) float64 {
+	return math.Ceil(p.Length*p.Width*p.Height/divisor*10) / 10
+}
+
+// BillableWeight returns the greater of the actual and dimensional weight
+func BillableWeight(p Parcel, divisor float64) float64 {
+	return math.Max(p.Weight, DimensionalWeight(p, divisor))
+}
+
+// International reports whether a shipment crosses a border
+func (req RateRequest) International() bool {
+	return req.From.Country != "" && req.To.Country != "" && req.From.Country != req.To.Country
+}
+
+// Cents converts an amount in dollars to cents
+func Cents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
@@ -0,0 +1,83 @@
+package carriers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDimensionalWeight(t *testing.T) {
+	p := Parcel{Length: 50, Width: 40, Height: 30, Weight: 8}
+	if w := DimensionalWeight(p, 5000); w != 12 {
+		t.Errorf("got %v, want 12", w)
+	}
+	if w := BillableWeight(p, 5000); w != 12 {
+		t.Errorf("got billable %v, want 12", w)
+	}
+	p.Weight = 20
+	if w := BillableWeight(p, 5000); w != 20 {
+		t.Errorf("got billable %v, want the actual 20", w)
+	}
+	// partial tenths round up the way carriers bill them
+	if w := DimensionalWeight(Parcel{Length: 11, Width: 10, Height: 10}, 5000); w != 0.3 {
+		t.Errorf("got %v, want 0.3", w)
+	}
+}
+
+type fakeCarrier struct {
+	Carrier
+	name string
+}
+
+func (f fakeCarrier) Name() string {
+	return f.name
+}
+
+func TestRegistry(t *testing.T) {
+	Register(fakeCarrier{name: "zeta"})
+	Register(fakeCarrier{name: "alpha"})
+	if _, ok := Get("alpha"); !ok {
+		t.Errorf("registered carrier not found")
+	}
+	if _, ok := Get("missing"); ok {
+		t.Errorf("unregistered carrier found")
+	}
+	names := Names()
+	if len(names) != 2 || names[0] != "alpha" || names[1] != "zeta" {
+		t.Errorf("got %v", names)
+	}
+}
+
+func TestTokenSource(t *testing.T) {
+	tokenRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests++
+		r.ParseForm()
+		if r.PostForm.Get("grant_type") != "client_credentials" || r.PostForm.Get("client_id") != "id" || r.PostForm.Get("client_secret") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"access_token":"token","token_type":"bearer","expires_in":3599}`))
+	}))
+	defer server.Close()
+
+	source := &TokenSource{URL: server.URL, ClientID: "id", ClientSecret: "secret"}
+	for i := 0; i < 3; i++ {
+		if token, err := source.Token(http.DefaultClient); err != nil || token != "token" {
+			t.Fatalf("got %q %v", token, err)
+		}
+	}
+	if tokenRequests != 1 {
+		t.Errorf("got %d token requests, want 1", tokenRequests)
+	}
+	source.Reset()
+	source.Token(http.DefaultClient)
+	if tokenRequests != 2 {
+		t.Errorf("reset token was not fetched again")
+	}
+
+	source = &TokenSource{URL: server.URL, ClientID: "id", ClientSecret: "wrong"}
+	if _, err := source.Token(http.DefaultClient); err == nil {
+		t.Errorf("bad credentials should fail")
+	}
+}
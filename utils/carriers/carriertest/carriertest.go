@@ -0,0 +1,66 @@
+// Package carriertest replays recorded carrier api responses for the tests of the carrier packages
+package carriertest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+)
+
+// Recorded describes the responses recorded from a carrier api in the testdata directory of its package
+type Recorded struct {
+	// Files are the recorded files served for each request key
+	Files map[string]string
+	// Key names the recorded response a request gets, the url path when nil
+	Key func(r *http.Request) string
+	// Authorized checks the credentials of a request and its body, unauthorized requests get a 401
+	Authorized func(r *http.Request, body []byte) bool
+}
+
+// Server replays the recorded responses by request key, responses overrides the file served for a key and requests
+// collects the request bodies, files ending in _error are served as bad requests and fault files as server errors,
+// {{server}} in a file is replaced with the server url
+func (rec Recorded) Server(t *testing.T, responses map[string]string, requests map[string]string) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if rec.Authorized != nil && !rec.Authorized(r, body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		key := r.URL.Path
+		if rec.Key != nil {
+			key = rec.Key(r)
+		}
+		if requests != nil {
+			requests[key] = string(body)
+		}
+		file, ok := responses[key]
+		if !ok {
+			file = rec.Files[key]
+		}
+		data, err := ioutil.ReadFile("testdata/" + file)
+		if file == "" || err != nil {
+			t.Errorf("no recorded response for %s", key)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		ext := path.Ext(file)
+		if contentType := mime.TypeByExtension(ext); contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		name := strings.TrimSuffix(file, ext)
+		if strings.HasSuffix(name, "_error") {
+			w.WriteHeader(http.StatusBadRequest)
+		} else if name == "fault" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Write(bytes.ReplaceAll(data, []byte("{{server}}"), []byte(server.URL)))
+	}))
+	return server
+}
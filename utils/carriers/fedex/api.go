@@ -0,0 +1,222 @@
+package fedex
+
+type errorResponse struct {
+	Errors []apiError `json:"errors"`
+}
+
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type accountNumber struct {
+	Value string `json:"value"`
+}
+
+type fedexAddress struct {
+	StreetLines         []string `json:"streetLines,omitempty"`
+	City                string   `json:"city,omitempty"`
+	StateOrProvinceCode string   `json:"stateOrProvinceCode,omitempty"`
+	PostalCode          string   `json:"postalCode"`
+	CountryCode         string   `json:"countryCode"`
+	Residential         bool     `json:"residential"`
+}
+
+type contact struct {
+	PersonName  string `json:"personName,omitempty"`
+	CompanyName string `json:"companyName,omitempty"`
+	PhoneNumber string `json:"phoneNumber,omitempty"`
+}
+
+type fedexParty struct {
+	Contact *contact     `json:"contact,omitempty"`
+	Address fedexAddress `json:"address"`
+}
+
+type weight struct {
+	Units string  `json:"units"`
+	Value float64 `json:"value"`
+}
+
+type dimensions struct {
+	Length int    `json:"length"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Units  string `json:"units"`
+}
+
+type customerReference struct {
+	CustomerReferenceType string `json:"customerReferenceType"`
+	Value                 string `json:"value"`
+}
+
+type packageLineItem struct {
+	Weight             weight              `json:"weight"`
+	Dimensions         dimensions          `json:"dimensions"`
+	CustomerReferences []customerReference `json:"customerReferences,omitempty"`
+}
+
+type money struct {
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"`
+}
+
+type commodity struct {
+	Description          string `json:"description"`
+	CountryOfManufacture string `json:"countryOfManufacture"`
+	HarmonizedCode       string `json:"harmonizedCode,omitempty"`
+	Quantity             int    `json:"quantity"`
+	QuantityUnits        string `json:"quantityUnits"`
+	Weight               weight `json:"weight"`
+	CustomsValue         money  `json:"customsValue"`
+}
+
+type customsClearanceDetail struct {
+	DutiesPayment *struct {
+		PaymentType string `json:"paymentType"`
+	} `json:"dutiesPayment,omitempty"`
+	Commodities       []commodity `json:"commodities"`
+	TotalCustomsValue *money      `json:"totalCustomsValue,omitempty"`
+}
+
+type labelSpecification struct {
+	ImageType      string `json:"imageType"`
+	LabelStockType string `json:"labelStockType"`
+}
+
+type shippingChargesPayment struct {
+	PaymentType string `json:"paymentType"`
+}
+
+type requestedShipment struct {
+	Shipper                   fedexParty              `json:"shipper"`
+	Recipient                 *fedexParty             `json:"recipient,omitempty"`
+	Recipients                []fedexParty            `json:"recipients,omitempty"`
+	ServiceType               string                  `json:"serviceType,omitempty"`
+	PackagingType             string                  `json:"packagingType"`
+	PickupType                string                  `json:"pickupType"`
+	RateRequestType           []string                `json:"rateRequestType,omitempty"`
+	ShippingChargesPayment    *shippingChargesPayment `json:"shippingChargesPayment,omitempty"`
+	LabelSpecification        *labelSpecification     `json:"labelSpecification,omitempty"`
+	CustomsClearanceDetail    *customsClearanceDetail `json:"customsClearanceDetail,omitempty"`
+	RequestedPackageLineItems []packageLineItem       `json:"requestedPackageLineItems"`
+}
+
+type rateRequest struct {
+	AccountNumber     accountNumber     `json:"accountNumber"`
+	RequestedShipment requestedShipment `json:"requestedShipment"`
+}
+
+type amount struct {
+	Type        string  `json:"type"`
+	Description string  `json:"description"`
+	Amount      float64 `json:"amount"`
+}
+
+type ratedShipmentDetail struct {
+	RateType           string  `json:"rateType"`
+	TotalBaseCharge    float64 `json:"totalBaseCharge"`
+	TotalNetCharge     float64 `json:"totalNetCharge"`
+	ShipmentRateDetail struct {
+		TotalBillingWeight weight   `json:"totalBillingWeight"`
+		SurCharges         []amount `json:"surCharges"`
+		Taxes              []amount `json:"taxes"`
+	} `json:"shipmentRateDetail"`
+}
+
+type rateReplyDetail struct {
+	ServiceType          string                `json:"serviceType"`
+	ServiceName          string                `json:"serviceName"`
+	RatedShipmentDetails []ratedShipmentDetail `json:"ratedShipmentDetails"`
+	Commit               struct {
+		TransitDays struct {
+			MinimumTransitTime string `json:"minimumTransitTime"`
+		} `json:"transitDays"`
+		DateDetail struct {
+			DayFormat string `json:"dayFormat"`
+		} `json:"dateDetail"`
+	} `json:"commit"`
+}
+
+type rateResponse struct {
+	Output struct {
+		RateReplyDetails []rateReplyDetail `json:"rateReplyDetails"`
+	} `json:"output"`
+}
+
+type shipRequest struct {
+	LabelResponseOptions string            `json:"labelResponseOptions"`
+	AccountNumber        accountNumber     `json:"accountNumber"`
+	RequestedShipment    requestedShipment `json:"requestedShipment"`
+}
+
+type shipResponse struct {
+	Output struct {
+		TransactionShipments []struct {
+			MasterTrackingNumber string `json:"masterTrackingNumber"`
+			PieceResponses       []struct {
+				TrackingNumber   string `json:"trackingNumber"`
+				PackageDocuments []struct {
+					ContentType  string `json:"contentType"`
+					DocType      string `json:"docType"`
+					EncodedLabel string `json:"encodedLabel"`
+				} `json:"packageDocuments"`
+			} `json:"pieceResponses"`
+			CompletedShipmentDetail struct {
+				ShipmentRating struct {
+					ShipmentRateDetails []struct {
+						RateType       string  `json:"rateType"`
+						TotalNetCharge float64 `json:"totalNetCharge"`
+					} `json:"shipmentRateDetails"`
+				} `json:"shipmentRating"`
+			} `json:"completedShipmentDetail"`
+		} `json:"transactionShipments"`
+	} `json:"output"`
+}
+
+type cancelRequest struct {
+	AccountNumber   accountNumber `json:"accountNumber"`
+	TrackingNumber  string        `json:"trackingNumber"`
+	DeletionControl string        `json:"deletionControl"`
+}
+
+type cancelResponse struct {
+	Output struct {
+		CancelledShipment bool   `json:"cancelledShipment"`
+		Message           string `json:"message"`
+	} `json:"output"`
+}
+
+type trackingNumberInfo struct {
+	TrackingNumberInfo struct {
+		TrackingNumber string `json:"trackingNumber"`
+	} `json:"trackingNumberInfo"`
+}
+
+type trackRequest struct {
+	IncludeDetailedScans bool                 `json:"includeDetailedScans"`
+	TrackingInfo         []trackingNumberInfo `json:"trackingInfo"`
+}
+
+type scanEvent struct {
+	Date             string `json:"date"`
+	EventType        string `json:"eventType"`
+	EventDescription string `json:"eventDescription"`
+	ScanLocation     struct {
+		City                string `json:"city"`
+		StateOrProvinceCode string `json:"stateOrProvinceCode"`
+		CountryCode         string `json:"countryCode"`
+	} `json:"scanLocation"`
+}
+
+type trackResponse struct {
+	Output struct {
+		CompleteTrackResults []struct {
+			TrackingNumber string `json:"trackingNumber"`
+			TrackResults   []struct {
+				ScanEvents []scanEvent `json:"scanEvents"`
+				Error      *apiError   `json:"error"`
+			} `json:"trackResults"`
+		} `json:"completeTrackResults"`
+	} `json:"output"`
+}
@@ -0,0 +1,399 @@
+package fedex
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.fromyama/utils/carriers"
+)
+
+// DevelopmentURL is the fedex sandbox, FEDEX_URL points to https://apis.fedex.com in production
+const DevelopmentURL = "https://apis-sandbox.fedex.com"
+
+const (
+	tokenPath  = "/oauth/token"
+	ratePath   = "/rate/v1/rates/quotes"
+	shipPath   = "/ship/v1/shipments"
+	cancelPath = "/ship/v1/shipments/cancel"
+	trackPath  = "/track/v1/trackingnumbers"
+)
+
+// dimensionalDivisor is the cm3 per kg fedex bills dimensional weight with
+const dimensionalDivisor = 5000.0
+
+const surchargeResidential = "RESIDENTIAL_DELIVERY"
+
+// labelStocks are the image and stock type of each label format
+var labelStocks = map[string]labelSpecification{
+	carriers.FormatPDFLetter: {ImageType: "PDF", LabelStockType: "PAPER_85X11_TOP_HALF_LABEL"},
+	carriers.FormatPDF4x6:    {ImageType: "PDF", LabelStockType: "PAPER_4X6"},
+	carriers.FormatZPL:       {ImageType: "ZPLII", LabelStockType: "STOCK_4X6"},
+}
+
+// transitDays are the transit times fedex spells out
+var transitDays = map[string]int{
+	"ONE_DAY": 1, "TWO_DAYS": 2, "THREE_DAYS": 3, "FOUR_DAYS": 4, "FIVE_DAYS": 5,
+	"SIX_DAYS": 6, "SEVEN_DAYS": 7, "EIGHT_DAYS": 8, "NINE_DAYS": 9, "TEN_DAYS": 10,
+}
+
+// Client is a fedex account using the rest apis with the client credentials of an oauth app, Account is the
+// account number labels are bought on
+type Client struct {
+	URL     string
+	Account string
+	Timeout time.Duration
+
+	tokens *carriers.TokenSource
+}
+
+// New returns a client for the fedex apis at url, clientID and clientSecret are the oauth app credentials
+func New(url, clientID, clientSecret, account string) *Client {
+	url = strings.TrimRight(url, "/")
+	return &Client{
+		URL:     url,
+		Account: account,
+		tokens:  &carriers.TokenSource{URL: url + tokenPath, ClientID: clientID, ClientSecret: clientSecret},
+	}
+}
+
+// FromEnv returns the client configured with FEDEX_CLIENT_ID, FEDEX_CLIENT_SECRET, FEDEX_ACCOUNT and optionally
+// FEDEX_URL, nil is returned when fedex is not configured
+func FromEnv() *Client {
+	if os.Getenv("FEDEX_CLIENT_ID") == "" {
+		return nil
+	}
+	url := os.Getenv("FEDEX_URL")
+	if url == "" {
+		url = DevelopmentURL
+	}
+	return New(url, os.Getenv("FEDEX_CLIENT_ID"), os.Getenv("FEDEX_CLIENT_SECRET"), os.Getenv("FEDEX_ACCOUNT"))
+}
+
+// Name returns the carrier name labels are stored with
+func (c *Client) Name() string {
+	return carriers.FedEx
+}
+
+// LabelFormats returns the formats fedex produces itself
+func (c *Client) LabelFormats() map[string]bool {
+	formats := map[string]bool{}
+	for format := range labelStocks {
+		formats[format] = true
+	}
+	return formats
+}
+
+// Rates returns the rate of every service, or only req.ServiceCode when it is set, with the account rate when
+// fedex returns one and the list rate otherwise
+func (c *Client) Rates(req carriers.RateRequest) ([]carriers.Rate, error) {
+	rateReq := rateRequest{AccountNumber: accountNumber{c.Account}, RequestedShipment: c.requestedShipment(req, "")}
+	rateReq.RequestedShipment.Recipient = &rateReq.RequestedShipment.Recipients[0]
+	rateReq.RequestedShipment.Recipients = nil
+	rateReq.RequestedShipment.ServiceType = req.ServiceCode
+	rateReq.RequestedShipment.RateRequestType = []string{"ACCOUNT", "LIST"}
+	var resp rateResponse
+	if err := c.call("POST", ratePath, rateReq, &resp); err != nil {
+		return nil, err
+	}
+
+	dimensional := carriers.DimensionalWeight(req.Parcel, dimensionalDivisor)
+	var rates []carriers.Rate
+	for _, reply := range resp.Output.RateReplyDetails {
+		if req.ServiceCode != "" && reply.ServiceType != req.ServiceCode {
+			continue
+		}
+		detail, ok := accountRate(reply.RatedShipmentDetails)
+		if !ok {
+			continue
+		}
+		rate := carriers.Rate{
+			Carrier:           carriers.FedEx,
+			ServiceCode:       reply.ServiceType,
+			ServiceName:       reply.ServiceName,
+			Base:              carriers.Cents(detail.TotalBaseCharge),
+			Total:             carriers.Cents(detail.TotalNetCharge),
+			BillableWeight:    carriers.BillableWeight(req.Parcel, dimensionalDivisor),
+			DimensionalWeight: dimensional,
+			TransitDays:       transitDays[reply.Commit.TransitDays.MinimumTransitTime],
+			ExpectedDelivery:  reply.Commit.DateDetail.DayFormat,
+		}
+		if rate.ServiceName == "" {
+			rate.ServiceName = reply.ServiceType
+		}
+		for _, s := range detail.ShipmentRateDetail.SurCharges {
+			rate.Surcharges = append(rate.Surcharges, carriers.Surcharge{Code: s.Type, Name: s.Description, Amount: carriers.Cents(s.Amount)})
+			if s.Type == surchargeResidential {
+				rate.Residential = true
+			}
+		}
+		for _, t := range detail.ShipmentRateDetail.Taxes {
+			rate.Taxes += carriers.Cents(t.Amount)
+		}
+		if billed := detail.ShipmentRateDetail.TotalBillingWeight; billed.Value > 0 {
+			rate.BillableWeight = billed.Value
+			if billed.Units == "LB" {
+				rate.BillableWeight = math.Round(billed.Value*0.45359237*10) / 10
+			}
+		}
+		rates = append(rates, rate)
+	}
+	if req.ServiceCode != "" && len(rates) == 0 {
+		return nil, carriers.Error("No FedEx Rate For Service " + req.ServiceCode)
+	}
+	return rates, nil
+}
+
+// Ship creates the shipment and returns it with its label and what fedex charged for it
+func (c *Client) Ship(req carriers.ShipRequest) (carriers.Shipment, error) {
+	var shipment carriers.Shipment
+	stock, ok := labelStocks[req.LabelFormat]
+	if !ok {
+		return shipment, carriers.Error("Label Format " + req.LabelFormat + " Not Supported By FedEx")
+	}
+	if req.International() && (req.Contents == "" || req.Value <= 0) {
+		return shipment, carriers.Error("FedEx Shipments Leaving " + req.From.Country + " Need Contents And Value")
+	}
+	shipReq := shipRequest{
+		LabelResponseOptions: "LABEL",
+		AccountNumber:        accountNumber{c.Account},
+		RequestedShipment:    c.requestedShipment(req.RateRequest, req.Reference),
+	}
+	shipReq.RequestedShipment.ServiceType = req.ServiceCode
+	shipReq.RequestedShipment.ShippingChargesPayment = &shippingChargesPayment{PaymentType: "SENDER"}
+	shipReq.RequestedShipment.LabelSpecification = &stock
+	var resp shipResponse
+	if err := c.call("POST", shipPath, shipReq, &resp); err != nil {
+		return shipment, err
+	}
+	if len(resp.Output.TransactionShipments) == 0 || resp.Output.TransactionShipments[0].MasterTrackingNumber == "" {
+		return shipment, carriers.Error("No FedEx Tracking Number")
+	}
+	result := resp.Output.TransactionShipments[0]
+	shipment.ShipmentID = result.MasterTrackingNumber
+	shipment.TrackingNumber = result.MasterTrackingNumber
+	for _, rating := range result.CompletedShipmentDetail.ShipmentRating.ShipmentRateDetails {
+		if shipment.Cost == 0 || strings.HasPrefix(rating.RateType, "PAYOR_ACCOUNT") {
+			shipment.Cost = carriers.Cents(rating.TotalNetCharge)
+		}
+	}
+
+	for _, piece := range result.PieceResponses {
+		for _, document := range piece.PackageDocuments {
+			if document.EncodedLabel == "" {
+				continue
+			}
+			label, err := base64.StdEncoding.DecodeString(document.EncodedLabel)
+			if err != nil {
+				break
+			}
+			shipment.Label = label
+			return shipment, nil
+		}
+	}
+	// the shipment exists without a label, cancel it so it is not billed
+	_ = c.Void(shipment.ShipmentID)
+	return shipment, carriers.Error("No FedEx Label For " + shipment.ShipmentID)
+}
+
+// Label fails, fedex only returns a label when the shipment is created
+func (c *Client) Label(shipmentID, format string) ([]byte, error) {
+	return nil, carriers.Error("FedEx Labels Can Not Be Reprinted")
+}
+
+// Void cancels a shipment that has not been picked up
+func (c *Client) Void(shipmentID string) error {
+	cancelReq := cancelRequest{AccountNumber: accountNumber{c.Account}, TrackingNumber: shipmentID, DeletionControl: "DELETE_ALL_PACKAGES"}
+	var resp cancelResponse
+	if err := c.call("PUT", cancelPath, cancelReq, &resp); err != nil {
+		return err
+	}
+	if !resp.Output.CancelledShipment {
+		return carriers.Error("FedEx Shipment " + shipmentID + " Not Cancelled, " + resp.Output.Message)
+	}
+	return nil
+}
+
+// Track returns the scans of a shipment, newest first as fedex reports them
+func (c *Client) Track(trackingNumber string) ([]carriers.Event, error) {
+	var info trackingNumberInfo
+	info.TrackingNumberInfo.TrackingNumber = trackingNumber
+	var resp trackResponse
+	if err := c.call("POST", trackPath, trackRequest{IncludeDetailedScans: true, TrackingInfo: []trackingNumberInfo{info}}, &resp); err != nil {
+		return nil, err
+	}
+	var events []carriers.Event
+	for _, complete := range resp.Output.CompleteTrackResults {
+		for _, result := range complete.TrackResults {
+			if result.Error != nil && len(result.ScanEvents) == 0 {
+				return nil, carriers.Error("FedEx Error " + result.Error.Code + ", " + result.Error.Message)
+			}
+			for _, scan := range result.ScanEvents {
+				occurredAt, err := time.Parse(time.RFC3339, scan.Date)
+				if err != nil {
+					continue
+				}
+				var location []string
+				for _, part := range []string{scan.ScanLocation.City, scan.ScanLocation.StateOrProvinceCode, scan.ScanLocation.CountryCode} {
+					if part != "" {
+						location = append(location, part)
+					}
+				}
+				events = append(events, carriers.Event{
+					Code:        scan.EventType,
+					Description: strings.TrimSpace(scan.EventDescription),
+					Location:    strings.Join(location, ", "),
+					OccurredAt:  occurredAt,
+				})
+			}
+		}
+	}
+	return events, nil
+}
+
+// requestedShipment builds the shipment the rate and ship requests share
+func (c *Client) requestedShipment(req carriers.RateRequest, reference string) requestedShipment {
+	item := packageLineItem{
+		Weight: weight{Units: "KG", Value: req.Parcel.Weight},
+		Dimensions: dimensions{
+			Length: int(math.Ceil(req.Parcel.Length)),
+			Width:  int(math.Ceil(req.Parcel.Width)),
+			Height: int(math.Ceil(req.Parcel.Height)),
+			Units:  "CM",
+		},
+	}
+	if reference != "" {
+		item.CustomerReferences = []customerReference{{CustomerReferenceType: "CUSTOMER_REFERENCE", Value: reference}}
+	}
+	s := requestedShipment{
+		Shipper:                   party(req.From),
+		Recipients:                []fedexParty{party(req.To)},
+		PackagingType:             "YOUR_PACKAGING",
+		PickupType:                "DROPOFF_AT_FEDEX_LOCATION",
+		RequestedPackageLineItems: []packageLineItem{item},
+	}
+	if req.International() {
+		value := money{Amount: float64(req.Value) / 100.0, Currency: "CAD"}
+		contents := req.Contents
+		if contents == "" {
+			contents = "Merchandise"
+		}
+		origin := req.OriginCountry
+		if origin == "" {
+			origin = req.From.Country
+		}
+		s.CustomsClearanceDetail = &customsClearanceDetail{
+			Commodities: []commodity{{
+				Description:          contents,
+				CountryOfManufacture: origin,
+				HarmonizedCode:       strings.ReplaceAll(req.HSCode, ".", ""),
+				Quantity:             1,
+				QuantityUnits:        "PCS",
+				Weight:               item.Weight,
+				CustomsValue:         value,
+			}},
+			TotalCustomsValue: &value,
+		}
+		s.CustomsClearanceDetail.DutiesPayment = &struct {
+			PaymentType string `json:"paymentType"`
+		}{PaymentType: "RECIPIENT"}
+	}
+	return s
+}
+
+// call sends a json request to a fedex api with the oauth token and decodes the response into out, the token
+// is fetched again once when fedex rejects it
+func (c *Client) call(method, path string, request, out interface{}) error {
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	client := c.httpClient()
+	for attempt := 0; ; attempt++ {
+		token, err := c.tokens.Token(client)
+		if err != nil {
+			return carriers.Error("FedEx Authorization Failed, " + err.Error())
+		}
+		req, err := http.NewRequest(method, c.URL+path, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-locale", "en_CA")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		respBody, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			c.tokens.Reset()
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			var errResp errorResponse
+			if json.Unmarshal(respBody, &errResp) == nil && len(errResp.Errors) > 0 {
+				return carriers.Error("FedEx Error " + errResp.Errors[0].Code + ", " + errResp.Errors[0].Message)
+			}
+			return carriers.Error("FedEx Request Failed With " + resp.Status)
+		}
+		return json.Unmarshal(respBody, out)
+	}
+}
+
+func (c *Client) httpClient() *http.Client {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = time.Second * 20
+	}
+	return &http.Client{Timeout: timeout}
+}
+
+// accountRate picks the account rate of a service, falling back to the list rate
+func accountRate(details []ratedShipmentDetail) (ratedShipmentDetail, bool) {
+	for _, detail := range details {
+		if detail.RateType == "ACCOUNT" {
+			return detail, true
+		}
+	}
+	if len(details) == 0 {
+		return ratedShipmentDetail{}, false
+	}
+	return details[0], true
+}
+
+// party converts an address to a fedex shipper or recipient
+func party(a carriers.Address) fedexParty {
+	p := fedexParty{
+		Contact: &contact{PersonName: a.Name, CompanyName: a.Company, PhoneNumber: a.Phone},
+		Address: fedexAddress{
+			StreetLines:         []string{a.Street},
+			City:                a.City,
+			StateOrProvinceCode: a.Province,
+			PostalCode:          strings.ReplaceAll(a.PostalCode, " ", ""),
+			CountryCode:         a.Country,
+			Residential:         a.Residential,
+		},
+	}
+	if p.Contact.PersonName == "" {
+		p.Contact.PersonName = a.Company
+	}
+	if a.Street2 != "" {
+		p.Address.StreetLines = append(p.Address.StreetLines, a.Street2)
+	}
+	if p.Address.CountryCode == "" {
+		p.Address.CountryCode = "CA"
+	}
+	return p
+}
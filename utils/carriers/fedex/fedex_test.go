@@ -0,0 +1,180 @@
+package fedex
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.fromyama/utils/carriers"
+	"go.fromyama/utils/carriers/carriertest"
+)
+
+// recorded are the responses in testdata of each api path, the token needs the client credentials and everything
+// else the token
+var recorded = carriertest.Recorded{
+	Files: map[string]string{
+		tokenPath:  "token.json",
+		ratePath:   "rates.json",
+		shipPath:   "ship.json",
+		cancelPath: "cancel.json",
+		trackPath:  "track.json",
+	},
+	Authorized: func(r *http.Request, body []byte) bool {
+		if r.URL.Path == tokenPath {
+			return strings.Contains(string(body), "client_id=id") && strings.Contains(string(body), "client_secret=secret")
+		}
+		return r.Header.Get("Authorization") == "Bearer token"
+	},
+}
+
+func testClient(url string) *Client {
+	return New(url, "id", "secret", "740561073")
+}
+
+var testRequest = carriers.RateRequest{
+	From:   carriers.Address{Company: "Yama Shop", Street: "123 Main St", City: "Toronto", Province: "ON", Country: "CA", PostalCode: "M5V 3L9", Phone: "4165550100"},
+	To:     carriers.Address{Name: "Jane Doe", Street: "350 5th Ave", City: "New York", Province: "NY", Country: "US", PostalCode: "10118", Residential: true},
+	Parcel: carriers.Parcel{Length: 40, Width: 30, Height: 29.5, Weight: 3},
+}
+
+func TestRates(t *testing.T) {
+	requests := map[string]string{}
+	server := recorded.Server(t, nil, requests)
+	defer server.Close()
+
+	rates, err := testClient(server.URL).Rates(testRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rates) != 2 {
+		t.Fatalf("got %d rates, want 2", len(rates))
+	}
+	ground := rates[0]
+	if ground.ServiceCode != "FEDEX_GROUND" || ground.ServiceName != "FedEx Ground" || ground.Total != 3362 || ground.Base != 2140 ||
+		ground.Taxes != 387 || len(ground.Surcharges) != 2 || !ground.Residential || ground.TransitDays != 3 || ground.ExpectedDelivery == "" {
+		t.Errorf("got %+v", ground)
+	}
+	if ground.BillableWeight != 7.2 || ground.DimensionalWeight != 7.1 {
+		t.Errorf("got dimensional %v billable %v", ground.DimensionalWeight, ground.BillableWeight)
+	}
+	// only a list rate, billed in pounds
+	priority := rates[1]
+	if priority.Total != 9855 || priority.Residential || priority.BillableWeight != 7.3 || priority.TransitDays != 1 {
+		t.Errorf("got %+v", priority)
+	}
+
+	sent := requests[ratePath]
+	for _, want := range []string{`"recipient":{`, `"residential":true`, `"value":"740561073"`, `"postalCode":"M5V3L9"`,
+		`"height":30`, `"customsClearanceDetail"`, `"rateRequestType":["ACCOUNT","LIST"]`} {
+		if !strings.Contains(sent, want) {
+			t.Errorf("rate request is missing %s", want)
+		}
+	}
+}
+
+func TestRatesError(t *testing.T) {
+	server := recorded.Server(t, map[string]string{ratePath: "rates_error.json"}, nil)
+	defer server.Close()
+
+	_, err := testClient(server.URL).Rates(testRequest)
+	if err == nil || !strings.Contains(err.Error(), "does not provide this service") {
+		t.Errorf("got %v", err)
+	}
+
+	recorded := recorded.Server(t, nil, nil)
+	defer recorded.Close()
+	req := testRequest
+	req.ServiceCode = "FEDEX_2_DAY"
+	if _, err = testClient(recorded.URL).Rates(req); err == nil {
+		t.Errorf("service missing from the rates should fail")
+	}
+}
+
+func TestShip(t *testing.T) {
+	requests := map[string]string{}
+	server := recorded.Server(t, nil, requests)
+	defer server.Close()
+
+	req := carriers.ShipRequest{RateRequest: testRequest, LabelFormat: carriers.FormatZPL, Reference: "1001"}
+	req.ServiceCode, req.Contents, req.Value = "FEDEX_GROUND", "T-shirts", 4500
+	req.HSCode, req.OriginCountry = "6109.10", "BD"
+	shipment, err := testClient(server.URL).Ship(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shipment.ShipmentID != "794953535000" || shipment.TrackingNumber != "794953535000" || shipment.Cost != 3362 ||
+		string(shipment.Label) != "%PDF-1.4 fedex label" {
+		t.Errorf("got %+v", shipment)
+	}
+	sent := requests[shipPath]
+	for _, want := range []string{`"recipients":[{`, `"imageType":"ZPLII"`, `"labelStockType":"STOCK_4X6"`, `"description":"T-shirts"`,
+		`"amount":45`, `"customerReferences":[{"customerReferenceType":"CUSTOMER_REFERENCE","value":"1001"}]`,
+		`"countryOfManufacture":"BD"`, `"harmonizedCode":"610910"`} {
+		if !strings.Contains(sent, want) {
+			t.Errorf("ship request is missing %s", want)
+		}
+	}
+}
+
+func TestShipCancelsWithoutLabel(t *testing.T) {
+	requests := map[string]string{}
+	server := recorded.Server(t, map[string]string{shipPath: "ship_nolabel.json"}, requests)
+	defer server.Close()
+
+	req := carriers.ShipRequest{RateRequest: testRequest, LabelFormat: carriers.FormatPDFLetter}
+	req.ServiceCode, req.Contents, req.Value = "FEDEX_GROUND", "T-shirts", 4500
+	if _, err := testClient(server.URL).Ship(req); err == nil {
+		t.Fatal("ship without a label should fail")
+	}
+	if !strings.Contains(requests[cancelPath], `"trackingNumber":"794953535000"`) {
+		t.Errorf("shipment without a label was not cancelled")
+	}
+}
+
+func TestVoid(t *testing.T) {
+	server := recorded.Server(t, nil, nil)
+	defer server.Close()
+	if err := testClient(server.URL).Void("794953535000"); err != nil {
+		t.Error(err)
+	}
+
+	tendered := recorded.Server(t, map[string]string{cancelPath: "cancel_error.json"}, nil)
+	defer tendered.Close()
+	err := testClient(tendered.URL).Void("794953535000")
+	if err == nil || !strings.Contains(err.Error(), "already been tendered") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestTrack(t *testing.T) {
+	server := recorded.Server(t, nil, nil)
+	defer server.Close()
+
+	events, err := testClient(server.URL).Track("794953535000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3", len(events))
+	}
+	delivered := events[0]
+	if delivered.Code != "DL" || delivered.Description != "Delivered" || delivered.Location != "NEW YORK, NY, US" ||
+		delivered.OccurredAt.UTC().Hour() != 19 {
+		t.Errorf("got %+v", delivered)
+	}
+	if events[2].Location != "" {
+		t.Errorf("got location %q for an event without one", events[2].Location)
+	}
+
+	notFound := recorded.Server(t, map[string]string{trackPath: "track_notfound.json"}, nil)
+	defer notFound.Close()
+	if _, err = testClient(notFound.URL).Track("000000000000"); err == nil || !strings.Contains(err.Error(), "NOTFOUND") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestLabel(t *testing.T) {
+	if _, err := testClient("http://127.0.0.1:0").Label("794953535000", carriers.FormatPDFLetter); err == nil {
+		t.Errorf("fedex labels can not be reprinted")
+	}
+}
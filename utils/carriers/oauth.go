@@ -0,0 +1,90 @@
+package carriers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenSource fetches and caches an oauth client credentials access token, BasicAuth sends the client id and
+// secret as basic auth instead of in the form body
+type TokenSource struct {
+	URL          string
+	ClientID     string
+	ClientSecret string
+	BasicAuth    bool
+
+	lock    sync.Mutex
+	token   string
+	expires time.Time
+}
+
+type tokenResponse struct {
+	AccessToken string          `json:"access_token"`
+	ExpiresIn   json.RawMessage `json:"expires_in"`
+}
+
+// Token returns the cached access token, or a new one when it is missing or about to expire
+func (s *TokenSource) Token(client *http.Client) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.token != "" && time.Now().Before(s.expires) {
+		return s.token, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if !s.BasicAuth {
+		form.Set("client_id", s.ClientID)
+		form.Set("client_secret", s.ClientSecret)
+	}
+	req, err := http.NewRequest("POST", s.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	if s.BasicAuth {
+		req.SetBasicAuth(s.ClientID, s.ClientSecret)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", Error("Token Request Failed With " + resp.Status)
+	}
+	var token tokenResponse
+	if err = json.Unmarshal(body, &token); err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", Error("No Access Token")
+	}
+	// some carriers send expires_in as a string
+	seconds, err := strconv.Atoi(strings.Trim(string(token.ExpiresIn), `"`))
+	if err != nil {
+		seconds = 0
+	}
+	s.token = token.AccessToken
+	// refresh a minute early so a token never expires in flight
+	s.expires = time.Now().Add(time.Duration(seconds-60) * time.Second)
+	return s.token, nil
+}
+
+// Reset drops the cached token, used when a carrier rejects it before it was due to expire
+func (s *TokenSource) Reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.token = ""
+}
@@ -0,0 +1,452 @@
+package purolator
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.fromyama/utils/carriers"
+)
+
+// DevelopmentURL is the purolator sandbox, PUROLATOR_URL points to https://webservices.purolator.com in production
+const DevelopmentURL = "https://devwebservices.purolator.com"
+
+const namespaceV1 = "http://purolator.com/pws/datatypes/v1"
+const namespaceV2 = "http://purolator.com/pws/datatypes/v2"
+
+// service paths, soap actions and request context versions
+const (
+	estimatingPath = "/EWS/V2/Estimating/EstimatingService.asmx"
+	shippingPath   = "/EWS/V2/Shipping/ShippingService.asmx"
+	documentsPath  = "/EWS/V1/ShippingDocuments/ShippingDocumentsService.asmx"
+	trackingPath   = "/PWS/V1/Tracking/TrackingService.asmx"
+
+	actionGetFullEstimate    = "http://purolator.com/pws/service/v2/GetFullEstimate"
+	actionCreateShipment     = "http://purolator.com/pws/service/v2/CreateShipment"
+	actionVoidShipment       = "http://purolator.com/pws/service/v2/VoidShipment"
+	actionGetDocuments       = "http://purolator.com/pws/service/v1/GetDocuments"
+	actionTrackPackagesByPin = "http://purolator.com/pws/service/v1/TrackPackagesByPin"
+)
+
+// dimensionalDivisor is the cm3 per kg purolator bills dimensional weight with
+const dimensionalDivisor = 6000.0
+
+// services are the purolator services that can be quoted and bought
+var services = map[string]string{
+	"PurolatorExpress":        "Purolator Express",
+	"PurolatorExpress9AM":     "Purolator Express 9AM",
+	"PurolatorExpress10:30AM": "Purolator Express 10:30AM",
+	"PurolatorExpressEvening": "Purolator Express Evening",
+	"PurolatorGround":         "Purolator Ground",
+	"PurolatorGround9AM":      "Purolator Ground 9AM",
+	"PurolatorGround10:30AM":  "Purolator Ground 10:30AM",
+	"PurolatorGroundEvening":  "Purolator Ground Evening",
+}
+
+// documentTypes are the bill of lading document and output type of each label format
+var documentTypes = map[string][2]string{
+	carriers.FormatPDFLetter: {"DomesticBillOfLading", "PDF"},
+	carriers.FormatPDF4x6:    {"DomesticBillOfLading_Thermal", "PDF"},
+	carriers.FormatZPL:       {"DomesticBillOfLading_Thermal", "ZPL"},
+}
+
+var streetNumber = regexp.MustCompile(`^(\d+[A-Za-z]?(?:-\d+)?)\s+(.+)$`)
+
+// Client is a purolator account using the soap web services, Key and Password are the web service credentials
+// and Account is the billing account labels are bought on
+type Client struct {
+	URL      string
+	Key      string
+	Password string
+	Account  string
+	Timeout  time.Duration
+}
+
+// FromEnv returns the client configured with PUROLATOR_KEY, PUROLATOR_PASS, PUROLATOR_ACCOUNT and optionally
+// PUROLATOR_URL, nil is returned when purolator is not configured
+func FromEnv() *Client {
+	if os.Getenv("PUROLATOR_KEY") == "" {
+		return nil
+	}
+	url := os.Getenv("PUROLATOR_URL")
+	if url == "" {
+		url = DevelopmentURL
+	}
+	return &Client{
+		URL:      url,
+		Key:      os.Getenv("PUROLATOR_KEY"),
+		Password: os.Getenv("PUROLATOR_PASS"),
+		Account:  os.Getenv("PUROLATOR_ACCOUNT"),
+	}
+}
+
+// Name returns the carrier name labels are stored with
+func (c *Client) Name() string {
+	return carriers.Purolator
+}
+
+// LabelFormats returns the formats purolator produces itself
+func (c *Client) LabelFormats() map[string]bool {
+	formats := map[string]bool{}
+	for format := range documentTypes {
+		formats[format] = true
+	}
+	return formats
+}
+
+// Rates returns the estimate of every service, or only req.ServiceCode when it is set
+func (c *Client) Rates(req carriers.RateRequest) ([]carriers.Rate, error) {
+	if err := checkDomestic(req); err != nil {
+		return nil, err
+	}
+	serviceCode := req.ServiceCode
+	if serviceCode == "" {
+		serviceCode = "PurolatorExpress"
+	}
+	estimateRequest := getFullEstimateRequest{
+		Shipment:                         c.shipment(req, serviceCode, ""),
+		ShowAlternativeServicesIndicator: req.ServiceCode == "",
+	}
+	var resp getFullEstimateResponse
+	if err := c.call(estimatingPath, actionGetFullEstimate, "2.0", estimateRequest, &resp); err != nil {
+		return nil, err
+	}
+	if err := resp.ResponseInformation.err(); err != nil {
+		return nil, err
+	}
+
+	dimensional := carriers.DimensionalWeight(req.Parcel, dimensionalDivisor)
+	var rates []carriers.Rate
+	for _, estimate := range resp.ShipmentEstimates {
+		if req.ServiceCode != "" && estimate.ServiceID != req.ServiceCode {
+			continue
+		}
+		rate := carriers.Rate{
+			Carrier:           carriers.Purolator,
+			ServiceCode:       estimate.ServiceID,
+			ServiceName:       serviceName(estimate.ServiceID),
+			Base:              carriers.Cents(estimate.BasePrice),
+			Total:             carriers.Cents(estimate.TotalPrice),
+			BillableWeight:    carriers.BillableWeight(req.Parcel, dimensionalDivisor),
+			DimensionalWeight: dimensional,
+			TransitDays:       estimate.EstimatedTransitDays,
+			ExpectedDelivery:  estimate.ExpectedDeliveryDate,
+		}
+		for _, s := range estimate.Surcharges {
+			rate.Surcharges = append(rate.Surcharges, carriers.Surcharge{Code: s.Type, Name: s.Description, Amount: carriers.Cents(s.Amount)})
+			if s.Type == "ResidentialDelivery" || s.Type == "ResidentialArea" {
+				rate.Residential = true
+			}
+		}
+		for _, t := range estimate.Taxes {
+			rate.Taxes += carriers.Cents(t.Amount)
+		}
+		rates = append(rates, rate)
+	}
+	if req.ServiceCode != "" && len(rates) == 0 {
+		return nil, carriers.Error("No Purolator Rate For Service " + req.ServiceCode)
+	}
+	return rates, nil
+}
+
+// Ship creates the shipment and returns it with its label, the cost is not part of the shipment response so
+// it is left for the caller to quote with Rates
+func (c *Client) Ship(req carriers.ShipRequest) (carriers.Shipment, error) {
+	var shipment carriers.Shipment
+	if err := checkDomestic(req.RateRequest); err != nil {
+		return shipment, err
+	}
+	if _, ok := documentTypes[req.LabelFormat]; !ok {
+		return shipment, carriers.Error("Label Format " + req.LabelFormat + " Not Supported By Purolator")
+	}
+	printerType := "Regular"
+	if req.LabelFormat != carriers.FormatPDFLetter {
+		printerType = "Thermal"
+	}
+	createRequest := createShipmentRequest{
+		Shipment:    c.shipment(req.RateRequest, req.ServiceCode, req.Reference),
+		PrinterType: printerType,
+	}
+	var resp createShipmentResponse
+	if err := c.call(shippingPath, actionCreateShipment, "2.0", createRequest, &resp); err != nil {
+		return shipment, err
+	}
+	if err := resp.ResponseInformation.err(); err != nil {
+		return shipment, err
+	}
+	if resp.ShipmentPIN == "" {
+		return shipment, carriers.Error("No Purolator Shipment PIN")
+	}
+	shipment.ShipmentID = resp.ShipmentPIN
+	shipment.TrackingNumber = resp.ShipmentPIN
+
+	label, err := c.Label(resp.ShipmentPIN, req.LabelFormat)
+	if err != nil {
+		// the shipment exists without a label, void it so it is not billed
+		_ = c.Void(resp.ShipmentPIN)
+		return shipment, err
+	}
+	shipment.Label = label
+	return shipment, nil
+}
+
+// Label returns the bill of lading of a shipment in format
+func (c *Client) Label(shipmentID, format string) ([]byte, error) {
+	docType, ok := documentTypes[format]
+	if !ok {
+		return nil, carriers.Error("Label Format " + format + " Not Supported By Purolator")
+	}
+	documentsRequest := getDocumentsRequest{
+		DocumentCriteria:     []documentCriteria{{PIN: pin{shipmentID}, DocumentTypes: []string{docType[0]}}},
+		OutputType:           docType[1],
+		Synchronous:          true,
+		SynchronousSpecified: true,
+	}
+	var resp getDocumentsResponse
+	if err := c.call(documentsPath, actionGetDocuments, "1.3", documentsRequest, &resp); err != nil {
+		return nil, err
+	}
+	if err := resp.ResponseInformation.err(); err != nil {
+		return nil, err
+	}
+	for _, document := range resp.Documents {
+		for _, detail := range document.DocumentDetails {
+			if detail.DocumentStatus != "" && detail.DocumentStatus != "Completed" {
+				continue
+			}
+			if detail.Data != "" {
+				return base64.StdEncoding.DecodeString(detail.Data)
+			}
+			if detail.URL != "" {
+				return c.download(detail.URL)
+			}
+		}
+	}
+	return nil, carriers.Error("No Purolator Document For " + shipmentID)
+}
+
+// Void cancels a shipment that has not been picked up
+func (c *Client) Void(shipmentID string) error {
+	var resp voidShipmentResponse
+	if err := c.call(shippingPath, actionVoidShipment, "2.0", voidShipmentRequest{PIN: pin{shipmentID}}, &resp); err != nil {
+		return err
+	}
+	if err := resp.ResponseInformation.err(); err != nil {
+		return err
+	}
+	if !resp.ShipmentVoided {
+		return carriers.Error("Purolator Shipment " + shipmentID + " Not Voided")
+	}
+	return nil
+}
+
+// Track returns the scans of a shipment, newest first as purolator reports them
+func (c *Client) Track(trackingNumber string) ([]carriers.Event, error) {
+	var resp trackPackagesByPinResponse
+	if err := c.call(trackingPath, actionTrackPackagesByPin, "1.2", trackPackagesByPinRequest{PINs: []pin{{trackingNumber}}}, &resp); err != nil {
+		return nil, err
+	}
+	if err := resp.ResponseInformation.err(); err != nil {
+		return nil, err
+	}
+	var events []carriers.Event
+	for _, info := range resp.TrackingInformation {
+		for _, scan := range info.Scans {
+			occurredAt, err := scanTime(scan.ScanDate, scan.ScanTime)
+			if err != nil {
+				continue
+			}
+			description := strings.TrimSpace(scan.Description)
+			if scan.Comment != "" {
+				description += " " + strings.TrimSpace(scan.Comment)
+			}
+			events = append(events, carriers.Event{
+				Code:        scan.ScanType,
+				Description: description,
+				Location:    strings.TrimSpace(scan.Depot),
+				OccurredAt:  occurredAt,
+			})
+		}
+	}
+	return events, nil
+}
+
+// shipment builds the shipment the estimate and create requests share
+func (c *Client) shipment(req carriers.RateRequest, serviceCode, reference string) shipment {
+	weight := quantity{Value: formatFloat(req.Parcel.Weight), Unit: "kg"}
+	s := shipment{
+		Sender:   address(req.From),
+		Receiver: address(req.To),
+		Package: packageInformation{
+			ServiceID:   serviceCode,
+			TotalWeight: weight,
+			TotalPieces: 1,
+			Pieces: []piece{{
+				Weight: weight,
+				Length: dimension{Value: formatFloat(req.Parcel.Length), Unit: "cm"},
+				Width:  dimension{Value: formatFloat(req.Parcel.Width), Unit: "cm"},
+				Height: dimension{Value: formatFloat(req.Parcel.Height), Unit: "cm"},
+			}},
+		},
+		Payment: paymentInformation{
+			PaymentType:             "Sender",
+			RegisteredAccountNumber: c.Account,
+			BillingAccountNumber:    c.Account,
+		},
+		PickupType: "DropOff",
+	}
+	if reference != "" {
+		s.Reference = &trackingReference{Reference1: reference}
+	}
+	return s
+}
+
+// call posts a soap request to a purolator service and decodes the response body into out
+func (c *Client) call(path, action, version string, request, out interface{}) error {
+	env := envelope{
+		Header: header{RequestContext: requestContext{Version: version, Language: "en", RequestReference: "fromyama"}},
+		Body:   body{Content: request},
+	}
+	env.Header.RequestContext.XMLName = xml.Name{Space: namespaceV2, Local: "RequestContext"}
+	if version != "2.0" {
+		env.Header.RequestContext.XMLName.Space = namespaceV1
+	}
+	payload, err := xml.Marshal(env)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimRight(c.URL, "/")+path, bytes.NewBuffer(append([]byte(xml.Header), payload...)))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.Key, c.Password)
+	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	req.Header.Set("SOAPAction", `"`+action+`"`)
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var result responseEnvelope
+	if err = xml.Unmarshal(respBody, &result); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return carriers.Error("Purolator Request Failed With " + resp.Status)
+		}
+		return err
+	}
+	if result.Body.Fault != nil {
+		return carriers.Error("Purolator Fault, " + strings.TrimSpace(result.Body.Fault.String))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return carriers.Error("Purolator Request Failed With " + resp.Status)
+	}
+	return xml.Unmarshal(result.Body.Content, out)
+}
+
+// download fetches a document from the link purolator returned for it
+func (c *Client) download(url string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(c.Key, c.Password)
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, carriers.Error("Purolator Document Request Failed With " + resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (c *Client) httpClient() *http.Client {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = time.Second * 20
+	}
+	return &http.Client{Timeout: timeout}
+}
+
+// checkDomestic rejects shipments purolator can not be used for, only shipments within canada are supported
+func checkDomestic(req carriers.RateRequest) error {
+	if (req.From.Country != "" && req.From.Country != "CA") || (req.To.Country != "" && req.To.Country != "CA") {
+		return carriers.Error("Purolator Ships Within Canada Only")
+	}
+	return nil
+}
+
+// address converts an address to the purolator format which splits the street number and the phone number
+func address(a carriers.Address) purolatorAddress {
+	pa := purolatorAddress{
+		Name:       a.Name,
+		Company:    a.Company,
+		StreetName: a.Street,
+		Street2:    a.Street2,
+		City:       a.City,
+		Province:   a.Province,
+		Country:    a.Country,
+		PostalCode: strings.ReplaceAll(a.PostalCode, " ", ""),
+	}
+	if pa.Name == "" {
+		pa.Name = a.Company
+	}
+	if pa.Country == "" {
+		pa.Country = "CA"
+	}
+	if m := streetNumber.FindStringSubmatch(strings.TrimSpace(a.Street)); m != nil {
+		pa.StreetNumber, pa.StreetName = m[1], m[2]
+	}
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, a.Phone)
+	if len(digits) == 11 && digits[0] == '1' {
+		digits = digits[1:]
+	}
+	if len(digits) == 10 {
+		pa.Phone = &phoneNumber{CountryCode: "1", AreaCode: digits[:3], Phone: digits[3:]}
+	}
+	return pa
+}
+
+// scanTime parses the date and HHMMSS time of a scan, purolator reports them in eastern time
+func scanTime(date, clock string) (time.Time, error) {
+	location, err := time.LoadLocation("America/Toronto")
+	if err != nil {
+		location = time.FixedZone("EST", -5*3600)
+	}
+	clock = strings.ReplaceAll(clock, ":", "")
+	for len(clock) < 6 {
+		clock = "0" + clock
+	}
+	return time.ParseInLocation("2006-01-02 150405", date+" "+clock, location)
+}
+
+func serviceName(serviceID string) string {
+	if name, ok := services[serviceID]; ok {
+		return name
+	}
+	return serviceID
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,200 @@
+package purolator
+
+import (
+	"net/http"
+	"path"
+	"strings"
+	"testing"
+
+	"go.fromyama/utils/carriers"
+	"go.fromyama/utils/carriers/carriertest"
+)
+
+// recorded are the responses in testdata of each soap action and of label downloads
+var recorded = carriertest.Recorded{
+	Files: map[string]string{
+		"GetFullEstimate":    "GetFullEstimate.xml",
+		"CreateShipment":     "CreateShipment.xml",
+		"GetDocuments":       "GetDocuments.xml",
+		"VoidShipment":       "VoidShipment.xml",
+		"TrackPackagesByPin": "TrackPackagesByPin.xml",
+		"DocumentDownload":   "document.pdf",
+	},
+	Key: func(r *http.Request) string {
+		if strings.HasPrefix(r.URL.Path, "/PWS/DocumentDownload/") {
+			return "DocumentDownload"
+		}
+		return path.Base(strings.Trim(r.Header.Get("SOAPAction"), `"`))
+	},
+	Authorized: func(r *http.Request, body []byte) bool {
+		key, pass, ok := r.BasicAuth()
+		return ok && key == "key" && pass == "pass"
+	},
+}
+
+func testClient(url string) *Client {
+	return &Client{URL: url, Key: "key", Password: "pass", Account: "9999999999"}
+}
+
+var testRequest = carriers.RateRequest{
+	From:   carriers.Address{Company: "Yama Shop", Street: "123 Main St", City: "Toronto", Province: "ON", Country: "CA", PostalCode: "M5V 3L9", Phone: "(416) 555-0100"},
+	To:     carriers.Address{Name: "Jane Doe", Street: "4500 Rue Sherbrooke O", City: "Montreal", Province: "QC", Country: "CA", PostalCode: "H3Z 1E6"},
+	Parcel: carriers.Parcel{Length: 40, Width: 30, Height: 30, Weight: 3},
+}
+
+func TestRates(t *testing.T) {
+	requests := map[string]string{}
+	server := recorded.Server(t, nil, requests)
+	defer server.Close()
+
+	rates, err := testClient(server.URL).Rates(testRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rates) != 2 {
+		t.Fatalf("got %d rates, want 2", len(rates))
+	}
+	express := rates[0]
+	if express.ServiceCode != "PurolatorExpress" || express.ServiceName != "Purolator Express" || express.Total != 6098 ||
+		express.Base != 4120 || express.Taxes != 700 || len(express.Surcharges) != 2 || !express.Residential || express.TransitDays != 1 {
+		t.Errorf("got %+v", express)
+	}
+	// 40x30x30 cm is 6 kg dimensional, more than the 3 kg the parcel weighs
+	if express.DimensionalWeight != 6 || express.BillableWeight != 6 {
+		t.Errorf("got dimensional %v billable %v, want 6", express.DimensionalWeight, express.BillableWeight)
+	}
+
+	sent := requests["GetFullEstimate"]
+	for _, want := range []string{"<StreetNumber>123</StreetNumber>", "<StreetName>Main St</StreetName>", "<AreaCode>416</AreaCode>",
+		"<PostalCode>H3Z1E6</PostalCode>", "<BillingAccountNumber>9999999999</BillingAccountNumber>",
+		"<ShowAlternativeServicesIndicator>true</ShowAlternativeServicesIndicator>", `<RequestContext xmlns="http://purolator.com/pws/datatypes/v2">`} {
+		if !strings.Contains(sent, want) {
+			t.Errorf("estimate request is missing %s", want)
+		}
+	}
+}
+
+func TestRatesSingleService(t *testing.T) {
+	server := recorded.Server(t, nil, nil)
+	defer server.Close()
+
+	req := testRequest
+	req.ServiceCode = "PurolatorGround"
+	rates, err := testClient(server.URL).Rates(req)
+	if err != nil || len(rates) != 1 || rates[0].Total != 3015 {
+		t.Errorf("got %+v %v", rates, err)
+	}
+
+	req.ServiceCode = "PurolatorExpress9AM"
+	if _, err = testClient(server.URL).Rates(req); err == nil {
+		t.Errorf("service missing from the estimate should fail")
+	}
+}
+
+func TestRatesError(t *testing.T) {
+	server := recorded.Server(t, map[string]string{"GetFullEstimate": "error.xml"}, nil)
+	defer server.Close()
+
+	_, err := testClient(server.URL).Rates(testRequest)
+	if err == nil || !strings.Contains(err.Error(), "Invalid Receiver Postal Code") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestRatesInternational(t *testing.T) {
+	req := testRequest
+	req.To.Country = "US"
+	if _, err := testClient("http://127.0.0.1:0").Rates(req); err == nil {
+		t.Errorf("shipment outside canada should fail")
+	}
+}
+
+func TestShip(t *testing.T) {
+	requests := map[string]string{}
+	server := recorded.Server(t, nil, requests)
+	defer server.Close()
+
+	shipment, err := testClient(server.URL).Ship(carriers.ShipRequest{
+		RateRequest: withService(testRequest, "PurolatorGround"),
+		LabelFormat: carriers.FormatPDFLetter,
+		Reference:   "1001",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shipment.ShipmentID != "329022170193" || shipment.TrackingNumber != "329022170193" || string(shipment.Label) != "%PDF-1.4 label" {
+		t.Errorf("got %+v", shipment)
+	}
+	if !strings.Contains(requests["CreateShipment"], "<PrinterType>Regular</PrinterType>") ||
+		!strings.Contains(requests["CreateShipment"], "<Reference1>1001</Reference1>") {
+		t.Errorf("create request %s", requests["CreateShipment"])
+	}
+	if !strings.Contains(requests["GetDocuments"], "<DocumentType>DomesticBillOfLading</DocumentType>") {
+		t.Errorf("documents request %s", requests["GetDocuments"])
+	}
+}
+
+func TestShipVoidsWithoutLabel(t *testing.T) {
+	requests := map[string]string{}
+	server := recorded.Server(t, map[string]string{"GetDocuments": "error.xml"}, requests)
+	defer server.Close()
+
+	_, err := testClient(server.URL).Ship(carriers.ShipRequest{RateRequest: withService(testRequest, "PurolatorGround"), LabelFormat: carriers.FormatZPL})
+	if err == nil {
+		t.Fatal("ship without a label should fail")
+	}
+	if !strings.Contains(requests["VoidShipment"], "<Value>329022170193</Value>") {
+		t.Errorf("shipment without a label was not voided")
+	}
+}
+
+func TestVoid(t *testing.T) {
+	server := recorded.Server(t, nil, nil)
+	defer server.Close()
+	if err := testClient(server.URL).Void("329022170193"); err != nil {
+		t.Error(err)
+	}
+
+	faulty := recorded.Server(t, map[string]string{"VoidShipment": "fault.xml"}, nil)
+	defer faulty.Close()
+	err := testClient(faulty.URL).Void("329022170193")
+	if err == nil || !strings.Contains(err.Error(), "already been picked up") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestTrack(t *testing.T) {
+	server := recorded.Server(t, nil, nil)
+	defer server.Close()
+
+	events, err := testClient(server.URL).Track("329022170193")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3", len(events))
+	}
+	delivered := events[0]
+	if delivered.Code != "Delivery" || delivered.Description != "Shipment delivered to FRONT DOOR" || delivered.Location != "MONTREAL EAST" {
+		t.Errorf("got %+v", delivered)
+	}
+	if delivered.OccurredAt.Hour() != 14 || delivered.OccurredAt.Minute() != 23 || !delivered.OccurredAt.After(events[1].OccurredAt) {
+		t.Errorf("got time %v", delivered.OccurredAt)
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	server := recorded.Server(t, nil, nil)
+	defer server.Close()
+
+	client := testClient(server.URL)
+	client.Password = "wrong"
+	if _, err := client.Track("329022170193"); err == nil {
+		t.Errorf("bad credentials should fail")
+	}
+}
+
+func withService(req carriers.RateRequest, serviceCode string) carriers.RateRequest {
+	req.ServiceCode = serviceCode
+	return req
+}
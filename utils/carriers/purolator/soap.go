@@ -0,0 +1,227 @@
+package purolator
+
+import (
+	"encoding/xml"
+
+	"go.fromyama/utils/carriers"
+)
+
+type envelope struct {
+	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
+	Header  header   `xml:"http://schemas.xmlsoap.org/soap/envelope/ Header"`
+	Body    body     `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
+}
+
+type header struct {
+	RequestContext requestContext
+}
+
+type requestContext struct {
+	XMLName          xml.Name
+	Version          string
+	Language         string
+	GroupID          string
+	RequestReference string
+}
+
+type body struct {
+	Content interface{}
+}
+
+type responseEnvelope struct {
+	Body struct {
+		Fault   *fault `xml:"Fault"`
+		Content []byte `xml:",innerxml"`
+	} `xml:"Body"`
+}
+
+type fault struct {
+	Code   string `xml:"faultcode"`
+	String string `xml:"faultstring"`
+}
+
+type responseInformation struct {
+	Errors []responseError `xml:"Errors>Error"`
+}
+
+type responseError struct {
+	Code        string
+	Description string
+}
+
+// err returns the first error purolator reported
+func (r responseInformation) err() error {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+	return carriers.Error("Purolator Error " + r.Errors[0].Code + ", " + r.Errors[0].Description)
+}
+
+type pin struct {
+	Value string
+}
+
+type shipment struct {
+	Sender     purolatorAddress   `xml:"SenderInformation>Address"`
+	Receiver   purolatorAddress   `xml:"ReceiverInformation>Address"`
+	Package    packageInformation `xml:"PackageInformation"`
+	Payment    paymentInformation `xml:"PaymentInformation"`
+	PickupType string             `xml:"PickupInformation>PickupType"`
+	Reference  *trackingReference `xml:"TrackingReferenceInformation,omitempty"`
+}
+
+type purolatorAddress struct {
+	Name         string
+	Company      string `xml:",omitempty"`
+	StreetNumber string
+	StreetName   string
+	Street2      string `xml:"StreetAddress2,omitempty"`
+	City         string
+	Province     string
+	Country      string
+	PostalCode   string
+	Phone        *phoneNumber `xml:"PhoneNumber,omitempty"`
+}
+
+type phoneNumber struct {
+	CountryCode string
+	AreaCode    string
+	Phone       string
+}
+
+type packageInformation struct {
+	ServiceID   string
+	TotalWeight quantity
+	TotalPieces int
+	Pieces      []piece `xml:"PiecesInformation>Piece"`
+}
+
+type piece struct {
+	Weight quantity
+	Length dimension
+	Width  dimension
+	Height dimension
+}
+
+type quantity struct {
+	Value string
+	Unit  string `xml:"WeightUnit"`
+}
+
+type dimension struct {
+	Value string
+	Unit  string `xml:"DimensionUnit"`
+}
+
+type paymentInformation struct {
+	PaymentType             string
+	RegisteredAccountNumber string
+	BillingAccountNumber    string
+}
+
+type trackingReference struct {
+	Reference1 string
+}
+
+type getFullEstimateRequest struct {
+	XMLName                          xml.Name `xml:"http://purolator.com/pws/datatypes/v2 GetFullEstimateRequest"`
+	Shipment                         shipment
+	ShowAlternativeServicesIndicator bool
+}
+
+type getFullEstimateResponse struct {
+	ResponseInformation responseInformation
+	ShipmentEstimates   []shipmentEstimate `xml:"ShipmentEstimates>ShipmentEstimate"`
+}
+
+type shipmentEstimate struct {
+	ServiceID            string
+	ShipmentDate         string
+	ExpectedDeliveryDate string
+	EstimatedTransitDays int
+	BasePrice            float64
+	Surcharges           []charge `xml:"Surcharges>Surcharge"`
+	Taxes                []charge `xml:"Taxes>Tax"`
+	TotalPrice           float64
+}
+
+type charge struct {
+	Amount      float64
+	Type        string
+	Description string
+}
+
+type createShipmentRequest struct {
+	XMLName     xml.Name `xml:"http://purolator.com/pws/datatypes/v2 CreateShipmentRequest"`
+	Shipment    shipment
+	PrinterType string
+}
+
+type createShipmentResponse struct {
+	ResponseInformation responseInformation
+	ShipmentPIN         string `xml:"ShipmentPIN>Value"`
+}
+
+type voidShipmentRequest struct {
+	XMLName xml.Name `xml:"http://purolator.com/pws/datatypes/v2 VoidShipmentRequest"`
+	PIN     pin
+}
+
+type voidShipmentResponse struct {
+	ResponseInformation responseInformation
+	ShipmentVoided      bool
+}
+
+type getDocumentsRequest struct {
+	XMLName              xml.Name           `xml:"http://purolator.com/pws/datatypes/v1 GetDocumentsRequest"`
+	DocumentCriteria     []documentCriteria `xml:"DocumentCriterium>DocumentCriteria"`
+	OutputType           string
+	Synchronous          bool
+	SynchronousSpecified bool
+}
+
+type documentCriteria struct {
+	PIN           pin
+	DocumentTypes []string `xml:"DocumentTypes>DocumentType"`
+}
+
+type getDocumentsResponse struct {
+	ResponseInformation responseInformation
+	Documents           []document `xml:"Documents>Document"`
+}
+
+type document struct {
+	PIN             string           `xml:"PIN>Value"`
+	DocumentDetails []documentDetail `xml:"DocumentDetails>DocumentDetail"`
+}
+
+type documentDetail struct {
+	DocumentType   string
+	DocumentStatus string
+	URL            string
+	Data           string
+}
+
+type trackPackagesByPinRequest struct {
+	XMLName xml.Name `xml:"http://purolator.com/pws/datatypes/v1 TrackPackagesByPinRequest"`
+	PINs    []pin    `xml:"PINs>PIN"`
+}
+
+type trackPackagesByPinResponse struct {
+	ResponseInformation responseInformation
+	TrackingInformation []trackingInformation `xml:"TrackingInformationList>TrackingInformation"`
+}
+
+type trackingInformation struct {
+	PIN   string `xml:"PIN>Value"`
+	Scans []scan `xml:"Scans>Scan"`
+}
+
+type scan struct {
+	ScanType    string
+	ScanDate    string
+	ScanTime    string
+	Description string
+	Comment     string
+	Depot       string `xml:"Depot>Name"`
+}
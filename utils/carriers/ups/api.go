@@ -0,0 +1,322 @@
+package ups
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"go.fromyama/utils/carriers"
+)
+
+// decodeList decodes a ups field that holds an object when there is a single element and an array otherwise
+func decodeList(data []byte, v interface{}) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '{' {
+		data = append(append([]byte{'['}, data...), ']')
+	}
+	return json.Unmarshal(data, v)
+}
+
+type errorResponse struct {
+	Response struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	} `json:"response"`
+}
+
+type codeDescription struct {
+	Code        string `json:",omitempty"`
+	Description string `json:",omitempty"`
+}
+
+type money struct {
+	CurrencyCode  string `json:",omitempty"`
+	MonetaryValue string
+}
+
+func (m *money) cents() int64 {
+	if m == nil {
+		return 0
+	}
+	amount, _ := strconv.ParseFloat(m.MonetaryValue, 64)
+	return carriers.Cents(amount)
+}
+
+type upsAddress struct {
+	AddressLine                 []string
+	City                        string
+	StateProvinceCode           string `json:",omitempty"`
+	PostalCode                  string
+	CountryCode                 string
+	ResidentialAddressIndicator *string `json:",omitempty"`
+}
+
+type phone struct {
+	Number string
+}
+
+type upsParty struct {
+	Name          string
+	AttentionName string `json:",omitempty"`
+	ShipperNumber string `json:",omitempty"`
+	Phone         *phone `json:",omitempty"`
+	Address       upsAddress
+}
+
+type dimensions struct {
+	UnitOfMeasurement codeDescription
+	Length            string
+	Width             string
+	Height            string
+}
+
+type packageWeight struct {
+	UnitOfMeasurement codeDescription
+	Weight            string
+}
+
+type referenceNumber struct {
+	Value string
+}
+
+type upsPackage struct {
+	PackagingType   *codeDescription `json:",omitempty"`
+	Packaging       *codeDescription `json:",omitempty"`
+	Dimensions      dimensions
+	PackageWeight   packageWeight
+	ReferenceNumber *referenceNumber `json:",omitempty"`
+}
+
+type shipmentCharge struct {
+	Type        string
+	BillShipper struct {
+		AccountNumber string
+	}
+}
+
+type paymentDetails struct {
+	ShipmentCharge []shipmentCharge
+}
+
+type shipment struct {
+	Description           string `json:",omitempty"`
+	Shipper               upsParty
+	ShipTo                upsParty
+	ShipFrom              upsParty
+	PaymentDetails        *paymentDetails  `json:",omitempty"`
+	PaymentInformation    *paymentDetails  `json:",omitempty"`
+	Service               *codeDescription `json:",omitempty"`
+	Package               []upsPackage
+	InvoiceLineTotal      *money                                     `json:",omitempty"`
+	ShipmentRatingOptions *struct{ NegotiatedRatesIndicator string } `json:",omitempty"`
+}
+
+type request struct {
+	RequestOption string
+}
+
+type rateRequest struct {
+	RateRequest struct {
+		Request  request
+		Shipment shipment
+	}
+}
+
+type charge struct {
+	Code          string
+	Description   string
+	CurrencyCode  string
+	MonetaryValue string
+}
+
+type charges []charge
+
+func (l *charges) UnmarshalJSON(data []byte) error {
+	return decodeList(data, (*[]charge)(l))
+}
+
+type taxCharge struct {
+	Type          string
+	MonetaryValue string
+}
+
+type taxCharges []taxCharge
+
+func (l *taxCharges) UnmarshalJSON(data []byte) error {
+	return decodeList(data, (*[]taxCharge)(l))
+}
+
+// shipmentCharges are the totals ups reports for the published and the negotiated account rates
+type shipmentCharges struct {
+	ItemizedCharges       charges
+	TaxCharges            taxCharges
+	TotalCharges          *money
+	TotalCharge           *money
+	TotalChargesWithTaxes *money
+}
+
+// total returns the charge and the taxes on it, with taxes included in the charge
+func (c *shipmentCharges) total() (int64, int64) {
+	var taxes int64
+	for _, t := range c.TaxCharges {
+		amount, _ := strconv.ParseFloat(t.MonetaryValue, 64)
+		taxes += carriers.Cents(amount)
+	}
+	if c.TotalChargesWithTaxes != nil {
+		return c.TotalChargesWithTaxes.cents(), taxes
+	}
+	if c.TotalCharge != nil {
+		return c.TotalCharge.cents() + taxes, taxes
+	}
+	return c.TotalCharges.cents() + taxes, taxes
+}
+
+type ratedShipment struct {
+	Service       codeDescription
+	BillingWeight packageWeight
+	shipmentCharges
+	NegotiatedRateCharges *shipmentCharges
+	GuaranteedDelivery    *struct {
+		BusinessDaysInTransit string
+		DeliveryByTime        string
+	}
+}
+
+type ratedShipments []ratedShipment
+
+func (l *ratedShipments) UnmarshalJSON(data []byte) error {
+	return decodeList(data, (*[]ratedShipment)(l))
+}
+
+type rateResponse struct {
+	RateResponse struct {
+		RatedShipment ratedShipments
+	}
+}
+
+type labelSpecification struct {
+	LabelImageFormat codeDescription
+	LabelStockSize   *struct {
+		Height string
+		Width  string
+	} `json:",omitempty"`
+}
+
+type shipRequest struct {
+	ShipmentRequest struct {
+		Request            request
+		Shipment           shipment
+		LabelSpecification labelSpecification
+	}
+}
+
+type shippingLabel struct {
+	ImageFormat  codeDescription
+	GraphicImage string
+}
+
+type packageResult struct {
+	TrackingNumber string
+	ShippingLabel  shippingLabel
+}
+
+type packageResults []packageResult
+
+func (l *packageResults) UnmarshalJSON(data []byte) error {
+	return decodeList(data, (*[]packageResult)(l))
+}
+
+type shipResponse struct {
+	ShipmentResponse struct {
+		ShipmentResults struct {
+			ShipmentIdentificationNumber string
+			ShipmentCharges              *shipmentCharges
+			NegotiatedRateCharges        *shipmentCharges
+			PackageResults               packageResults
+		}
+	}
+}
+
+type labelRecoveryRequest struct {
+	LabelRecoveryRequest struct {
+		LabelSpecification labelSpecification
+		TrackingNumber     string
+	}
+}
+
+type labelResult struct {
+	TrackingNumber string
+	LabelImage     struct {
+		LabelImageFormat codeDescription
+		GraphicImage     string
+	}
+}
+
+type labelResults []labelResult
+
+func (l *labelResults) UnmarshalJSON(data []byte) error {
+	return decodeList(data, (*[]labelResult)(l))
+}
+
+type labelRecoveryResponse struct {
+	LabelRecoveryResponse struct {
+		LabelResults labelResults
+	}
+}
+
+type voidResponse struct {
+	VoidShipmentResponse struct {
+		SummaryResult struct {
+			Status codeDescription
+		}
+	}
+}
+
+type trackResponse struct {
+	TrackResponse struct {
+		Shipment []struct {
+			Package []struct {
+				TrackingNumber string     `json:"trackingNumber"`
+				Activity       []activity `json:"activity"`
+			} `json:"package"`
+			Warnings []struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"warnings"`
+		} `json:"shipment"`
+	} `json:"trackResponse"`
+}
+
+type activity struct {
+	Location struct {
+		Address struct {
+			City          string `json:"city"`
+			StateProvince string `json:"stateProvince"`
+			Country       string `json:"country"`
+		} `json:"address"`
+	} `json:"location"`
+	Status struct {
+		Type        string `json:"type"`
+		Description string `json:"description"`
+		Code        string `json:"code"`
+	} `json:"status"`
+	Date      string `json:"date"`
+	Time      string `json:"time"`
+	GMTDate   string `json:"gmtDate"`
+	GMTTime   string `json:"gmtTime"`
+	GMTOffset string `json:"gmtOffset"`
+}
+
+// location joins the parts of the activity location that are set
+func (a activity) location() string {
+	var parts []string
+	for _, part := range []string{a.Location.Address.City, a.Location.Address.StateProvince, a.Location.Address.Country} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,479 @@
+package ups
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.fromyama/utils/carriers"
+	"go.fromyama/utils/pdf"
+)
+
+// DevelopmentURL is the ups customer integration environment, UPS_URL points to https://onlinetools.ups.com in production
+const DevelopmentURL = "https://wwwcie.ups.com"
+
+const (
+	tokenPath    = "/security/v1/oauth/token"
+	ratePath     = "/api/rating/v2409/"
+	shipPath     = "/api/shipments/v2409/ship"
+	recoveryPath = "/api/labels/v1/recovery"
+	voidPath     = "/api/shipments/v2409/void/cancel/"
+	trackPath    = "/api/track/v1/details/"
+)
+
+// dimensionalDivisor is the cm3 per kg ups bills dimensional weight with
+const dimensionalDivisor = 5000.0
+
+// surcharge codes of the itemized charges on a rate
+const (
+	surchargeResidential = "270"
+	surchargeFuel        = "375"
+)
+
+// services are the ups services available from canada
+var services = map[string]string{
+	"01": "UPS Express",
+	"02": "UPS Expedited",
+	"07": "UPS Worldwide Express",
+	"08": "UPS Worldwide Expedited",
+	"11": "UPS Standard",
+	"12": "UPS 3 Day Select",
+	"13": "UPS Express Saver",
+	"14": "UPS Express Early",
+	"54": "UPS Worldwide Express Plus",
+	"65": "UPS Worldwide Saver",
+}
+
+var surcharges = map[string]string{
+	surchargeResidential: "Residential Surcharge",
+	surchargeFuel:        "Fuel Surcharge",
+	"376":                "Delivery Area Surcharge",
+	"100":                "Additional Handling",
+}
+
+// imageFormats are the label image ups is asked for in each label format, ups does not produce pdf labels so
+// pdf formats are built from the png image
+var imageFormats = map[string]string{
+	carriers.FormatPDFLetter: "PNG",
+	carriers.FormatPDF4x6:    "PNG",
+	carriers.FormatZPL:       "ZPL",
+}
+
+// Client is a ups account using the rest apis with the client credentials of an oauth app, Account is the
+// shipper number labels are bought on
+type Client struct {
+	URL     string
+	Account string
+	Timeout time.Duration
+
+	tokens *carriers.TokenSource
+}
+
+// New returns a client for the ups apis at url, clientID and clientSecret are the oauth app credentials
+func New(url, clientID, clientSecret, account string) *Client {
+	url = strings.TrimRight(url, "/")
+	return &Client{
+		URL:     url,
+		Account: account,
+		tokens:  &carriers.TokenSource{URL: url + tokenPath, ClientID: clientID, ClientSecret: clientSecret, BasicAuth: true},
+	}
+}
+
+// FromEnv returns the client configured with UPS_CLIENT_ID, UPS_CLIENT_SECRET, UPS_ACCOUNT and optionally UPS_URL,
+// nil is returned when ups is not configured
+func FromEnv() *Client {
+	if os.Getenv("UPS_CLIENT_ID") == "" {
+		return nil
+	}
+	url := os.Getenv("UPS_URL")
+	if url == "" {
+		url = DevelopmentURL
+	}
+	return New(url, os.Getenv("UPS_CLIENT_ID"), os.Getenv("UPS_CLIENT_SECRET"), os.Getenv("UPS_ACCOUNT"))
+}
+
+// Name returns the carrier name labels are stored with
+func (c *Client) Name() string {
+	return carriers.UPS
+}
+
+// LabelFormats returns the formats ups labels can be bought in
+func (c *Client) LabelFormats() map[string]bool {
+	formats := map[string]bool{}
+	for format := range imageFormats {
+		formats[format] = true
+	}
+	return formats
+}
+
+// Rates returns the rate of every service, or only req.ServiceCode when it is set, with the negotiated account
+// rate when the account has one
+func (c *Client) Rates(req carriers.RateRequest) ([]carriers.Rate, error) {
+	var rateReq rateRequest
+	rateReq.RateRequest.Request.RequestOption = "Shop"
+	rateReq.RateRequest.Shipment = c.shipment(req, "")
+	rateReq.RateRequest.Shipment.PaymentDetails = c.payment()
+	rateReq.RateRequest.Shipment.ShipmentRatingOptions = &struct{ NegotiatedRatesIndicator string }{}
+	rateReq.RateRequest.Shipment.Package[0].PackagingType = &codeDescription{Code: "02"}
+	if req.ServiceCode != "" {
+		rateReq.RateRequest.Request.RequestOption = "Rate"
+		rateReq.RateRequest.Shipment.Service = &codeDescription{Code: req.ServiceCode}
+	}
+	var resp rateResponse
+	if err := c.call("POST", ratePath+rateReq.RateRequest.Request.RequestOption, rateReq, &resp); err != nil {
+		return nil, err
+	}
+
+	dimensional := carriers.DimensionalWeight(req.Parcel, dimensionalDivisor)
+	var rates []carriers.Rate
+	for _, rated := range resp.RateResponse.RatedShipment {
+		if req.ServiceCode != "" && rated.Service.Code != req.ServiceCode {
+			continue
+		}
+		charges := &rated.shipmentCharges
+		if rated.NegotiatedRateCharges != nil {
+			charges = rated.NegotiatedRateCharges
+			if len(charges.ItemizedCharges) == 0 {
+				charges.ItemizedCharges = rated.ItemizedCharges
+			}
+		}
+		rate := carriers.Rate{
+			Carrier:           carriers.UPS,
+			ServiceCode:       rated.Service.Code,
+			ServiceName:       serviceName(rated.Service.Code),
+			BillableWeight:    carriers.BillableWeight(req.Parcel, dimensionalDivisor),
+			DimensionalWeight: dimensional,
+		}
+		rate.Total, rate.Taxes = charges.total()
+		var surchargeTotal int64
+		for _, s := range charges.ItemizedCharges {
+			amount, _ := strconv.ParseFloat(s.MonetaryValue, 64)
+			if amount == 0 {
+				continue
+			}
+			rate.Surcharges = append(rate.Surcharges, carriers.Surcharge{Code: s.Code, Name: surchargeName(s), Amount: carriers.Cents(amount)})
+			surchargeTotal += carriers.Cents(amount)
+			if s.Code == surchargeResidential {
+				rate.Residential = true
+			}
+		}
+		rate.Base = rate.Total - rate.Taxes - surchargeTotal
+		if billed, err := strconv.ParseFloat(rated.BillingWeight.Weight, 64); err == nil && billed > 0 {
+			if rated.BillingWeight.UnitOfMeasurement.Code == "LBS" {
+				billed = billed * 0.45359237
+			}
+			rate.BillableWeight = billed
+		}
+		if rated.GuaranteedDelivery != nil {
+			rate.TransitDays, _ = strconv.Atoi(rated.GuaranteedDelivery.BusinessDaysInTransit)
+		}
+		rates = append(rates, rate)
+	}
+	if req.ServiceCode != "" && len(rates) == 0 {
+		return nil, carriers.Error("No UPS Rate For Service " + req.ServiceCode)
+	}
+	return rates, nil
+}
+
+// Ship creates the shipment and returns it with its label and what ups charged for it
+func (c *Client) Ship(req carriers.ShipRequest) (carriers.Shipment, error) {
+	var shipment carriers.Shipment
+	imageFormat, ok := imageFormats[req.LabelFormat]
+	if !ok {
+		return shipment, carriers.Error("Label Format " + req.LabelFormat + " Not Supported By UPS")
+	}
+	if req.International() && (req.Contents == "" || req.Value <= 0) {
+		return shipment, carriers.Error("UPS Shipments Leaving " + req.From.Country + " Need Contents And Value")
+	}
+	var shipReq shipRequest
+	shipReq.ShipmentRequest.Request.RequestOption = "nonvalidate"
+	shipReq.ShipmentRequest.Shipment = c.shipment(req.RateRequest, req.Reference)
+	shipReq.ShipmentRequest.Shipment.PaymentInformation = c.payment()
+	shipReq.ShipmentRequest.Shipment.Service = &codeDescription{Code: req.ServiceCode}
+	shipReq.ShipmentRequest.Shipment.Package[0].Packaging = &codeDescription{Code: "02"}
+	shipReq.ShipmentRequest.LabelSpecification = labelSpec(imageFormat)
+	var resp shipResponse
+	if err := c.call("POST", shipPath, shipReq, &resp); err != nil {
+		return shipment, err
+	}
+	results := resp.ShipmentResponse.ShipmentResults
+	if results.ShipmentIdentificationNumber == "" || len(results.PackageResults) == 0 {
+		return shipment, carriers.Error("No UPS Shipment Identification Number")
+	}
+	shipment.ShipmentID = results.ShipmentIdentificationNumber
+	shipment.TrackingNumber = results.PackageResults[0].TrackingNumber
+	if results.NegotiatedRateCharges != nil {
+		shipment.Cost, _ = results.NegotiatedRateCharges.total()
+	} else if results.ShipmentCharges != nil {
+		shipment.Cost, _ = results.ShipmentCharges.total()
+	}
+
+	label, err := labelDocument(results.PackageResults[0].ShippingLabel.GraphicImage, req.LabelFormat)
+	if err != nil {
+		// the shipment exists without a usable label, void it so it is not billed
+		_ = c.Void(shipment.ShipmentID)
+		return shipment, err
+	}
+	shipment.Label = label
+	return shipment, nil
+}
+
+// Label recovers the label of a shipment in format, ups keeps labels for 120 days
+func (c *Client) Label(shipmentID, format string) ([]byte, error) {
+	imageFormat, ok := imageFormats[format]
+	if !ok {
+		return nil, carriers.Error("Label Format " + format + " Not Supported By UPS")
+	}
+	var recoveryReq labelRecoveryRequest
+	recoveryReq.LabelRecoveryRequest.LabelSpecification = labelSpec(imageFormat)
+	recoveryReq.LabelRecoveryRequest.TrackingNumber = shipmentID
+	var resp labelRecoveryResponse
+	if err := c.call("POST", recoveryPath, recoveryReq, &resp); err != nil {
+		return nil, err
+	}
+	for _, result := range resp.LabelRecoveryResponse.LabelResults {
+		if result.LabelImage.GraphicImage != "" {
+			return labelDocument(result.LabelImage.GraphicImage, format)
+		}
+	}
+	return nil, carriers.Error("No UPS Label For " + shipmentID)
+}
+
+// Void cancels a shipment that has not been picked up
+func (c *Client) Void(shipmentID string) error {
+	var resp voidResponse
+	if err := c.call("DELETE", voidPath+shipmentID, nil, &resp); err != nil {
+		return err
+	}
+	if resp.VoidShipmentResponse.SummaryResult.Status.Code != "1" {
+		return carriers.Error("UPS Shipment " + shipmentID + " Not Voided")
+	}
+	return nil
+}
+
+// Track returns the activity of a package, newest first as ups reports it
+func (c *Client) Track(trackingNumber string) ([]carriers.Event, error) {
+	var resp trackResponse
+	if err := c.call("GET", trackPath+trackingNumber, nil, &resp); err != nil {
+		return nil, err
+	}
+	var events []carriers.Event
+	for _, s := range resp.TrackResponse.Shipment {
+		if len(s.Warnings) > 0 && len(s.Package) == 0 {
+			return nil, carriers.Error("UPS Error " + s.Warnings[0].Code + ", " + s.Warnings[0].Message)
+		}
+		for _, p := range s.Package {
+			for _, a := range p.Activity {
+				occurredAt, err := activityTime(a)
+				if err != nil {
+					continue
+				}
+				events = append(events, carriers.Event{
+					Code:        a.Status.Code,
+					Description: strings.TrimSpace(a.Status.Description),
+					Location:    a.location(),
+					OccurredAt:  occurredAt,
+				})
+			}
+		}
+	}
+	return events, nil
+}
+
+// shipment builds the shipment the rate and ship requests share
+func (c *Client) shipment(req carriers.RateRequest, reference string) shipment {
+	shipper := party(req.From)
+	shipper.ShipperNumber = c.Account
+	s := shipment{
+		Shipper:  shipper,
+		ShipTo:   party(req.To),
+		ShipFrom: party(req.From),
+		Package: []upsPackage{{
+			Dimensions: dimensions{
+				UnitOfMeasurement: codeDescription{Code: "CM"},
+				Length:            formatFloat(req.Parcel.Length),
+				Width:             formatFloat(req.Parcel.Width),
+				Height:            formatFloat(req.Parcel.Height),
+			},
+			PackageWeight: packageWeight{UnitOfMeasurement: codeDescription{Code: "KGS"}, Weight: formatFloat(req.Parcel.Weight)},
+		}},
+	}
+	if req.To.Residential {
+		residential := ""
+		s.ShipTo.Address.ResidentialAddressIndicator = &residential
+	}
+	if reference != "" {
+		s.Package[0].ReferenceNumber = &referenceNumber{Value: reference}
+	}
+	if req.International() {
+		s.Description = req.Contents
+		s.InvoiceLineTotal = &money{CurrencyCode: "CAD", MonetaryValue: strconv.FormatFloat(float64(req.Value)/100.0, 'f', 2, 64)}
+	}
+	return s
+}
+
+// payment bills the shipment to the account
+func (c *Client) payment() *paymentDetails {
+	charge := shipmentCharge{Type: "01"}
+	charge.BillShipper.AccountNumber = c.Account
+	return &paymentDetails{ShipmentCharge: []shipmentCharge{charge}}
+}
+
+// call sends a json request to a ups api with the oauth token and decodes the response into out, the token
+// is fetched again once when ups rejects it
+func (c *Client) call(method, path string, request, out interface{}) error {
+	var payload []byte
+	if request != nil {
+		var err error
+		if payload, err = json.Marshal(request); err != nil {
+			return err
+		}
+	}
+	client := c.httpClient()
+	for attempt := 0; ; attempt++ {
+		token, err := c.tokens.Token(client)
+		if err != nil {
+			return carriers.Error("UPS Authorization Failed, " + err.Error())
+		}
+		var reqBody io.Reader
+		if payload != nil {
+			reqBody = bytes.NewReader(payload)
+		}
+		req, err := http.NewRequest(method, c.URL+path, reqBody)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("transId", strconv.FormatInt(time.Now().UnixNano(), 36))
+		req.Header.Set("transactionSrc", "fromyama")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		respBody, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			c.tokens.Reset()
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			var errResp errorResponse
+			if json.Unmarshal(respBody, &errResp) == nil && len(errResp.Response.Errors) > 0 {
+				return carriers.Error("UPS Error " + errResp.Response.Errors[0].Code + ", " + errResp.Response.Errors[0].Message)
+			}
+			return carriers.Error("UPS Request Failed With " + resp.Status)
+		}
+		return json.Unmarshal(respBody, out)
+	}
+}
+
+func (c *Client) httpClient() *http.Client {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = time.Second * 20
+	}
+	return &http.Client{Timeout: timeout}
+}
+
+// labelSpec asks for a 4x6 label in imageFormat
+func labelSpec(imageFormat string) labelSpecification {
+	spec := labelSpecification{LabelImageFormat: codeDescription{Code: imageFormat}}
+	if imageFormat != "PNG" {
+		spec.LabelStockSize = &struct {
+			Height string
+			Width  string
+		}{Height: "6", Width: "4"}
+	}
+	return spec
+}
+
+// labelDocument decodes a label image and builds the pdf of the wanted format from png labels
+func labelDocument(graphicImage, format string) ([]byte, error) {
+	image, err := base64.StdEncoding.DecodeString(graphicImage)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case carriers.FormatPDFLetter:
+		return pdf.FromImage(image, 8.5, 11, 6)
+	case carriers.FormatPDF4x6:
+		return pdf.FromImage(image, 4, 6, 6)
+	}
+	return image, nil
+}
+
+// party converts an address to a ups shipper or ship to
+func party(a carriers.Address) upsParty {
+	p := upsParty{
+		Name: a.Name,
+		Address: upsAddress{
+			AddressLine:       []string{a.Street},
+			City:              a.City,
+			StateProvinceCode: a.Province,
+			PostalCode:        strings.ReplaceAll(a.PostalCode, " ", ""),
+			CountryCode:       a.Country,
+		},
+	}
+	if a.Company != "" {
+		p.Name, p.AttentionName = a.Company, a.Name
+	}
+	if p.Name == "" {
+		p.Name = a.Company
+	}
+	if a.Street2 != "" {
+		p.Address.AddressLine = append(p.Address.AddressLine, a.Street2)
+	}
+	if p.Address.CountryCode == "" {
+		p.Address.CountryCode = "CA"
+	}
+	if a.Phone != "" {
+		p.Phone = &phone{Number: a.Phone}
+	}
+	return p
+}
+
+// activityTime returns when an activity happened, from the gmt time when ups reports it
+func activityTime(a activity) (time.Time, error) {
+	if a.GMTDate != "" && a.GMTTime != "" {
+		offset := a.GMTOffset
+		if offset == "" {
+			offset = "+00:00"
+		}
+		return time.Parse("20060102 15:04:05-07:00", a.GMTDate+" "+a.GMTTime+offset)
+	}
+	return time.Parse("20060102 150405", a.Date+" "+a.Time)
+}
+
+func serviceName(code string) string {
+	if name, ok := services[code]; ok {
+		return name
+	}
+	return "UPS " + code
+}
+
+func surchargeName(c charge) string {
+	if c.Description != "" {
+		return c.Description
+	}
+	if name, ok := surcharges[c.Code]; ok {
+		return name
+	}
+	return c.Code
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
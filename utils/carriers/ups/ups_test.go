@@ -0,0 +1,195 @@
+package ups
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.fromyama/utils/carriers"
+	"go.fromyama/utils/carriers/carriertest"
+)
+
+// recorded are the responses in testdata of each api path, the token needs the client credentials and everything
+// else the token
+var recorded = carriertest.Recorded{
+	Files: map[string]string{
+		tokenPath:                        "token.json",
+		ratePath + "Shop":                "rate_shop.json",
+		ratePath + "Rate":                "rate_shop.json",
+		shipPath:                         "ship.json",
+		recoveryPath:                     "recovery.json",
+		voidPath + "1ZA15Y436700000001":  "void.json",
+		trackPath + "1ZA15Y436700000001": "track.json",
+	},
+	Authorized: func(r *http.Request, body []byte) bool {
+		if r.URL.Path == tokenPath {
+			id, secret, ok := r.BasicAuth()
+			return ok && id == "id" && secret == "secret"
+		}
+		return r.Header.Get("Authorization") == "Bearer token"
+	},
+}
+
+func testClient(url string) *Client {
+	return New(url, "id", "secret", "A15Y43")
+}
+
+var testRequest = carriers.RateRequest{
+	From:   carriers.Address{Company: "Yama Shop", Street: "123 Main St", City: "Toronto", Province: "ON", Country: "CA", PostalCode: "M5V 3L9", Phone: "4165550100"},
+	To:     carriers.Address{Name: "Jane Doe", Street: "350 5th Ave", City: "New York", Province: "NY", Country: "US", PostalCode: "10118", Residential: true},
+	Parcel: carriers.Parcel{Length: 40, Width: 30, Height: 30, Weight: 3},
+}
+
+func TestRates(t *testing.T) {
+	requests := map[string]string{}
+	server := recorded.Server(t, nil, requests)
+	defer server.Close()
+
+	rates, err := testClient(server.URL).Rates(testRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rates) != 2 {
+		t.Fatalf("got %d rates, want 2", len(rates))
+	}
+	standard := rates[0]
+	if standard.ServiceCode != "11" || standard.ServiceName != "UPS Standard" || standard.Total != 3796 || standard.Taxes != 436 ||
+		standard.Base != 2410 || len(standard.Surcharges) != 2 || !standard.Residential || standard.TransitDays != 2 {
+		t.Errorf("got %+v", standard)
+	}
+	if standard.Surcharges[0].Name != "Residential Surcharge" || standard.Surcharges[0].Amount != 545 {
+		t.Errorf("got surcharge %+v", standard.Surcharges[0])
+	}
+	// 40x30x30 cm is 7.2 kg dimensional, ups bills 7.5 kg
+	if standard.DimensionalWeight != 7.2 || standard.BillableWeight != 7.5 {
+		t.Errorf("got dimensional %v billable %v", standard.DimensionalWeight, standard.BillableWeight)
+	}
+	// a single itemized charge is an object and the account has a negotiated rate
+	saver := rates[1]
+	if saver.Total != 5200 || saver.Residential || len(saver.Surcharges) != 1 || saver.Base != 4170 {
+		t.Errorf("got %+v", saver)
+	}
+
+	sent := requests[ratePath+"Shop"]
+	for _, want := range []string{`"ResidentialAddressIndicator":""`, `"ShipperNumber":"A15Y43"`, `"PostalCode":"M5V3L9"`,
+		`"InvoiceLineTotal"`, `"NegotiatedRatesIndicator":""`, `"Code":"KGS"`} {
+		if !strings.Contains(sent, want) {
+			t.Errorf("rate request is missing %s", want)
+		}
+	}
+}
+
+func TestRatesSingleService(t *testing.T) {
+	requests := map[string]string{}
+	server := recorded.Server(t, nil, requests)
+	defer server.Close()
+
+	req := testRequest
+	req.ServiceCode = "65"
+	rates, err := testClient(server.URL).Rates(req)
+	if err != nil || len(rates) != 1 || rates[0].ServiceCode != "65" {
+		t.Errorf("got %+v %v", rates, err)
+	}
+	if _, ok := requests[ratePath+"Rate"]; !ok {
+		t.Errorf("a single service should use the rate request option")
+	}
+}
+
+func TestRatesError(t *testing.T) {
+	server := recorded.Server(t, map[string]string{ratePath + "Shop": "rate_error.json"}, nil)
+	defer server.Close()
+
+	_, err := testClient(server.URL).Rates(testRequest)
+	if err == nil || !strings.Contains(err.Error(), "111285") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestShip(t *testing.T) {
+	requests := map[string]string{}
+	server := recorded.Server(t, nil, requests)
+	defer server.Close()
+
+	req := carriers.ShipRequest{RateRequest: testRequest, LabelFormat: carriers.FormatPDF4x6, Reference: "1001"}
+	req.ServiceCode = "11"
+	if _, err := testClient(server.URL).Ship(req); err == nil {
+		t.Errorf("shipment to the us without contents and value should fail")
+	}
+	req.Contents, req.Value = "T-shirts", 4500
+
+	shipment, err := testClient(server.URL).Ship(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shipment.ShipmentID != "1ZA15Y436700000001" || shipment.TrackingNumber != "1ZA15Y436700000001" || shipment.Cost != 3360 {
+		t.Errorf("got %+v", shipment)
+	}
+	if !bytes.HasPrefix(shipment.Label, []byte("%PDF")) {
+		t.Errorf("png label was not converted to pdf")
+	}
+	sent := requests[shipPath]
+	for _, want := range []string{`"Description":"T-shirts"`, `"MonetaryValue":"45.00"`, `"Value":"1001"`, `"Code":"PNG"`} {
+		if !strings.Contains(sent, want) {
+			t.Errorf("ship request is missing %s", want)
+		}
+	}
+}
+
+func TestLabel(t *testing.T) {
+	server := recorded.Server(t, nil, nil)
+	defer server.Close()
+
+	label, err := testClient(server.URL).Label("1ZA15Y436700000001", carriers.FormatZPL)
+	if err != nil || !bytes.HasPrefix(label, []byte("^XA")) {
+		t.Errorf("got %q %v", label, err)
+	}
+}
+
+func TestVoid(t *testing.T) {
+	server := recorded.Server(t, nil, nil)
+	defer server.Close()
+	if err := testClient(server.URL).Void("1ZA15Y436700000001"); err != nil {
+		t.Error(err)
+	}
+
+	expired := recorded.Server(t, map[string]string{voidPath + "1ZA15Y436700000001": "void_error.json"}, nil)
+	defer expired.Close()
+	err := testClient(expired.URL).Void("1ZA15Y436700000001")
+	if err == nil || !strings.Contains(err.Error(), "Void period has expired") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestTrack(t *testing.T) {
+	server := recorded.Server(t, nil, nil)
+	defer server.Close()
+
+	events, err := testClient(server.URL).Track("1ZA15Y436700000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3", len(events))
+	}
+	delivered := events[0]
+	if delivered.Code != "FS" || delivered.Description != "DELIVERED" || delivered.Location != "New York, NY, US" {
+		t.Errorf("got %+v", delivered)
+	}
+	if delivered.OccurredAt.UTC().Hour() != 19 || !delivered.OccurredAt.After(events[1].OccurredAt) {
+		t.Errorf("got time %v", delivered.OccurredAt)
+	}
+	if events[2].Location != "CA" || events[2].OccurredAt.Day() != 3 {
+		t.Errorf("got %+v", events[2])
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	server := recorded.Server(t, nil, nil)
+	defer server.Close()
+
+	client := New(server.URL, "id", "wrong", "A15Y43")
+	if _, err := client.Track("1ZA15Y436700000001"); err == nil {
+		t.Errorf("bad credentials should fail")
+	}
+}
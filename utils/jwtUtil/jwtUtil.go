@@ -1,8 +1,11 @@
 package jwtUtil
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"log"
-	"os"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -13,22 +16,77 @@ type TokenClaims struct {
 	UserID string
 	CompanyID string
 	Approved bool
+	SessionID string
+	Role string
+	// TwoFactorSetupRequired is set when the company requires two factor authentication of the role and the user has
+	// not set it up, the token only works on the routes to set it up
+	TwoFactorSetupRequired bool
 }
 
+// AccessTokenLifetime is how long a signed token is valid, clients use their refresh token for a new one after it
+const AccessTokenLifetime = time.Minute*15
+
+// RefreshTokenLifetime is how long an unused refresh token is valid, every refresh starts it again
+const RefreshTokenLifetime = time.Hour*24*30
+
+// Issuer and Audience are the iss and aud of every token, tokens for anything else are rejected
+const (
+	Issuer = "go.fromyama"
+	Audience = "go.fromyama/api"
+)
+
+// signedClaims are the claims a token carries, sub is the user id
+type signedClaims struct {
+	Email string `json:"email"`
+	CompanyID string `json:"company_id"`
+	Approved bool `json:"approved"`
+	SessionID string `json:"session_id,omitempty"`
+	Role string `json:"role,omitempty"`
+	TwoFactorSetupRequired bool `json:"two_factor_setup_required,omitempty"`
+	jwt.StandardClaims
+}
+
+// Purposes of single purpose tokens, each is signed for its own audience so it is never accepted as a token for
+// another purpose or for the api
+const (
+	PurposeInvitation = "invitation"
+	PurposePasswordReset = "password_reset"
+	PurposeEmailVerification = "email_verification"
+	PurposeTwoFactor = "two_factor"
+)
+
 type invalidTokenError struct {}
 func (e *invalidTokenError) Error() string{
 	return "Invalid Token"
 }
 
+// GenerateToken signs the claims of user with the signing key, the token names the key in its kid header and
+// expires after AccessTokenLifetime
 func GenerateToken(user TokenClaims) (string, error){
-	token := jwt.New(jwt.SigningMethodHS256)
-	claims := token.Claims.(jwt.MapClaims)
-	claims["email"] = user.Email
-	claims["user_id"] = user.UserID
-	claims["company_id"] = user.CompanyID
-	claims["approved"] = user.Approved
-	claims["expiration"] = time.Now().Add(time.Hour*2).Unix()
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	if keys == nil {
+		if err := LoadKeys(); err != nil {
+			log.Print("Token Generation Error, " + err.Error())
+			return "", err
+		}
+	}
+	now := time.Now()
+	token := jwt.NewWithClaims(keys.signing.Method, signedClaims{
+		Email: user.Email,
+		CompanyID: user.CompanyID,
+		Approved: user.Approved,
+		SessionID: user.SessionID,
+		Role: user.Role,
+		TwoFactorSetupRequired: user.TwoFactorSetupRequired,
+		StandardClaims: jwt.StandardClaims{
+			Subject: user.UserID,
+			Issuer: Issuer,
+			Audience: Audience,
+			IssuedAt: now.Unix(),
+			ExpiresAt: now.Add(AccessTokenLifetime).Unix(),
+		},
+	})
+	token.Header["kid"] = keys.signing.ID
+	tokenString, err := token.SignedString(keys.signing.SignKey)
 	if err != nil {
 		log.Print("Token Generation Error")
 		return "", err
@@ -36,17 +94,89 @@ func GenerateToken(user TokenClaims) (string, error){
 	return tokenString, nil
 }
 
+// CheckAndParseToken returns the claims of a token signed with a listed key and the algorithm of that key, that
+// has not expired, was issued by and for this api and names a user and company
 func CheckAndParseToken(tokenString string) (*TokenClaims, error){
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("JWT_SECRET")), nil
+	if keys == nil {
+		if err := LoadKeys(); err != nil {
+			return nil, err
+		}
+	}
+	claims := &signedClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, keys.lookup)
+	if err != nil || !token.Valid {
+		return nil, &invalidTokenError{}
+	}
+	// jwt-go only checks exp, iss and aud when they are present
+	now := time.Now().Unix()
+	if !claims.VerifyExpiresAt(now, true) || !claims.VerifyIssuer(Issuer, true) || !claims.VerifyAudience(Audience, true) ||
+		claims.Subject == "" || claims.CompanyID == "" {
+		return nil, &invalidTokenError{}
+	}
+	return &TokenClaims{
+		Email: claims.Email,
+		UserID: claims.Subject,
+		CompanyID: claims.CompanyID,
+		Approved: claims.Approved,
+		SessionID: claims.SessionID,
+		Role: claims.Role,
+		TwoFactorSetupRequired: claims.TwoFactorSetupRequired,
+	}, nil
+}
+
+// GeneratePurposeToken signs a token for one purpose about subject, nonce is kept by the caller so it can check
+// the token is the latest one issued and can stop it from being used again
+func GeneratePurposeToken(purpose, subject, nonce string, lifetime time.Duration) (string, error){
+	if keys == nil {
+		if err := LoadKeys(); err != nil {
+			return "", err
+		}
+	}
+	now := time.Now()
+	token := jwt.NewWithClaims(keys.signing.Method, jwt.StandardClaims{
+		Id: nonce,
+		Subject: subject,
+		Issuer: Issuer,
+		Audience: Audience + "/" + purpose,
+		IssuedAt: now.Unix(),
+		ExpiresAt: now.Add(lifetime).Unix(),
 	})
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid && err == nil{
-		return &TokenClaims{
-			Email: claims["email"].(string),
-			UserID: claims["user_id"].(string),
-			CompanyID: claims["company_id"].(string),
-			Approved: claims["approved"].(bool),
-		}, nil
-	}
-	return nil, &invalidTokenError{}
-}
\ No newline at end of file
+	token.Header["kid"] = keys.signing.ID
+	return token.SignedString(keys.signing.SignKey)
+}
+
+// CheckPurposeToken returns the subject and nonce of a token signed for purpose that has not expired
+func CheckPurposeToken(tokenString, purpose string) (string, string, error){
+	if keys == nil {
+		if err := LoadKeys(); err != nil {
+			return "", "", err
+		}
+	}
+	claims := &jwt.StandardClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, keys.lookup)
+	if err != nil || !token.Valid {
+		return "", "", &invalidTokenError{}
+	}
+	now := time.Now().Unix()
+	if !claims.VerifyExpiresAt(now, true) || !claims.VerifyIssuer(Issuer, true) || !claims.VerifyAudience(Audience + "/" + purpose, true) ||
+		claims.Subject == "" {
+		return "", "", &invalidTokenError{}
+	}
+	return claims.Subject, claims.Id, nil
+}
+
+// NewRefreshToken returns a random opaque refresh token and the hash it is stored and looked up by
+func NewRefreshToken() (string, string, error){
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken returns the hex sha256 of a refresh token, the token itself is never stored
+func HashRefreshToken(token string) string{
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
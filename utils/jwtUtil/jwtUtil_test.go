@@ -0,0 +1,163 @@
+package jwtUtil
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var testClaims = TokenClaims{Email: "a@fromyama.com", UserID: "1", CompanyID: "2", Approved: true, SessionID: "3", Role: "admin", TwoFactorSetupRequired: true}
+
+var testSeed = base64.StdEncoding.EncodeToString(make([]byte, ed25519.SeedSize))
+
+func useKeys(t *testing.T, config, signingID string) {
+	set, err := parseKeys(config, signingID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys = set
+}
+
+func TestTokenRoundTrip(t *testing.T) {
+	for _, config := range []string{"k1:HS256:test-secret", "k2:EdDSA:" + testSeed} {
+		useKeys(t, config, "")
+		token, err := GenerateToken(testClaims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := CheckAndParseToken(token)
+		if err != nil {
+			t.Fatalf("%s: %v", config, err)
+		}
+		if *parsed != testClaims {
+			t.Errorf("got %+v, want %+v", *parsed, testClaims)
+		}
+	}
+}
+
+func TestLoadKeysFallsBackToSecret(t *testing.T) {
+	os.Setenv("JWT_KEYS", "")
+	os.Setenv("JWT_SECRET", "test-secret")
+	if err := LoadKeys(); err != nil {
+		t.Fatal(err)
+	}
+	if keys.signing.ID != "default" || keys.signing.Method != jwt.SigningMethodHS256 {
+		t.Errorf("signing key %+v", keys.signing)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	useKeys(t, "old:HS256:old-secret", "")
+	old, _ := GenerateToken(testClaims)
+	useKeys(t, "new:EdDSA:"+testSeed+", old:HS256:old-secret", "")
+	if _, err := CheckAndParseToken(old); err != nil {
+		t.Errorf("token of a listed key rejected: %v", err)
+	}
+	token, _ := GenerateToken(testClaims)
+	if header := strings.Split(token, ".")[0]; header != jwt.EncodeSegment([]byte(`{"alg":"EdDSA","kid":"new","typ":"JWT"}`)) {
+		t.Errorf("token not signed with the new key")
+	}
+	useKeys(t, "new:EdDSA:"+testSeed, "")
+	if _, err := CheckAndParseToken(old); err == nil {
+		t.Error("token of a removed key accepted")
+	}
+}
+
+func TestRejectedTokens(t *testing.T) {
+	useKeys(t, "hs:HS256:test-secret,ed:EdDSA:"+testSeed, "hs")
+	valid := signedClaims{Email: "a@fromyama.com", CompanyID: "2", StandardClaims: jwt.StandardClaims{
+		Subject: "1", Issuer: Issuer, Audience: Audience, IssuedAt: time.Now().Unix(), ExpiresAt: time.Now().Add(time.Minute).Unix()}}
+	sign := func(method jwt.SigningMethod, kid string, claims jwt.Claims, k interface{}) string {
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		s, err := token.SignedString(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	expired, wrongAudience, noSubject := valid, valid, valid
+	expired.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+	wrongAudience.Audience = "someone-else"
+	noSubject.Subject = ""
+	noExpiry := valid
+	noExpiry.ExpiresAt = 0
+	cases := map[string]string{
+		"expired":         sign(jwt.SigningMethodHS256, "hs", expired, []byte("test-secret")),
+		"no expiry":       sign(jwt.SigningMethodHS256, "hs", noExpiry, []byte("test-secret")),
+		"wrong audience":  sign(jwt.SigningMethodHS256, "hs", wrongAudience, []byte("test-secret")),
+		"no subject":      sign(jwt.SigningMethodHS256, "hs", noSubject, []byte("test-secret")),
+		"no kid":          sign(jwt.SigningMethodHS256, "", valid, []byte("test-secret")),
+		"unknown kid":     sign(jwt.SigningMethodHS256, "other", valid, []byte("test-secret")),
+		"wrong algorithm": sign(jwt.SigningMethodHS256, "ed", valid, []byte("test-secret")),
+		"none":            sign(jwt.SigningMethodNone, "hs", valid, jwt.UnsafeAllowNoneSignatureType),
+		"legacy claims":   sign(jwt.SigningMethodHS256, "hs", jwt.MapClaims{"expiration": time.Now().Unix()}, []byte("test-secret")),
+		"malformed":       "not.a.token",
+	}
+	for name, token := range cases {
+		if _, err := CheckAndParseToken(token); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+	if _, err := CheckAndParseToken(sign(jwt.SigningMethodHS256, "hs", valid, []byte("test-secret"))); err != nil {
+		t.Errorf("valid token rejected: %v", err)
+	}
+}
+
+func TestParseKeysErrors(t *testing.T) {
+	for _, config := range []string{"k1:HS256", "k1:RS256:key", "k1:EdDSA:short", "k1:HS256:a,k1:HS256:b", ":HS256:key"} {
+		if _, err := parseKeys(config, ""); err == nil {
+			t.Errorf("%q: want an error", config)
+		}
+	}
+	if _, err := parseKeys("k1:HS256:a", "k2"); err == nil {
+		t.Error("unlisted signing key accepted")
+	}
+}
+
+func TestNewRefreshToken(t *testing.T) {
+	token, hash, err := NewRefreshToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != HashRefreshToken(token) || hash == token || len(hash) != 64 {
+		t.Errorf("hash %q does not match token %q", hash, token)
+	}
+	other, _, _ := NewRefreshToken()
+	if other == token {
+		t.Error("refresh tokens repeat")
+	}
+}
+
+func TestPurposeTokens(t *testing.T) {
+	useKeys(t, "k1:HS256:test-secret", "")
+	token, err := GeneratePurposeToken(PurposeInvitation, "invite-1", "nonce-1", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, nonce, err := CheckPurposeToken(token, PurposeInvitation)
+	if err != nil || subject != "invite-1" || nonce != "nonce-1" {
+		t.Errorf("got %q, %q, %v", subject, nonce, err)
+	}
+	if _, _, err = CheckPurposeToken(token, "password_reset"); err == nil {
+		t.Error("token accepted for another purpose")
+	}
+	if _, err = CheckAndParseToken(token); err == nil {
+		t.Error("purpose token accepted as an access token")
+	}
+	access, _ := GenerateToken(testClaims)
+	if _, _, err = CheckPurposeToken(access, PurposeInvitation); err == nil {
+		t.Error("access token accepted as a purpose token")
+	}
+	expired, _ := GeneratePurposeToken(PurposeInvitation, "invite-1", "nonce-1", -time.Minute)
+	if _, _, err = CheckPurposeToken(expired, PurposeInvitation); err == nil {
+		t.Error("expired token accepted")
+	}
+}
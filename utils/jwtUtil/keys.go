@@ -0,0 +1,146 @@
+package jwtUtil
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"os"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// SigningMethodEdDSA signs tokens with an Ed25519 key, jwt-go has no method for it
+var SigningMethodEdDSA = &signingMethodEd25519{}
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+// key is one entry of the key set, tokens name it in their kid header and must use its algorithm
+type key struct {
+	ID string
+	Method jwt.SigningMethod
+	SignKey interface{}
+	VerifyKey interface{}
+}
+
+// keySet holds every key tokens are accepted with and the one new tokens are signed with
+type keySet struct {
+	keys map[string]key
+	signing key
+}
+
+var keys *keySet
+
+type keyError struct {
+	s string
+}
+func (e *keyError) Error() string{
+	return e.s
+}
+
+// LoadKeys reads the signing keys from JWT_KEYS, a comma separated list of kid:alg:key where alg is HS256 with the
+// secret as key or EdDSA with the base64 Ed25519 seed as key, new tokens are signed with the JWT_SIGNING_KEY kid or
+// else the first key, and tokens signed with any listed key stay valid so a secret is rotated by listing the new key
+// first and removing the old one once its tokens have expired. Without JWT_KEYS the JWT_SECRET is the only key
+func LoadKeys() error{
+	config := os.Getenv("JWT_KEYS")
+	if config == "" {
+		if os.Getenv("JWT_SECRET") == "" {
+			return &keyError{"JWT_KEYS Or JWT_SECRET Missing"}
+		}
+		config = "default:HS256:" + os.Getenv("JWT_SECRET")
+	}
+	set, err := parseKeys(config, os.Getenv("JWT_SIGNING_KEY"))
+	if err != nil {
+		return err
+	}
+	keys = set
+	return nil
+}
+
+func parseKeys(config, signingID string) (*keySet, error){
+	set := &keySet{keys: map[string]key{}}
+	var first string
+	for _, entry := range strings.Split(config, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+			return nil, &keyError{"JWT Key Must Be kid:alg:key"}
+		}
+		if _, ok := set.keys[parts[0]]; ok {
+			return nil, &keyError{"JWT Key " + parts[0] + " Listed Twice"}
+		}
+		k := key{ID: parts[0]}
+		switch parts[1] {
+		case jwt.SigningMethodHS256.Alg():
+			k.Method, k.SignKey, k.VerifyKey = jwt.SigningMethodHS256, []byte(parts[2]), []byte(parts[2])
+		case SigningMethodEdDSA.Alg():
+			seed, err := base64.StdEncoding.DecodeString(parts[2])
+			if err != nil || len(seed) != ed25519.SeedSize {
+				return nil, &keyError{"JWT Key " + parts[0] + " Must Be A Base64 Ed25519 Seed"}
+			}
+			private := ed25519.NewKeyFromSeed(seed)
+			k.Method, k.SignKey, k.VerifyKey = SigningMethodEdDSA, private, private.Public()
+		default:
+			return nil, &keyError{"JWT Key Algorithm " + parts[1] + " Not Supported"}
+		}
+		set.keys[k.ID] = k
+		if first == "" {
+			first = k.ID
+		}
+	}
+	if signingID == "" {
+		signingID = first
+	}
+	signing, ok := set.keys[signingID]
+	if !ok {
+		return nil, &keyError{"JWT Signing Key " + signingID + " Not Listed"}
+	}
+	set.signing = signing
+	return set, nil
+}
+
+// lookup is the jwt.Keyfunc of the set, the token must name a listed key and use its algorithm so a token can not
+// pick a weaker algorithm or have an Ed25519 public key used as an HMAC secret
+func (s *keySet) lookup(token *jwt.Token) (interface{}, error){
+	kid, _ := token.Header["kid"].(string)
+	k, ok := s.keys[kid]
+	if !ok {
+		return nil, &keyError{"Unknown Key"}
+	}
+	if token.Method == nil || token.Method.Alg() != k.Method.Alg() {
+		return nil, &keyError{"Unexpected Signing Method"}
+	}
+	return k.VerifyKey, nil
+}
+
+type signingMethodEd25519 struct {}
+
+func (m *signingMethodEd25519) Alg() string{
+	return "EdDSA"
+}
+
+func (m *signingMethodEd25519) Sign(signingString string, k interface{}) (string, error){
+	private, ok := k.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	return jwt.EncodeSegment(ed25519.Sign(private, []byte(signingString))), nil
+}
+
+func (m *signingMethodEd25519) Verify(signingString, signature string, k interface{}) error{
+	public, ok := k.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(public, []byte(signingString), sig) {
+		return jwt.ErrSignatureInvalid
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.fromyama/utils/address"
+	"go.fromyama/utils/response"
+)
+
+// ValidateOrderAddresses normalizes the shipping address of every order with address.Provider and records the
+// issues found, orders are still returned when the provider fails so an outage does not hide them
+func ValidateOrderAddresses (orders *response.Orders) {
+	for i := range orders.Orders {
+		shipping := &orders.Orders[i].ShippingAddress
+		street2 := ""
+		if shipping.Address2 != nil {
+			street2 = fmt.Sprint(shipping.Address2)
+		}
+		result, err := address.Provider.Validate(address.Address{
+			Name: shipping.Name,
+			Street: shipping.Address1,
+			Street2: street2,
+			City: shipping.City,
+			Province: shipping.Province,
+			Country: shipping.Country,
+			PostalCode: shipping.PostalCode,
+		})
+		if err != nil {
+			orders.Orders[i].AddressIssues = []address.Issue{{Field: "address", Message: "Address Validation Unavailable"}}
+			continue
+		}
+		shipping.Address1 = result.Address.Street
+		shipping.City = result.Address.City
+		shipping.Province = result.Address.Province
+		shipping.Country = result.Address.Country
+		shipping.PostalCode = result.Address.PostalCode
+		orders.Orders[i].AddressValid = result.Valid
+		orders.Orders[i].AddressIssues = result.Issues
+	}
+}
+
+// PickList consolidates the items of orders into one line per sku with the total quantity and the orders that
+// need it, items without a sku are grouped by title, lines are sorted by sku
+func PickList (orders []response.Order) []response.PickListLine {
+	lines := map[string]*response.PickListLine{}
+	var keys []string
+	for _, order := range orders {
+		orderName := order.Name
+		if orderName == "" {
+			orderName = order.OrderID
+		}
+		for _, item := range order.Items {
+			key := strings.TrimSpace(item.Sku)
+			if key == "" {
+				key = "~" + strings.TrimSpace(item.Title)
+			}
+			line, ok := lines[key]
+			if !ok {
+				line = &response.PickListLine{Sku: strings.TrimSpace(item.Sku), Title: item.Title}
+				lines[key] = line
+				keys = append(keys, key)
+			}
+			quantity, err := strconv.Atoi(item.Quantity)
+			if err != nil || quantity < 1 {
+				quantity = 1
+			}
+			line.Quantity += quantity
+			if len(line.Orders) == 0 || line.Orders[len(line.Orders)-1] != orderName {
+				line.Orders = append(line.Orders, orderName)
+			}
+		}
+	}
+	sort.Strings(keys)
+	pickList := make([]response.PickListLine, 0, len(keys))
+	for _, key := range keys {
+		pickList = append(pickList, *lines[key])
+	}
+	return pickList
+}
@@ -0,0 +1,281 @@
+package packing
+
+import (
+	"math"
+	"sort"
+)
+
+// MaxUnits is the most units packed in one request
+const MaxUnits = 500
+
+// epsilon absorbs float rounding when comparing dimensions in cm
+const epsilon = 1e-9
+
+// Item is a sku to pack, dimensions in cm and weight in kg of a single unit
+type Item struct {
+	SKU      string
+	Length   float64
+	Width    float64
+	Height   float64
+	Weight   float64
+	Quantity int
+}
+
+// Box is a parcel items can be packed in, dimensions are the inside of the box in cm, EmptyWeight is the weight
+// of the box itself and MaxWeight, when set, is the most the packed box may weigh, both in kg
+type Box struct {
+	ID          string
+	Name        string
+	Length      float64
+	Width       float64
+	Height      float64
+	EmptyWeight float64
+	MaxWeight   float64
+}
+
+func (b Box) volume() float64 {
+	return b.Length * b.Width * b.Height
+}
+
+// Placement is a unit of a sku placed in a box, X, Y and Z are the corner closest to the origin of the box and
+// Length, Width and Height the unit dimensions in the orientation it was placed in
+type Placement struct {
+	SKU    string
+	X      float64
+	Y      float64
+	Z      float64
+	Length float64
+	Width  float64
+	Height float64
+}
+
+// Package is a box with the units packed in it, Weight includes the empty box
+type Package struct {
+	Box         Box
+	Placements  []Placement
+	Weight      float64
+	Utilization float64
+}
+
+// Quantities returns the number of units of each sku in the package
+func (p Package) Quantities() map[string]int {
+	quantities := map[string]int{}
+	for _, placement := range p.Placements {
+		quantities[placement.SKU]++
+	}
+	return quantities
+}
+
+type packingError struct {
+	s string
+}
+
+func (e *packingError) Error() string {
+	return e.s
+}
+
+type unit struct {
+	sku    string
+	dims   [3]float64
+	weight float64
+}
+
+func (u unit) volume() float64 {
+	return u.dims[0] * u.dims[1] * u.dims[2]
+}
+
+type point struct {
+	x, y, z float64
+}
+
+// Pack chooses the boxes items ship in, the smallest box that holds every unit when there is one, otherwise the
+// box that holds the most of what is left is filled until every unit is packed. Units are placed largest first
+// at the extreme points of the units already in the box, trying every orientation
+func Pack(items []Item, boxes []Box) ([]Package, error) {
+	if len(boxes) == 0 {
+		return nil, &packingError{"No Parcels To Pack In"}
+	}
+	var units []unit
+	for _, item := range items {
+		if item.Length <= 0 || item.Width <= 0 || item.Height <= 0 || item.Weight < 0 {
+			return nil, &packingError{"Item " + item.SKU + " Needs Dimensions"}
+		}
+		quantity := item.Quantity
+		if quantity < 1 {
+			quantity = 1
+		}
+		if len(units)+quantity > MaxUnits {
+			return nil, &packingError{"Too Many Units To Pack"}
+		}
+		for i := 0; i < quantity; i++ {
+			units = append(units, unit{sku: item.SKU, dims: [3]float64{item.Length, item.Width, item.Height}, weight: item.Weight})
+		}
+	}
+	if len(units) == 0 {
+		return nil, &packingError{"No Items To Pack"}
+	}
+
+	sorted := append([]Box(nil), boxes...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].volume() < sorted[j].volume()
+	})
+	sort.SliceStable(units, func(i, j int) bool {
+		if units[i].volume() != units[j].volume() {
+			return units[i].volume() > units[j].volume()
+		}
+		return longest(units[i]) > longest(units[j])
+	})
+	for _, u := range units {
+		fits := false
+		for _, box := range sorted {
+			if _, ok := packBox(box, []unit{u}); ok {
+				fits = true
+				break
+			}
+		}
+		if !fits {
+			return nil, &packingError{"Item " + u.sku + " Does Not Fit In Any Parcel"}
+		}
+	}
+
+	var packages []Package
+	for len(units) > 0 {
+		var best Package
+		var bestPacked []bool
+		bestVolume := -1.0
+		for _, box := range sorted {
+			pkg, packed := packBoxPartial(box, units)
+			if len(pkg.Placements) == len(units) {
+				best, bestPacked = pkg, packed
+				break
+			}
+			if volume := packedVolume(pkg); volume > bestVolume+epsilon {
+				best, bestPacked, bestVolume = pkg, packed, volume
+			}
+		}
+		packages = append(packages, best)
+		var remaining []unit
+		for i, u := range units {
+			if !bestPacked[i] {
+				remaining = append(remaining, u)
+			}
+		}
+		units = remaining
+	}
+	return packages, nil
+}
+
+// packBox places every unit in box, ok is false when one of them does not fit
+func packBox(box Box, units []unit) (Package, bool) {
+	pkg, packed := packBoxPartial(box, units)
+	for _, p := range packed {
+		if !p {
+			return pkg, false
+		}
+	}
+	return pkg, true
+}
+
+// packBoxPartial places as many units as fit in box in order and reports which were packed
+func packBoxPartial(box Box, units []unit) (Package, []bool) {
+	pkg := Package{Box: box, Weight: box.EmptyWeight}
+	packed := make([]bool, len(units))
+	points := []point{{0, 0, 0}}
+	for i, u := range units {
+		if box.MaxWeight > 0 && pkg.Weight+u.weight > box.MaxWeight+epsilon {
+			continue
+		}
+		placement, at, ok := place(box, pkg.Placements, points, u)
+		if !ok {
+			continue
+		}
+		pkg.Placements = append(pkg.Placements, placement)
+		pkg.Weight += u.weight
+		packed[i] = true
+		points = append(points[:at], points[at+1:]...)
+		points = addPoint(points, point{placement.X + placement.Length, placement.Y, placement.Z})
+		points = addPoint(points, point{placement.X, placement.Y + placement.Width, placement.Z})
+		points = addPoint(points, point{placement.X, placement.Y, placement.Z + placement.Height})
+		sort.SliceStable(points, func(a, b int) bool {
+			if points[a].z != points[b].z {
+				return points[a].z < points[b].z
+			}
+			if points[a].y != points[b].y {
+				return points[a].y < points[b].y
+			}
+			return points[a].x < points[b].x
+		})
+	}
+	pkg.Weight = math.Round(pkg.Weight*1000) / 1000
+	pkg.Utilization = math.Round(packedVolume(pkg)/box.volume()*1000) / 1000
+	return pkg, packed
+}
+
+// place finds the lowest extreme point u fits at without overlapping what is already placed, preferring the
+// orientation that keeps it lowest
+func place(box Box, placed []Placement, points []point, u unit) (Placement, int, bool) {
+	orientations := rotations(u.dims)
+	for at, p := range points {
+		for _, d := range orientations {
+			candidate := Placement{SKU: u.sku, X: p.x, Y: p.y, Z: p.z, Length: d[0], Width: d[1], Height: d[2]}
+			if candidate.X+candidate.Length > box.Length+epsilon || candidate.Y+candidate.Width > box.Width+epsilon ||
+				candidate.Z+candidate.Height > box.Height+epsilon {
+				continue
+			}
+			if !overlapsAny(candidate, placed) {
+				return candidate, at, true
+			}
+		}
+	}
+	return Placement{}, 0, false
+}
+
+// rotations returns the distinct orientations of dims, flattest first
+func rotations(dims [3]float64) [][3]float64 {
+	orders := [][3]int{{0, 1, 2}, {1, 0, 2}, {0, 2, 1}, {2, 0, 1}, {1, 2, 0}, {2, 1, 0}}
+	var result [][3]float64
+	seen := map[[3]float64]bool{}
+	for _, o := range orders {
+		d := [3]float64{dims[o[0]], dims[o[1]], dims[o[2]]}
+		if !seen[d] {
+			seen[d] = true
+			result = append(result, d)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i][2] < result[j][2]
+	})
+	return result
+}
+
+func overlapsAny(c Placement, placed []Placement) bool {
+	for _, p := range placed {
+		if c.X < p.X+p.Length-epsilon && p.X < c.X+c.Length-epsilon &&
+			c.Y < p.Y+p.Width-epsilon && p.Y < c.Y+c.Width-epsilon &&
+			c.Z < p.Z+p.Height-epsilon && p.Z < c.Z+c.Height-epsilon {
+			return true
+		}
+	}
+	return false
+}
+
+func addPoint(points []point, p point) []point {
+	for _, existing := range points {
+		if math.Abs(existing.x-p.x) < epsilon && math.Abs(existing.y-p.y) < epsilon && math.Abs(existing.z-p.z) < epsilon {
+			return points
+		}
+	}
+	return append(points, p)
+}
+
+func packedVolume(pkg Package) float64 {
+	var volume float64
+	for _, p := range pkg.Placements {
+		volume += p.Length * p.Width * p.Height
+	}
+	return volume
+}
+
+func longest(u unit) float64 {
+	return math.Max(u.dims[0], math.Max(u.dims[1], u.dims[2]))
+}
@@ -0,0 +1,121 @@
+package packing
+
+import "testing"
+
+var testBoxes = []Box{
+	{ID: "large", Name: "Large", Length: 40, Width: 30, Height: 30},
+	{ID: "small", Name: "Small", Length: 20, Width: 15, Height: 10},
+	{ID: "medium", Name: "Medium", Length: 30, Width: 20, Height: 20, EmptyWeight: 0.25},
+}
+
+func TestPackSmallestBox(t *testing.T) {
+	packages, err := Pack([]Item{{SKU: "mug", Length: 12, Width: 12, Height: 12, Weight: 0.4, Quantity: 1}}, testBoxes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packages) != 1 || packages[0].Box.ID != "medium" {
+		t.Fatalf("got %+v, want one medium box", packages)
+	}
+	if packages[0].Weight != 0.65 {
+		t.Errorf("weight %g, want 0.65", packages[0].Weight)
+	}
+}
+
+func TestPackRotates(t *testing.T) {
+	packages, err := Pack([]Item{{SKU: "poster", Length: 10, Width: 18, Height: 14, Weight: 0.2, Quantity: 1}}, testBoxes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packages[0].Box.ID != "small" {
+		t.Fatalf("got %s, want small", packages[0].Box.ID)
+	}
+	p := packages[0].Placements[0]
+	if p.Length > 20 || p.Width > 15 || p.Height > 10 {
+		t.Errorf("placement %+v does not fit the small box", p)
+	}
+}
+
+func TestPackFillsBox(t *testing.T) {
+	packages, err := Pack([]Item{{SKU: "cube", Length: 10, Width: 10, Height: 10, Weight: 1, Quantity: 6}}, testBoxes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packages) != 1 || packages[0].Box.ID != "medium" {
+		t.Fatalf("got %+v, want one medium box", packages)
+	}
+	if packages[0].Utilization != 0.5 {
+		t.Errorf("utilization %g, want 0.5", packages[0].Utilization)
+	}
+	if packages[0].Quantities()["cube"] != 6 {
+		t.Errorf("quantities %v, want 6 cubes", packages[0].Quantities())
+	}
+}
+
+func TestPackSplits(t *testing.T) {
+	packages, err := Pack([]Item{{SKU: "cube", Length: 20, Width: 15, Height: 15, Weight: 1, Quantity: 13}}, testBoxes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packages) != 2 {
+		t.Fatalf("got %d packages, want 2", len(packages))
+	}
+	if packages[0].Box.ID != "large" || len(packages[0].Placements) != 8 {
+		t.Errorf("first package %s with %d units, want large with 8", packages[0].Box.ID, len(packages[0].Placements))
+	}
+	if packages[1].Box.ID != "large" || len(packages[1].Placements) != 5 {
+		t.Errorf("second package %s with %d units, want large with 5", packages[1].Box.ID, len(packages[1].Placements))
+	}
+}
+
+func TestPackMaxWeight(t *testing.T) {
+	boxes := []Box{{ID: "flat", Length: 30, Width: 30, Height: 10, MaxWeight: 2}}
+	packages, err := Pack([]Item{{SKU: "book", Length: 20, Width: 14, Height: 3, Weight: 0.8, Quantity: 4}}, boxes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packages) != 2 || len(packages[0].Placements) != 2 || len(packages[1].Placements) != 2 {
+		t.Fatalf("got %+v, want two boxes of two books", packages)
+	}
+}
+
+func TestPackNoOverlap(t *testing.T) {
+	items := []Item{
+		{SKU: "a", Length: 12, Width: 8, Height: 5, Weight: 0.3, Quantity: 5},
+		{SKU: "b", Length: 7, Width: 7, Height: 7, Weight: 0.5, Quantity: 4},
+		{SKU: "c", Length: 25, Width: 4, Height: 4, Weight: 0.1, Quantity: 3},
+	}
+	packages, err := Pack(items, testBoxes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	units := 0
+	for _, pkg := range packages {
+		units += len(pkg.Placements)
+		for i, p := range pkg.Placements {
+			if p.X+p.Length > pkg.Box.Length || p.Y+p.Width > pkg.Box.Width || p.Z+p.Height > pkg.Box.Height {
+				t.Errorf("%+v outside %s", p, pkg.Box.ID)
+			}
+			if overlapsAny(p, pkg.Placements[:i]) {
+				t.Errorf("%+v overlaps in %s", p, pkg.Box.ID)
+			}
+		}
+	}
+	if units != 12 {
+		t.Errorf("packed %d units, want 12", units)
+	}
+}
+
+func TestPackErrors(t *testing.T) {
+	if _, err := Pack([]Item{{SKU: "pole", Length: 60, Width: 5, Height: 5, Quantity: 1}}, testBoxes); err == nil {
+		t.Error("oversized item packed")
+	}
+	if _, err := Pack([]Item{{SKU: "flat", Length: 10, Width: 10, Quantity: 1}}, testBoxes); err == nil {
+		t.Error("item without height packed")
+	}
+	if _, err := Pack([]Item{{SKU: "mug", Length: 10, Width: 10, Height: 10, Quantity: 1}}, nil); err == nil {
+		t.Error("packed without boxes")
+	}
+	if _, err := Pack([]Item{{SKU: "pin", Length: 1, Width: 1, Height: 1, Quantity: MaxUnits + 1}}, testBoxes); err == nil {
+		t.Error("packed more than MaxUnits")
+	}
+}
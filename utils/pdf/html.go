@@ -0,0 +1,81 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RenderURL is the chromium render service html documents are printed with, a gotenberg compatible
+// service that takes an index.html form file and answers with the pdf
+var RenderURL string
+
+const renderPath = "/forms/chromium/convert/html"
+
+// ConnectToRenderer sets the render service from PDF_RENDER_URL
+func ConnectToRenderer() {
+	RenderURL = strings.TrimRight(os.Getenv("PDF_RENDER_URL"), "/")
+}
+
+// FromHTML prints an html document on pages of width by height inches, the document sets its own margins and
+// page breaks with css
+func FromHTML(html []byte, width, height float64) ([]byte, error) {
+	if RenderURL == "" {
+		return nil, errors.New("pdf render service is not configured")
+	}
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	file, err := writer.CreateFormFile("files", "index.html")
+	if err != nil {
+		return nil, err
+	}
+	if _, err = file.Write(html); err != nil {
+		return nil, err
+	}
+	fields := map[string]string{
+		"paperWidth":      strconv.FormatFloat(width, 'f', -1, 64),
+		"paperHeight":     strconv.FormatFloat(height, 'f', -1, 64),
+		"marginTop":       "0",
+		"marginBottom":    "0",
+		"marginLeft":      "0",
+		"marginRight":     "0",
+		"printBackground": "true",
+	}
+	for name, value := range fields {
+		if err = writer.WriteField(name, value); err != nil {
+			return nil, err
+		}
+	}
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", RenderURL+renderPath, &form)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	client := &http.Client{Timeout: time.Second * 30}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("pdf render failed with " + resp.Status)
+	}
+	if !bytes.HasPrefix(body, []byte("%PDF")) {
+		return nil, errors.New("pdf render did not return a pdf")
+	}
+	return body, nil
+}
@@ -0,0 +1,47 @@
+package pdf
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFromHTML(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != renderPath {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		file, _, err := r.FormFile("files")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		html, _ := ioutil.ReadAll(file)
+		if string(html) != "<h1>Packing Slip</h1>" || r.FormValue("paperWidth") != "8.5" || r.FormValue("paperHeight") != "11" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write(testPDF())
+	}))
+	defer server.Close()
+
+	RenderURL = ""
+	if _, err := FromHTML([]byte("<h1>Packing Slip</h1>"), 8.5, 11); err == nil {
+		t.Errorf("render without a service should fail")
+	}
+
+	RenderURL = server.URL
+	defer func() { RenderURL = "" }()
+	doc, err := FromHTML([]byte("<h1>Packing Slip</h1>"), 8.5, 11)
+	if err != nil {
+		t.Fatalf("from html: %s", err)
+	}
+	if string(doc[:4]) != "%PDF" {
+		t.Errorf("got %q, want a pdf", doc[:4])
+	}
+	if _, err = FromHTML([]byte("<h1>Pick List</h1>"), 8.5, 11); err == nil {
+		t.Errorf("failed render should return an error")
+	}
+}
@@ -0,0 +1,95 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+)
+
+func init() {
+	// pdfcpu exits the process if it can not create its config dir, the defaults are all we need
+	api.DisableConfigDir()
+}
+
+func configuration() *pdfcpu.Configuration {
+	conf := pdfcpu.NewDefaultConfiguration()
+	conf.ValidationMode = pdfcpu.ValidationRelaxed
+	return conf
+}
+
+// Merge concatenates the pages of docs, in order, into a single pdf
+func Merge(docs [][]byte) ([]byte, error) {
+	if len(docs) == 1 {
+		return docs[0], nil
+	}
+	readers := make([]io.ReadSeeker, len(docs))
+	for i := range docs {
+		readers[i] = bytes.NewReader(docs[i])
+	}
+	var out bytes.Buffer
+	if err := api.Merge(readers, &out, configuration()); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// CropTo4x6 crops every page to the 4x6 inch label in its top left corner, used to print letter
+// sized labels on thermal label stock
+func CropTo4x6(doc []byte) ([]byte, error) {
+	box, err := api.Box("pos:tl, dim:4 6", pdfcpu.INCHES)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err = api.Crop(bytes.NewReader(doc), &out, nil, box, configuration()); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// FromImage builds a single page pdf of pageWidth by pageHeight inches with a png or jpeg image turned
+// upright in its top left corner and scaled to height inches, used for carriers that only return label images
+func FromImage(img []byte, pageWidth, pageHeight, height float64) ([]byte, error) {
+	upright, err := portrait(img)
+	if err != nil {
+		return nil, err
+	}
+	imp, err := api.Import(fmt.Sprintf("dimensions:%g %g, position:tl, scalefactor:%g", pageWidth, pageHeight, height/pageHeight), pdfcpu.INCHES)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err = api.ImportImages(nil, &out, []io.Reader{bytes.NewReader(upright)}, imp, configuration()); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// portrait returns img as a png, rotated a quarter turn when it is wider than it is tall
+func portrait(img []byte) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(img))
+	if err != nil {
+		return nil, err
+	}
+	b := src.Bounds()
+	if b.Dx() > b.Dy() {
+		rotated := image.NewRGBA(image.Rect(0, 0, b.Dy(), b.Dx()))
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				rotated.Set(b.Max.Y-1-y, x-b.Min.X, src.At(x, y))
+			}
+		}
+		src = rotated
+	}
+	var out bytes.Buffer
+	if err = png.Encode(&out, src); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,90 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+)
+
+// testPDF builds a one page letter sized pdf, padded because pdfcpu
+// looks for the xref offset in the last 512 bytes
+func testPDF() []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << >> /Contents 4 0 R >>",
+		"<< /Length 0 >>\nstream\n\nendstream",
+	}
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n%" + strings.Repeat("-", 600) + "\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+func TestMerge(t *testing.T) {
+	merged, err := Merge([][]byte{testPDF(), testPDF(), testPDF()})
+	if err != nil {
+		t.Fatalf("merge: %s", err)
+	}
+	got, err := api.PageCount(bytes.NewReader(merged), configuration())
+	if err != nil {
+		t.Fatalf("page count: %s", err)
+	}
+	if got != 3 {
+		t.Errorf("got %d pages, want 3", got)
+	}
+}
+
+func TestCropTo4x6(t *testing.T) {
+	cropped, err := CropTo4x6(testPDF())
+	if err != nil {
+		t.Fatalf("crop: %s", err)
+	}
+	pb, _ := api.PageBoundariesFromBoxList("crop")
+	boxes, err := api.ListBoxes(bytes.NewReader(cropped), nil, pb, configuration())
+	if err != nil {
+		t.Fatalf("list boxes: %s", err)
+	}
+	if !strings.Contains(strings.Join(boxes, "\n"), "(0.00, 360.00, 288.00, 792.00)") {
+		t.Errorf("got boxes %v, want crop box (0, 360, 288, 792)", boxes)
+	}
+}
+
+func TestFromImage(t *testing.T) {
+	// a landscape label image, as ups returns them
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewGray(image.Rect(0, 0, 60, 40))); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := FromImage(img.Bytes(), 8.5, 11, 6)
+	if err != nil {
+		t.Fatalf("from image: %s", err)
+	}
+	pb, _ := api.PageBoundariesFromBoxList("media")
+	boxes, err := api.ListBoxes(bytes.NewReader(doc), nil, pb, configuration())
+	if err != nil {
+		t.Fatalf("list boxes: %s", err)
+	}
+	if !strings.Contains(strings.Join(boxes, "\n"), "(0.00, 0.00, 612.00, 792.00)") {
+		t.Errorf("got boxes %v, want a letter page", boxes)
+	}
+	// turned upright the image is 40x60, 6 inches tall is 432 points, 288 wide, anchored top left
+	if !bytes.Contains(doc, []byte("q 288.00 0.00 0.00 432.00 0.00 360.00 cm /Im0 Do Q")) {
+		t.Errorf("image is not upright in the top left corner")
+	}
+}
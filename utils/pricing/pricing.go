@@ -0,0 +1,99 @@
+package pricing
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// carriers a plan can override pricing for
+const (
+	CarrierCanadaPost = "canadapost"
+	CarrierPurolator  = "purolator"
+	CarrierUPS        = "ups"
+	CarrierFedEx      = "fedex"
+)
+
+// Markup is a flat fee in cents and a percentage of the carrier cost, a nil field is not set and falls
+// back to the less specific markup
+type Markup struct {
+	FlatFee *int64   `json:"flat_fee,omitempty"`
+	Percent *float64 `json:"percent,omitempty"`
+}
+
+// Override replaces the markup for a carrier, or only one of its services when ServiceCode is set
+type Override struct {
+	Markup
+	Carrier     string `json:"carrier"`
+	ServiceCode string `json:"service_code,omitempty"`
+}
+
+// Tier replaces the markup once a company has bought MinLabels labels in the current month
+type Tier struct {
+	Markup
+	MinLabels int `json:"min_labels"`
+}
+
+// Plan is the pricing a company is charged with
+type Plan struct {
+	Name      string     `json:"name"`
+	FlatFee   int64      `json:"flat_fee"`
+	Percent   float64    `json:"percent"`
+	Tiers     []Tier     `json:"tiers,omitempty"`
+	Overrides []Override `json:"overrides,omitempty"`
+}
+
+// DefaultPlan is used for companies without a plan, a flat 1.10 per label
+var DefaultPlan = Plan{Name: "default", FlatFee: 110}
+
+// Parse reads a plan stored as json
+func Parse(data []byte) (Plan, error) {
+	var plan Plan
+	err := json.Unmarshal(data, &plan)
+	return plan, err
+}
+
+// Price returns the customer price in cents of a label costing cost cents from the carrier. The base markup
+// of the plan is replaced field by field by the highest tier the monthly volume reaches, then by the carrier
+// override and then by the service override, so the most specific setting wins
+func (p Plan) Price(carrier, serviceCode string, cost int64, volume int) int64 {
+	flatFee, percent := p.FlatFee, p.Percent
+	apply := func(m Markup) {
+		if m.FlatFee != nil {
+			flatFee = *m.FlatFee
+		}
+		if m.Percent != nil {
+			percent = *m.Percent
+		}
+	}
+
+	tier := -1
+	for i := range p.Tiers {
+		if volume >= p.Tiers[i].MinLabels && (tier < 0 || p.Tiers[i].MinLabels > p.Tiers[tier].MinLabels) {
+			tier = i
+		}
+	}
+	if tier >= 0 {
+		apply(p.Tiers[tier].Markup)
+	}
+	for _, o := range p.Overrides {
+		if o.Carrier == carrier && o.ServiceCode == "" {
+			apply(o.Markup)
+		}
+	}
+	for _, o := range p.Overrides {
+		if o.Carrier == carrier && o.ServiceCode != "" && o.ServiceCode == serviceCode {
+			apply(o.Markup)
+		}
+	}
+
+	price := cost + int64(math.Ceil(float64(cost)*percent/100)) + flatFee
+	if price < cost {
+		return cost
+	}
+	return price
+}
+
+// Cents converts a carrier amount in dollars to cents, rounding up to the next cent
+func Cents(amount float64) int64 {
+	return int64(math.Ceil(math.Round(amount*10000) / 100))
+}
@@ -0,0 +1,72 @@
+package pricing
+
+import "testing"
+
+func int64p(v int64) *int64       { return &v }
+func float64p(v float64) *float64 { return &v }
+
+func TestDefaultPlan(t *testing.T) {
+	if got := DefaultPlan.Price(CarrierCanadaPost, "DOM.RP", 1234, 0); got != 1344 {
+		t.Errorf("got %d, want 1344", got)
+	}
+}
+
+func TestPlanPrice(t *testing.T) {
+	plan := Plan{
+		FlatFee: 100,
+		Percent: 10,
+		Tiers: []Tier{
+			{MinLabels: 100, Markup: Markup{Percent: float64p(5)}},
+			{MinLabels: 1000, Markup: Markup{Percent: float64p(2), FlatFee: int64p(50)}},
+		},
+		Overrides: []Override{
+			{Carrier: CarrierCanadaPost, ServiceCode: "DOM.PC", Markup: Markup{FlatFee: int64p(0)}},
+			{Carrier: CarrierCanadaPost, Markup: Markup{FlatFee: int64p(75)}},
+		},
+	}
+	cases := []struct {
+		carrier, service string
+		cost             int64
+		volume           int
+		want             int64
+	}{
+		{"ups", "03", 1000, 0, 1200},
+		{"ups", "03", 1000, 150, 1150},
+		{"ups", "03", 1000, 5000, 1070},
+		{CarrierCanadaPost, "DOM.RP", 1000, 0, 1175},
+		{CarrierCanadaPost, "DOM.PC", 1000, 0, 1100},
+		{CarrierCanadaPost, "DOM.PC", 1000, 1000, 1020},
+		{"ups", "03", 999, 0, 1199},
+	}
+	for _, c := range cases {
+		if got := plan.Price(c.carrier, c.service, c.cost, c.volume); got != c.want {
+			t.Errorf("%s %s %d at %d: got %d, want %d", c.carrier, c.service, c.cost, c.volume, got, c.want)
+		}
+	}
+}
+
+func TestPriceNeverBelowCost(t *testing.T) {
+	plan := Plan{FlatFee: -500}
+	if got := plan.Price(CarrierCanadaPost, "DOM.RP", 300, 0); got != 300 {
+		t.Errorf("got %d, want 300", got)
+	}
+}
+
+func TestParse(t *testing.T) {
+	plan, err := Parse([]byte(`{"name":"pro","flat_fee":50,"percent":2.5,"overrides":[{"carrier":"canadapost","service_code":"DOM.EP","percent":0}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Name != "pro" || plan.FlatFee != 50 || plan.Percent != 2.5 || len(plan.Overrides) != 1 || *plan.Overrides[0].Percent != 0 {
+		t.Errorf("unexpected plan %+v", plan)
+	}
+}
+
+func TestCents(t *testing.T) {
+	cases := map[float64]int64{12.34: 1234, 12.341: 1235, 0.1 + 0.2: 30, 7: 700}
+	for amount, want := range cases {
+		if got := Cents(amount); got != want {
+			t.Errorf("%v: got %d, want %d", amount, got, want)
+		}
+	}
+}
@@ -46,6 +46,9 @@ type AmazonUnfulfilledResponse struct {
 				PaymentMethod      string `xml:"PaymentMethod"`
 				ShippingAddress    struct {
 					Text                         string `xml:",chardata"`
+					Name                         string `xml:"Name"`
+					AddressLine1                 string `xml:"AddressLine1"`
+					AddressLine2                 string `xml:"AddressLine2"`
 					City                         string `xml:"City"`
 					PostalCode                   string `xml:"PostalCode"`
 					IsAddressSharingConfidential string `xml:"isAddressSharingConfidential"`
@@ -45,7 +45,7 @@ type CanadaPostRatesResponse struct {
 			Due     string `xml:"due"`
 			Options struct {
 				Text   string `xml:",chardata"`
-				Option struct {
+				Option []struct {
 					Text        string `xml:",chardata"`
 					OptionCode  string `xml:"option-code"`
 					OptionName  string `xml:"option-name"`
@@ -98,18 +98,57 @@ type CanadaPostRatePrice struct {
 	Pst string `json:"pst"`
 	Hst string `json:"hst"`
 	Due     string `json:"due"`
-	Options struct {
-		Option struct {
-			OptionCode  string `json:"option-code"`
-			OptionName  string `json:"option-name"`
-			OptionPrice string `json:"option-price"`
-		} `json:"option"`
-	} `json:"options"`
+	Options []CanadaPostOption `json:"options"`
 	Adjustments []CanadaPostAdjustment `json:"adjustments"`
 }
 
+type CanadaPostOption struct {
+	OptionCode  string `json:"option-code"`
+	OptionName  string `json:"option-name"`
+	OptionPrice string `json:"option-price"`
+}
+
 type CanadaPostAdjustment struct {
 	AdjustmentCode string `json:"adjustment-code"`
 	AdjustmentName string `json:"adjustment-name"`
 	AdjustmentCost string `json:"adjustment-cost"`
-}
\ No newline at end of file
+}
+type CanadaPostTrackingDetail struct {
+	XMLName           xml.Name `xml:"tracking-detail"`
+	Pin               string   `xml:"pin"`
+	SignificantEvents []struct {
+		Identifier  string `xml:"event-identifier"`
+		Date        string `xml:"event-date"`
+		Time        string `xml:"event-time"`
+		TimeZone    string `xml:"event-time-zone"`
+		Description string `xml:"event-description"`
+		Site        string `xml:"event-site"`
+		Province    string `xml:"event-province"`
+	} `xml:"significant-events>occurrence"`
+}
+
+type CanadaPostManifestLinks struct {
+	XMLName xml.Name `xml:"manifests"`
+	Links   []struct {
+		Name string `xml:"rel,attr"`
+		Link string `xml:"href,attr"`
+	} `xml:"link"`
+}
+
+type CanadaPostManifest struct {
+	XMLName  xml.Name `xml:"manifest"`
+	PoNumber string   `xml:"po-number"`
+	Links    []struct {
+		Name string `xml:"rel,attr"`
+		Link string `xml:"href,attr"`
+	} `xml:"links>link"`
+}
+
+type CanadaPostPickupResponse struct {
+	XMLName   xml.Name `xml:"pickup-request-info"`
+	RequestID string   `xml:"pickup-request-header>request-id"`
+	Links     []struct {
+		Name string `xml:"rel,attr"`
+		Link string `xml:"href,attr"`
+	} `xml:"links>link"`
+}
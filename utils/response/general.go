@@ -1,5 +1,7 @@
 package response
 
+import "go.fromyama/utils/address"
+
 type BasicMessage struct {
 	Message string `json:"message"`
 }
@@ -16,10 +18,38 @@ type User struct {
 	IsHead bool `json:"is_head"`
 	ID string `json:"id"`
 	IsApproved bool `json:"is_approved"`
+	Role string `json:"role"`
+	EmailVerified bool `json:"email_verified"`
 }
 
 type Token struct {
 	Raw string `json:"token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn int `json:"expires_in,omitempty"`
+}
+
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool `json:"two_factor_required"`
+	TwoFactorToken string `json:"two_factor_token"`
+	ExpiresIn int `json:"expires_in"`
+}
+
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type Session struct {
+	ID string `json:"id"`
+	Device string `json:"device"`
+	IPAddress string `json:"ip_address"`
+	CreatedAt string `json:"created_at"`
+	LastUsedAt string `json:"last_used_at"`
+	Current bool `json:"current"`
 }
 
 type UserDetails struct {
@@ -42,6 +72,45 @@ type Employee struct {
 	Email string `json:"email"`
 	Approved bool `json:"is_approved"`
 	ID string `json:"id"`
+	Role string `json:"role"`
+}
+
+type AuditEntry struct {
+	ActorID string `json:"actor_id"`
+	ActorEmail string `json:"actor_email"`
+	TargetID string `json:"target_id"`
+	TargetEmail string `json:"target_email"`
+	Action string `json:"action"`
+	Detail string `json:"detail,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+type Invitation struct {
+	ID string `json:"id"`
+	Email string `json:"email"`
+	Role string `json:"role"`
+	InvitedBy string `json:"invited_by"`
+	CreatedAt string `json:"created_at"`
+	ExpiresAt string `json:"expires_at"`
+	Expired bool `json:"expired"`
+	Emailed bool `json:"emailed,omitempty"`
+}
+
+type InvitationEmail struct {
+	CompanyName string
+	Role string
+	Link string
+	ExpiresAt string
+}
+
+type LinkEmail struct {
+	Link string
+	ExpiresAt string
+}
+
+type Role struct {
+	Name string `json:"name"`
+	Permissions []string `json:"permissions"`
 }
 
 type PostageAddress struct {
@@ -52,6 +121,7 @@ type PostageAddress struct {
 	Country string `json:"country"`
 	PostalCode string `json:"postal_code"`
 	Phone int `json:"phone"`
+	ContactName string `json:"contact_name,omitempty"`
 }
 
 type Company struct {
@@ -68,6 +138,28 @@ type Parcel struct {
 	Width float64 `json:"width"`
 	Height float64 `json:"height"`
 	Weight float64 `json:"weight"`
+	EmptyWeight float64 `json:"empty_weight"`
+	Default bool `json:"default"`
+}
+
+type Product struct {
+	Sku string `json:"sku"`
+	Name string `json:"name"`
+	Weight float64 `json:"weight"`
+	Length float64 `json:"length"`
+	Width float64 `json:"width"`
+	Height float64 `json:"height"`
+	HsCode string `json:"hs_code"`
+	OriginCountry string `json:"origin_country"`
+}
+
+type Location struct {
+	ID string `json:"id"`
+	Name string `json:"name"`
+	Address PostageAddress `json:"address"`
+	ContactName string `json:"contact_name"`
+	Default bool `json:"default"`
+	ShopifyLocationID string `json:"shopify_location_id,omitempty"`
 }
 
 type Shipper struct {
@@ -94,8 +186,14 @@ type Order struct {
 	Currency        string         `json:"currency"`
 	Name            string         `json:"name"`
 	WasPaid         bool           `json:"was_paid"`
+	Note            string         `json:"note,omitempty"`
+	LocationID      string         `json:"location_id,omitempty"`
+	Weight          float64        `json:"weight,omitempty"`
+	Tags            []string       `json:"tags,omitempty"`
 	Items           []Item         `json:"items"`
 	ShippingAddress Address `json:"shipping_address"`
+	AddressValid    bool           `json:"address_valid"`
+	AddressIssues   []address.Issue `json:"address_issues,omitempty"`
 }
 
 type Item struct {
@@ -0,0 +1,228 @@
+package response
+
+import "go.fromyama/utils/rules"
+
+type Labels struct {
+	Labels []Label `json:"labels"`
+	Page   int     `json:"page"`
+	Limit  int     `json:"limit"`
+	Total  int     `json:"total"`
+}
+
+type Label struct {
+	ID             string  `json:"id"`
+	UserID         string  `json:"user_id"`
+	Carrier        string  `json:"carrier"`
+	TrackingNumber string  `json:"tracking_number"`
+	Name           string  `json:"name"`
+	PostalCode     string  `json:"postal_code"`
+	Country        string  `json:"country"`
+	ServiceCode    string  `json:"service_code"`
+	Price          float64 `json:"price"`
+	ReturnOf       string  `json:"return_of,omitempty"`
+	Voided         bool    `json:"voided"`
+	CreatedAt      string  `json:"created_at"`
+}
+
+type Document struct {
+	Kind        string `json:"kind"`
+	ContentType string `json:"content_type"`
+	Sha256      string `json:"sha256"`
+	Size        int    `json:"size"`
+	CreatedAt   string `json:"created_at"`
+	ExpiresAt   string `json:"expires_at,omitempty"`
+}
+
+type LabelBatchRequest struct {
+	LabelFormat string              `json:"label_format"`
+	Items       []map[string]string `json:"items"`
+}
+
+type LabelBatch struct {
+	ID       string           `json:"id"`
+	Total    float64          `json:"total"`
+	Refunded float64          `json:"refunded"`
+	Items    []LabelBatchItem `json:"items"`
+	PdfUrl   string           `json:"pdf_url,omitempty"`
+}
+
+type LabelBatchItem struct {
+	Index          int     `json:"index"`
+	OrderID        string  `json:"order_id,omitempty"`
+	Status         string  `json:"status"`
+	Error          string  `json:"error,omitempty"`
+	LabelID        string  `json:"label_id,omitempty"`
+	TrackingNumber string  `json:"tracking_number,omitempty"`
+	Total          float64 `json:"total"`
+}
+
+type LabelTracking struct {
+	LabelID        string          `json:"label_id"`
+	TrackingNumber string          `json:"tracking_number"`
+	Status         string          `json:"status"`
+	CheckedAt      string          `json:"checked_at,omitempty"`
+	Events         []TrackingEvent `json:"events"`
+}
+
+type TrackingEvent struct {
+	Status      string `json:"status"`
+	Code        string `json:"code"`
+	Description string `json:"description"`
+	Location    string `json:"location"`
+	OccurredAt  string `json:"occurred_at"`
+}
+
+type Manifest struct {
+	ID        string `json:"id"`
+	PoNumber  string `json:"po_number"`
+	GroupID   string `json:"group_id"`
+	CreatedAt string `json:"created_at"`
+	PdfUrl    string `json:"pdf_url"`
+}
+
+type ReturnLabel struct {
+	LabelID        string  `json:"label_id"`
+	ReturnOf       string  `json:"return_of,omitempty"`
+	OrderID        string  `json:"order_id,omitempty"`
+	TrackingNumber string  `json:"tracking_number"`
+	Total          float64 `json:"total"`
+	Emailed        bool    `json:"emailed"`
+	PdfUrl         string  `json:"pdf_url"`
+}
+
+type ReturnLabelEmail struct {
+	CompanyName    string
+	TrackingNumber string
+}
+
+type Pickup struct {
+	ID          string         `json:"id"`
+	RequestID   string         `json:"request_id"`
+	Date        string         `json:"date"`
+	ReadyTime   string         `json:"ready_time"`
+	ClosingTime string         `json:"closing_time"`
+	Address     PostageAddress `json:"address"`
+	Status      string         `json:"status"`
+	LabelIDs    []string       `json:"label_ids"`
+}
+
+type CarrierRate struct {
+	Carrier           string             `json:"carrier"`
+	ServiceCode       string             `json:"service_code"`
+	ServiceName       string             `json:"service_name"`
+	Base              float64            `json:"base"`
+	Surcharges        []CarrierSurcharge `json:"surcharges"`
+	Taxes             float64            `json:"taxes"`
+	Price             float64            `json:"price"`
+	BillableWeight    float64            `json:"billable_weight"`
+	DimensionalWeight float64            `json:"dimensional_weight"`
+	Residential       bool               `json:"residential"`
+	TransitDays       int                `json:"transit_days"`
+	ExpectedDelivery  string             `json:"expected_delivery,omitempty"`
+}
+
+type CarrierSurcharge struct {
+	Code   string  `json:"code"`
+	Name   string  `json:"name"`
+	Amount float64 `json:"amount"`
+}
+
+type VoidedLabel struct {
+	LabelID        string  `json:"label_id"`
+	Refunded       float64 `json:"refunded"`
+	RefundTicketID string  `json:"refund_ticket_id,omitempty"`
+}
+
+type OrderDocumentRequest struct {
+	Orders []Order `json:"orders"`
+	Paper  string  `json:"paper"`
+}
+
+type Branding struct {
+	CompanyName string
+	Address     PostageAddress
+	LogoURL     string
+	Message     string
+}
+
+type PackingSlips struct {
+	Branding Branding
+	Orders   []Order
+}
+
+type PickList struct {
+	Branding   Branding
+	CreatedAt  string
+	OrderCount int
+	UnitCount  int
+	Lines      []PickListLine
+}
+
+type PickListLine struct {
+	Sku      string
+	Title    string
+	Quantity int
+	Orders   []string
+}
+
+type PackRequest struct {
+	Items       []PackItem        `json:"items"`
+	ParcelIDs   []string          `json:"parcel_ids"`
+	Carrier     string            `json:"carrier"`
+	Destination map[string]string `json:"destination"`
+}
+
+type PackItem struct {
+	Sku      string  `json:"sku"`
+	Quantity int     `json:"quantity"`
+	Length   float64 `json:"length"`
+	Width    float64 `json:"width"`
+	Height   float64 `json:"height"`
+	Weight   float64 `json:"weight"`
+}
+
+type Packing struct {
+	Packages []PackedParcel `json:"packages"`
+	Rates    []PackRate     `json:"rates"`
+}
+
+type PackedParcel struct {
+	Parcel      Parcel       `json:"parcel"`
+	Weight      float64      `json:"weight"`
+	Utilization float64      `json:"utilization"`
+	Items       []PackedItem `json:"items"`
+}
+
+type PackedItem struct {
+	Sku      string `json:"sku"`
+	Quantity int    `json:"quantity"`
+}
+
+type PackRate struct {
+	Carrier       string    `json:"carrier"`
+	ServiceCode   string    `json:"service_code"`
+	ServiceName   string    `json:"service_name"`
+	Price         float64   `json:"price"`
+	PackagePrices []float64 `json:"package_prices"`
+}
+
+type PrepareRequest struct {
+	Orders []Order `json:"orders"`
+}
+
+type PreparedShipment struct {
+	OrderID  string            `json:"order_id"`
+	RuleID   string            `json:"rule_id,omitempty"`
+	RuleName string            `json:"rule_name,omitempty"`
+	Shipment map[string]string `json:"shipment"`
+}
+
+type RuleDryRunRequest struct {
+	Order Order        `json:"order"`
+	Rules []rules.Rule `json:"rules"`
+}
+
+type RuleDryRun struct {
+	Evaluation rules.Evaluation  `json:"evaluation"`
+	Shipment   map[string]string `json:"shipment"`
+}
@@ -0,0 +1,9 @@
+package response
+
+import "go.fromyama/utils/pricing"
+
+type PricingPlan struct {
+	Plan          pricing.Plan `json:"plan"`
+	MonthlyLabels int          `json:"monthly_labels"`
+	CarrierBilled bool         `json:"carrier_billed"`
+}
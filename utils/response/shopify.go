@@ -101,10 +101,12 @@ type ShopifyUnfulfilledResponse struct {
 		CreatedAt             string        `json:"created_at"`
 		Number                int           `json:"number"`
 		Note                  string        `json:"note"`
+		LocationID            int64         `json:"location_id"`
 		Token                 string        `json:"token"`
 		TotalPrice            string        `json:"total_price"`
 		SubtotalPrice         string        `json:"subtotal_price"`
 		TotalWeight           int           `json:"total_weight"`
+		Tags                  string        `json:"tags"`
 		TotalTax              string        `json:"total_tax"`
 		TaxesIncluded         bool          `json:"taxes_included"`
 		Currency              string        `json:"currency"`
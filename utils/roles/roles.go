@@ -0,0 +1,73 @@
+package roles
+
+// Roles of a company member, the company head is the owner
+const (
+	Owner   = "owner"
+	Admin   = "admin"
+	Shipper = "shipper"
+	Viewer  = "viewer"
+)
+
+// Permissions a route can require
+const (
+	// ViewShipments reads orders, rates, labels, pickups, manifests and company settings
+	ViewShipments = "shipments:view"
+	// Ship buys, voids and fulfills labels and schedules pickups and manifests
+	Ship = "shipments:create"
+	// ManageSettings changes parcels, products, locations, rules, formats and platform connections
+	ManageSettings = "settings:manage"
+	// ManageMembers approves members and changes their roles
+	ManageMembers = "members:manage"
+	// ManageBilling adds payment methods, charges the company card and sets the canada post contract it is billed on
+	ManageBilling = "billing:manage"
+	// DeleteCompany unregisters the company
+	DeleteCompany = "company:delete"
+	// TransferOwnership makes another member the head of the company
+	TransferOwnership = "company:transfer"
+	// ManageSecurity sets the company security policy
+	ManageSecurity = "security:manage"
+)
+
+// All is every role from the most to the least trusted
+var All = []string{Owner, Admin, Shipper, Viewer}
+
+var permissions = map[string][]string{
+	Owner:   {ViewShipments, Ship, ManageSettings, ManageMembers, ManageBilling, DeleteCompany, TransferOwnership, ManageSecurity},
+	Admin:   {ViewShipments, Ship, ManageSettings, ManageMembers},
+	Shipper: {ViewShipments, Ship},
+	Viewer:  {ViewShipments},
+}
+
+var rank = map[string]int{Owner: 4, Admin: 3, Shipper: 2, Viewer: 1}
+
+// Valid is true for a known role
+func Valid(role string) bool {
+	return rank[role] > 0
+}
+
+// Permissions returns the permissions of a role, none for an unknown one
+func Permissions(role string) []string {
+	return append([]string(nil), permissions[role]...)
+}
+
+// Can is true when role has the permission
+func Can(role, permission string) bool {
+	for _, p := range permissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// CanManage is true when a member with role actor may change a member with role target or give a member the role
+// target, only a more trusted role can, so admins manage shippers and viewers and the owner manages everyone
+func CanManage(actor, target string) bool {
+	return Can(actor, ManageMembers) && rank[actor] > rank[target]
+}
+
+// RequiresTwoFactor is true for the roles a company can require two factor authentication of, those that can spend
+// its money or change its members
+func RequiresTwoFactor(role string) bool {
+	return role == Owner || role == Admin
+}
@@ -0,0 +1,67 @@
+package roles
+
+import "testing"
+
+func TestCan(t *testing.T) {
+	cases := []struct {
+		role, permission string
+		want             bool
+	}{
+		{Owner, DeleteCompany, true},
+		{Owner, ManageBilling, true},
+		{Admin, ManageMembers, true},
+		{Admin, ManageBilling, false},
+		{Admin, TransferOwnership, false},
+		{Admin, ManageSecurity, false},
+		{Shipper, Ship, true},
+		{Shipper, ManageSettings, false},
+		{Viewer, ViewShipments, true},
+		{Viewer, Ship, false},
+		{"", ViewShipments, false},
+		{"root", ViewShipments, false},
+	}
+	for _, c := range cases {
+		if got := Can(c.role, c.permission); got != c.want {
+			t.Errorf("Can(%q, %q) = %v, want %v", c.role, c.permission, got, c.want)
+		}
+	}
+}
+
+func TestCanManage(t *testing.T) {
+	cases := []struct {
+		actor, target string
+		want          bool
+	}{
+		{Owner, Admin, true},
+		{Owner, Owner, false},
+		{Admin, Shipper, true},
+		{Admin, Viewer, true},
+		{Admin, Admin, false},
+		{Admin, Owner, false},
+		{Shipper, Viewer, false},
+	}
+	for _, c := range cases {
+		if got := CanManage(c.actor, c.target); got != c.want {
+			t.Errorf("CanManage(%q, %q) = %v, want %v", c.actor, c.target, got, c.want)
+		}
+	}
+}
+
+func TestEveryRoleValid(t *testing.T) {
+	for _, role := range All {
+		if !Valid(role) || len(Permissions(role)) == 0 {
+			t.Errorf("%s has no permissions", role)
+		}
+	}
+	if Valid("Owner") {
+		t.Error("roles are lower case")
+	}
+}
+
+func TestRequiresTwoFactor(t *testing.T) {
+	for role, want := range map[string]bool{Owner: true, Admin: true, Shipper: false, Viewer: false} {
+		if got := RequiresTwoFactor(role); got != want {
+			t.Errorf("%s: got %v, want %v", role, got, want)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package rules
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Fields an order is tested on, platform, country and province are compared without case, weight in kg and
+// total are numbers and sku and tag match when any of the order skus or tags does
+const (
+	FieldPlatform = "platform"
+	FieldCountry  = "country"
+	FieldProvince = "province"
+	FieldWeight   = "weight"
+	FieldTotal    = "total"
+	FieldSKU      = "sku"
+	FieldTag      = "tag"
+)
+
+// Operators of a condition, in and not_in take a comma separated list and the comparisons only apply to numbers
+const (
+	OpEquals         = "eq"
+	OpNotEquals      = "ne"
+	OpIn             = "in"
+	OpNotIn          = "not_in"
+	OpGreater        = "gt"
+	OpGreaterOrEqual = "gte"
+	OpLess           = "lt"
+	OpLessOrEqual    = "lte"
+)
+
+var numericFields = map[string]bool{FieldWeight: true, FieldTotal: true}
+
+var textFields = map[string]bool{FieldPlatform: true, FieldCountry: true, FieldProvince: true, FieldSKU: true, FieldTag: true}
+
+var textOperators = map[string]bool{OpEquals: true, OpNotEquals: true, OpIn: true, OpNotIn: true}
+
+var numericOperators = map[string]bool{OpEquals: true, OpNotEquals: true, OpGreater: true, OpGreaterOrEqual: true, OpLess: true, OpLessOrEqual: true}
+
+// Condition tests one field of an order against Value
+type Condition struct {
+	Field    string `json:"field"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+// Action is what a matching rule decides for the shipment, fields left empty are left to the order or the
+// company defaults, Options is a comma separated list of canada post option codes
+type Action struct {
+	Carrier     string `json:"carrier,omitempty"`
+	ServiceCode string `json:"service_code,omitempty"`
+	ParcelID    string `json:"parcel_id,omitempty"`
+	Options     string `json:"options,omitempty"`
+	LocationID  string `json:"location_id,omitempty"`
+}
+
+// Rule applies Action to the orders that meet every condition, a rule without conditions matches every order,
+// rules are tried by ascending Priority
+type Rule struct {
+	ID         string      `json:"id"`
+	Name       string      `json:"name"`
+	Priority   int         `json:"priority"`
+	Enabled    bool        `json:"enabled"`
+	Conditions []Condition `json:"conditions"`
+	Action     Action      `json:"action"`
+}
+
+// Facts are the order fields rules are tested on
+type Facts struct {
+	Platform string
+	Country  string
+	Province string
+	Weight   float64
+	Total    float64
+	SKUs     []string
+	Tags     []string
+}
+
+// Result is the outcome of one rule, Failed has the conditions the order did not meet
+type Result struct {
+	RuleID  string      `json:"rule_id"`
+	Name    string      `json:"name"`
+	Matched bool        `json:"matched"`
+	Failed  []Condition `json:"failed,omitempty"`
+}
+
+// Evaluation is the rule that matched an order, nil when none did, and the result of every rule tried before it
+type Evaluation struct {
+	Matched *Rule    `json:"matched"`
+	Trace   []Result `json:"trace"`
+}
+
+type ruleError struct {
+	s string
+}
+
+func (e *ruleError) Error() string {
+	return e.s
+}
+
+// Validate checks a rule has a name, known fields and operators, numbers where they are compared and an action
+func Validate(rule Rule) error {
+	if strings.TrimSpace(rule.Name) == "" {
+		return &ruleError{"Rule Name Missing"}
+	}
+	for _, c := range rule.Conditions {
+		switch {
+		case numericFields[c.Field]:
+			if !numericOperators[c.Operator] {
+				return &ruleError{"Operator " + c.Operator + " Not Supported For " + c.Field}
+			}
+			if _, err := strconv.ParseFloat(c.Value, 64); err != nil {
+				return &ruleError{"Condition On " + c.Field + " Needs A Number"}
+			}
+		case textFields[c.Field]:
+			if !textOperators[c.Operator] {
+				return &ruleError{"Operator " + c.Operator + " Not Supported For " + c.Field}
+			}
+			if strings.TrimSpace(c.Value) == "" {
+				return &ruleError{"Condition On " + c.Field + " Needs A Value"}
+			}
+		default:
+			return &ruleError{"Unknown Condition Field " + c.Field}
+		}
+	}
+	if rule.Action == (Action{}) {
+		return &ruleError{"Rule Action Missing"}
+	}
+	return nil
+}
+
+// Evaluate tries the enabled rules by ascending priority and stops at the first one the order meets
+func Evaluate(rules []Rule, facts Facts) Evaluation {
+	sorted := append([]Rule(nil), rules...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority < sorted[j].Priority
+	})
+	evaluation := Evaluation{Trace: []Result{}}
+	for i, rule := range sorted {
+		if !rule.Enabled {
+			continue
+		}
+		result := Result{RuleID: rule.ID, Name: rule.Name}
+		for _, c := range rule.Conditions {
+			if !c.matches(facts) {
+				result.Failed = append(result.Failed, c)
+			}
+		}
+		result.Matched = len(result.Failed) == 0
+		evaluation.Trace = append(evaluation.Trace, result)
+		if result.Matched {
+			evaluation.Matched = &sorted[i]
+			break
+		}
+	}
+	return evaluation
+}
+
+func (c Condition) matches(facts Facts) bool {
+	switch c.Field {
+	case FieldWeight:
+		return compare(facts.Weight, c.Operator, c.Value)
+	case FieldTotal:
+		return compare(facts.Total, c.Operator, c.Value)
+	case FieldPlatform:
+		return matchText([]string{facts.Platform}, c.Operator, c.Value)
+	case FieldCountry:
+		return matchText([]string{facts.Country}, c.Operator, c.Value)
+	case FieldProvince:
+		return matchText([]string{facts.Province}, c.Operator, c.Value)
+	case FieldSKU:
+		return matchText(facts.SKUs, c.Operator, c.Value)
+	case FieldTag:
+		return matchText(facts.Tags, c.Operator, c.Value)
+	}
+	return false
+}
+
+func compare(actual float64, operator, value string) bool {
+	want, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return false
+	}
+	switch operator {
+	case OpEquals:
+		return actual == want
+	case OpNotEquals:
+		return actual != want
+	case OpGreater:
+		return actual > want
+	case OpGreaterOrEqual:
+		return actual >= want
+	case OpLess:
+		return actual < want
+	case OpLessOrEqual:
+		return actual <= want
+	}
+	return false
+}
+
+// matchText is true for eq and in when any of actual is in the value list and for ne and not_in when none is
+func matchText(actual []string, operator, value string) bool {
+	wanted := []string{value}
+	if operator == OpIn || operator == OpNotIn {
+		wanted = strings.Split(value, ",")
+	}
+	found := false
+	for _, a := range actual {
+		for _, w := range wanted {
+			if strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(w)) && strings.TrimSpace(w) != "" {
+				found = true
+			}
+		}
+	}
+	switch operator {
+	case OpEquals, OpIn:
+		return found
+	case OpNotEquals, OpNotIn:
+		return !found
+	}
+	return false
+}
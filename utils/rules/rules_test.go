@@ -0,0 +1,85 @@
+package rules
+
+import "testing"
+
+var testRules = []Rule{
+	{ID: "heavy", Name: "Heavy orders", Priority: 20, Enabled: true,
+		Conditions: []Condition{{Field: FieldWeight, Operator: OpGreaterOrEqual, Value: "5"}},
+		Action:     Action{ServiceCode: "DOM.EP"}},
+	{ID: "etsy-small", Name: "Small Etsy orders", Priority: 10, Enabled: true,
+		Conditions: []Condition{{Field: FieldPlatform, Operator: OpEquals, Value: "etsy"}, {Field: FieldWeight, Operator: OpLess, Value: "0.5"}},
+		Action:     Action{ServiceCode: "DOM.LIB"}},
+	{ID: "us", Name: "US signature", Priority: 30, Enabled: true,
+		Conditions: []Condition{{Field: FieldCountry, Operator: OpIn, Value: "US, PR"}},
+		Action:     Action{Options: "SO"}},
+	{ID: "off", Name: "Disabled", Priority: 0, Enabled: false,
+		Action: Action{ServiceCode: "DOM.PC"}},
+}
+
+func TestEvaluatePriority(t *testing.T) {
+	evaluation := Evaluate(testRules, Facts{Platform: "Etsy", Country: "CA", Weight: 0.2})
+	if evaluation.Matched == nil || evaluation.Matched.ID != "etsy-small" {
+		t.Fatalf("got %+v, want etsy-small", evaluation.Matched)
+	}
+	if len(evaluation.Trace) != 1 {
+		t.Errorf("trace %+v, want only the matching rule", evaluation.Trace)
+	}
+}
+
+func TestEvaluateTrace(t *testing.T) {
+	evaluation := Evaluate(testRules, Facts{Platform: "Shopify", Country: "us", Weight: 1})
+	if evaluation.Matched == nil || evaluation.Matched.ID != "us" {
+		t.Fatalf("got %+v, want us", evaluation.Matched)
+	}
+	if len(evaluation.Trace) != 3 || evaluation.Trace[0].RuleID != "etsy-small" || len(evaluation.Trace[0].Failed) != 2 ||
+		evaluation.Trace[1].RuleID != "heavy" || evaluation.Trace[1].Matched {
+		t.Errorf("trace %+v", evaluation.Trace)
+	}
+}
+
+func TestEvaluateNoMatch(t *testing.T) {
+	evaluation := Evaluate(testRules, Facts{Platform: "Shopify", Country: "CA", Weight: 1})
+	if evaluation.Matched != nil {
+		t.Errorf("got %+v, want no match", evaluation.Matched)
+	}
+}
+
+func TestListFields(t *testing.T) {
+	facts := Facts{SKUs: []string{"MUG-1", "TEE-2"}, Tags: []string{"gift", "vip"}}
+	cases := []struct {
+		condition Condition
+		want      bool
+	}{
+		{Condition{FieldSKU, OpEquals, "tee-2"}, true},
+		{Condition{FieldSKU, OpNotEquals, "TEE-2"}, false},
+		{Condition{FieldSKU, OpNotIn, "CAP-1,CAP-2"}, true},
+		{Condition{FieldTag, OpIn, "wholesale, vip"}, true},
+		{Condition{FieldTag, OpNotIn, "gift"}, false},
+		{Condition{FieldTotal, OpGreater, "0"}, false},
+	}
+	for _, c := range cases {
+		if got := c.condition.matches(facts); got != c.want {
+			t.Errorf("%+v: got %v, want %v", c.condition, got, c.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, rule := range testRules {
+		if err := Validate(rule); err != nil {
+			t.Errorf("%s: %v", rule.ID, err)
+		}
+	}
+	invalid := []Rule{
+		{Name: "", Action: Action{ServiceCode: "DOM.EP"}},
+		{Name: "no action"},
+		{Name: "field", Conditions: []Condition{{Field: "color", Operator: OpEquals, Value: "red"}}, Action: Action{ServiceCode: "DOM.EP"}},
+		{Name: "number", Conditions: []Condition{{Field: FieldWeight, Operator: OpLess, Value: "light"}}, Action: Action{ServiceCode: "DOM.EP"}},
+		{Name: "operator", Conditions: []Condition{{Field: FieldCountry, Operator: OpGreater, Value: "US"}}, Action: Action{ServiceCode: "DOM.EP"}},
+	}
+	for _, rule := range invalid {
+		if err := Validate(rule); err == nil {
+			t.Errorf("%q: want an error", rule.Name)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"os"
+	"strings"
+)
+
+// document kinds stored against a label
+const (
+	KindLabel       = "label"
+	KindPackingSlip = "packing_slip"
+)
+
+// BlobStore stores documents such as label pdfs under a key
+type BlobStore interface {
+	Put(key string, data []byte, contentType string) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+}
+
+type storageError struct {
+	s string
+}
+func (e *storageError) Error() string{
+	return e.s
+}
+
+// ErrNotFound is returned by Get when there is no blob stored under the key
+var ErrNotFound = &storageError{"Blob Not Found"}
+
+var Store BlobStore
+
+// ConnectToBlobStore sets Store using BLOB_STORE, either local (default) or s3
+func ConnectToBlobStore() error {
+	switch os.Getenv("BLOB_STORE") {
+	case "s3":
+		region := os.Getenv("S3_REGION")
+		if region == "" {
+			region = "us-east-1"
+		}
+		if os.Getenv("S3_ENDPOINT") == "" || os.Getenv("S3_BUCKET") == "" {
+			return &storageError{"S3_ENDPOINT and S3_BUCKET Must Be Set"}
+		}
+		Store = &S3Store{
+			Endpoint:  strings.TrimSuffix(os.Getenv("S3_ENDPOINT"), "/"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Region:    region,
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+		}
+		log.Print("Using S3 Blob Store")
+	default:
+		dir := os.Getenv("BLOB_DIR")
+		if dir == "" {
+			dir = "blobs"
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+		Store = &LocalStore{Dir: dir}
+		log.Print("Using Local Blob Store")
+	}
+	return nil
+}
+
+// extensions of the content types documents are stored as, anything else is stored as a pdf
+var extensions = map[string]string{
+	"application/pdf": ".pdf",
+	"application/zpl": ".zpl",
+}
+
+// Extension returns the file extension for a document content type
+func Extension(contentType string) string {
+	if ext, ok := extensions[contentType]; ok {
+		return ext
+	}
+	return ".pdf"
+}
+
+// DocumentKey returns the key a document of kind is stored under for a label
+func DocumentKey(labelID, kind, contentType string) string {
+	return "labels/" + labelID + "/" + kind + Extension(contentType)
+}
+
+// ManifestKey returns the key the pdf of a canada post manifest is stored under
+func ManifestKey(manifestID string) string {
+	return "manifests/" + manifestID + ".pdf"
+}
+
+// BatchKey returns the key the merged label pdf of a batch is stored under
+func BatchKey(batchID string) string {
+	return "batches/" + batchID + "/labels.pdf"
+}
+
+// Hash returns the hex encoded sha256 of data
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
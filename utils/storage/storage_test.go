@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLocalStore(t *testing.T) {
+	store := &LocalStore{Dir: t.TempDir()}
+	key := DocumentKey("42", KindLabel, "application/pdf")
+
+	if err := store.Put(key, []byte("%PDF-1.4"), "application/pdf"); err != nil {
+		t.Fatalf("put: %s", err)
+	}
+	got, err := store.Get(key)
+	if err != nil || string(got) != "%PDF-1.4" {
+		t.Errorf("got %q %v, want %q", got, err, "%PDF-1.4")
+	}
+	if err = store.Delete(key); err != nil {
+		t.Fatalf("delete: %s", err)
+	}
+	if _, err = store.Get(key); err != ErrNotFound {
+		t.Errorf("got %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestLocalStoreRejectsTraversal(t *testing.T) {
+	store := &LocalStore{Dir: t.TempDir()}
+	for _, key := range []string{"../escape", "/abs", "labels//x", "labels/./x"} {
+		if err := store.Put(key, []byte("x"), ""); err == nil {
+			t.Errorf("key %q was accepted", key)
+		}
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=minio/") ||
+			!strings.Contains(auth, "SignedHeaders=") || r.Header.Get("X-Amz-Content-Sha256") == "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case "PUT":
+			body, _ := ioutil.ReadAll(r.Body)
+			if Hash(body) != r.Header.Get("X-Amz-Content-Sha256") {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			objects[r.URL.Path] = body
+		case "GET":
+			body, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(body)
+		case "DELETE":
+			delete(objects, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	store := &S3Store{Endpoint: server.URL, Bucket: "labels", Region: "us-east-1", AccessKey: "minio", SecretKey: "minio123"}
+	key := DocumentKey("42", KindPackingSlip, "application/pdf")
+	if err := store.Put(key, []byte("slip"), "application/pdf"); err != nil {
+		t.Fatalf("put: %s", err)
+	}
+	if _, ok := objects["/labels/labels/42/packing_slip.pdf"]; !ok {
+		t.Errorf("object stored at wrong path: %v", objects)
+	}
+	got, err := store.Get(key)
+	if err != nil || string(got) != "slip" {
+		t.Errorf("got %q %v, want %q", got, err, "slip")
+	}
+	if err = store.Delete(key); err != nil {
+		t.Fatalf("delete: %s", err)
+	}
+	if _, err = store.Get(key); err != ErrNotFound {
+		t.Errorf("got %v, want %v", err, ErrNotFound)
+	}
+}
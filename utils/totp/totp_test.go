@@ -0,0 +1,92 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// the RFC 6238 sha1 secret "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeRFCVectors(t *testing.T) {
+	cases := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range cases {
+		got, err := Code(rfcSecret, Counter(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%d: got %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	code, _ := Code(rfcSecret, Counter(now))
+	if counter, ok := Validate(rfcSecret, code, now); !ok || counter != Counter(now) {
+		t.Errorf("current code rejected")
+	}
+	if _, ok := Validate(rfcSecret, code, now.Add(Period*time.Second)); !ok {
+		t.Errorf("code of the previous step rejected")
+	}
+	if _, ok := Validate(rfcSecret, code, now.Add(3*Period*time.Second)); ok {
+		t.Errorf("old code accepted")
+	}
+	if _, ok := Validate(rfcSecret, code[:3]+" "+code[3:], now); !ok {
+		t.Errorf("code with a space rejected")
+	}
+	for _, bad := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, ok := Validate(rfcSecret, bad, now); ok {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != 32 {
+		t.Errorf("secret %q is not 160 bits", secret)
+	}
+	if _, err = Code(secret, 1); err != nil {
+		t.Error(err)
+	}
+	if _, err = Code("not base32!", 1); err == nil {
+		t.Error("invalid secret accepted")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("ABC", "FromYama", "a@fromyama.com")
+	if !strings.HasPrefix(uri, "otpauth://totp/FromYama:a@fromyama.com?") || !strings.Contains(uri, "secret=ABC") ||
+		!strings.Contains(uri, "issuer=FromYama") {
+		t.Errorf("uri %s", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := NewRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' || seen[code] {
+			t.Errorf("code %q", code)
+		}
+		seen[code] = true
+	}
+	if HashRecoveryCode(codes[0]) != HashRecoveryCode(strings.ToUpper(strings.Replace(codes[0], "-", "", 1))) {
+		t.Error("hash depends on case or dashes")
+	}
+}
@@ -0,0 +1,64 @@
+package tracking
+
+import "strings"
+
+// normalized shipment statuses shared by every carrier
+const (
+	StatusUnknown        = "unknown"
+	StatusAccepted       = "accepted"
+	StatusInTransit      = "in_transit"
+	StatusOutForDelivery = "out_for_delivery"
+	StatusAwaitingPickup = "awaiting_pickup"
+	StatusDelivered      = "delivered"
+	StatusException      = "exception"
+)
+
+// description fragments checked in order, the first match wins so the more specific phrases come first
+var descriptionStatuses = []struct {
+	fragment string
+	status   string
+}{
+	{"out for delivery", StatusOutForDelivery},
+	{"vehicle for delivery", StatusOutForDelivery},
+	{"available for pickup", StatusAwaitingPickup},
+	{"ready for pickup", StatusAwaitingPickup},
+	{"held for pickup", StatusAwaitingPickup},
+	{"attempted", StatusException},
+	{"notice card", StatusException},
+	{"return to sender", StatusException},
+	{"returned", StatusException},
+	{"refused", StatusException},
+	{"unable to", StatusException},
+	{"delay", StatusException},
+	{"incorrect address", StatusException},
+	{"exception", StatusException},
+	// negative phrases that contain "delivered" are exceptions, a delivered status would stop tracking the shipment
+	{"undeliver", StatusException},
+	{"not delivered", StatusException},
+	{"not be delivered", StatusException},
+	{"not been delivered", StatusException},
+	{"delivered", StatusDelivered},
+	{"electronic information submitted", StatusAccepted},
+	{"shipment information received", StatusAccepted},
+	{"label created", StatusAccepted},
+	{"created a label", StatusAccepted},
+	{"information sent", StatusAccepted},
+	{"item accepted", StatusAccepted},
+	{"picked up", StatusAccepted},
+	{"pickup", StatusAccepted},
+}
+
+// NormalizeDescription maps a carrier event description to a normalized status, anything
+// that is not recognized is treated as in transit
+func NormalizeDescription(description string) string {
+	d := strings.ToLower(description)
+	if strings.TrimSpace(d) == "" {
+		return StatusUnknown
+	}
+	for _, ds := range descriptionStatuses {
+		if strings.Contains(d, ds.fragment) {
+			return ds.status
+		}
+	}
+	return StatusInTransit
+}
@@ -0,0 +1,38 @@
+package tracking
+
+import "testing"
+
+func TestNormalizeDescription(t *testing.T) {
+	cases := map[string]string{
+		"Electronic information submitted by shipper": StatusAccepted,
+		"Item accepted at the Post Office":            StatusAccepted,
+		"Item processed":                              StatusInTransit,
+		"Item in transit":                             StatusInTransit,
+		"Item out for delivery":                       StatusOutForDelivery,
+		"On vehicle for delivery":                     StatusOutForDelivery,
+		"Shipment delivered to":                       StatusDelivered,
+		"Picked up by Purolator at":                   StatusAccepted,
+		"Delivered":                                   StatusDelivered,
+		"On FedEx vehicle for delivery":               StatusOutForDelivery,
+		"Shipment information sent to FedEx":          StatusAccepted,
+		"Shipper created a label, UPS has not received the package yet.": StatusAccepted,
+		"Item successfully delivered":                                    StatusDelivered,
+		"Attempted delivery, notice card left":                           StatusException,
+		"Item being returned to sender":                                  StatusException,
+		"Delivery delayed due to weather":                                StatusException,
+		"Item available for pickup at Post Office":                       StatusAwaitingPickup,
+		"Package held for pickup at the UPS Access Point":                StatusAwaitingPickup,
+		"Scheduled pickup completed":                                     StatusAccepted,
+		"Undelivered":                                                    StatusException,
+		"Item could not be delivered":                                    StatusException,
+		"Not delivered, recipient unavailable":                           StatusException,
+		"Package has not been delivered":                                 StatusException,
+		"Undeliverable as addressed":                                     StatusException,
+		"":                                                               StatusUnknown,
+	}
+	for description, want := range cases {
+		if got := NormalizeDescription(description); got != want {
+			t.Errorf("%q: got %s, want %s", description, got, want)
+		}
+	}
+}
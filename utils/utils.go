@@ -40,8 +40,13 @@ func ParseRequestBody (r *http.Request, body *map[string]string, needed []string
 			return &missingParamError{key+" Missing"}
 		}
 	}
+	return CheckRequiredParams(*body, needed)
+}
+
+// CheckRequiredParams returns an error naming the first needed param that is missing from body
+func CheckRequiredParams (body map[string]string, needed []string) error {
 	for i := range needed {
-		if (*body)[needed[i]] == ""{
+		if body[needed[i]] == ""{
 			return &missingParamError{needed[i]+" Missing"}
 		}
 	}
@@ -1,6 +1,11 @@
 package utils
 
-import "testing"
+import (
+	"strings"
+	"testing"
+
+	"go.fromyama/utils/response"
+)
 
 func TestEncrypt(t *testing.T) {
 	got, _ := AESEncrypt("TEST STRING")
@@ -19,3 +24,26 @@ func TestDecrypt(t *testing.T) {
 		t.Errorf("got %s, want %s", got, want)
 	}
 }
+
+func TestPickList(t *testing.T) {
+	orders := []response.Order{
+		{Name: "#1001", Items: []response.Item{{Sku: "MUG-01", Title: "Mug", Quantity: "2"}, {Sku: "TEE-M", Title: "T-shirt M", Quantity: "1"}}},
+		{Name: "#1002", Items: []response.Item{{Sku: "MUG-01", Title: "Mug", Quantity: "3"}, {Title: "Gift card", Quantity: "1"}}},
+		{OrderID: "4471", Items: []response.Item{{Sku: "MUG-01", Title: "Mug", Quantity: "1"}, {Sku: "MUG-01", Title: "Mug", Quantity: "1"}}},
+	}
+	lines := PickList(orders)
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3", len(lines))
+	}
+	mug := lines[0]
+	if mug.Sku != "MUG-01" || mug.Quantity != 7 || strings.Join(mug.Orders, ",") != "#1001,#1002,4471" {
+		t.Errorf("got %+v", mug)
+	}
+	if lines[1].Sku != "TEE-M" || lines[1].Quantity != 1 {
+		t.Errorf("got %+v", lines[1])
+	}
+	// items without a sku are grouped by title after the skus
+	if lines[2].Sku != "" || lines[2].Title != "Gift card" || lines[2].Quantity != 1 {
+		t.Errorf("got %+v", lines[2])
+	}
+}